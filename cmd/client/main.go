@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/KoduIsGreat/knight-game/nw"
@@ -24,11 +26,87 @@ func main() {
 }
 
 type Game struct {
-	client       *nw.Client[snake.GameState]
+	client       *nw.Client[snake.GameState, snake.Direction]
 	started      bool
 	renderEngine snake.RaylibRenderer
 	filterText   string
 	activeTab    int32
+	chatText     string
+	chatEditMode bool
+	// lobby browser filter state
+	filterEditMode bool
+	openOnly       bool
+	lobbyPage      int
+	matchedLobby   string
+	// profile editor state
+	profileName     string
+	profileColor    uint32
+	profileEditMode bool
+	// party panel state
+	partyInviteID   string
+	partyInviteEdit bool
+	// notice is the last lobby event worth telling the player about
+	notice string
+	// killFeed are the latest deaths of the match, oldest first
+	killFeed []string
+}
+
+// killFeedSize is how many of the latest deaths are shown during a match
+const killFeedSize = 5
+
+// handleEvents follows the lobby events of the client, switching tabs when the player joins or leaves a lobby.
+func (g *Game) handleEvents() {
+	for {
+		select {
+		case ev := <-g.client.Events():
+			self := ev.ClientID == g.client.ClientID()
+			switch ev.Kind {
+			case nw.EventLobbyJoined:
+				if self {
+					g.activeTab = Lobby
+				} else {
+					g.notice = fmt.Sprintf("%s joined", g.client.DisplayName(ev.ClientID))
+				}
+			case nw.EventLobbyLeft:
+				if self {
+					g.activeTab = ServerLobbyBrowser
+				} else {
+					g.notice = fmt.Sprintf("%s left", g.client.DisplayName(ev.ClientID))
+				}
+			case nw.EventKicked:
+				g.activeTab = ServerLobbyBrowser
+			case nw.EventPromoted:
+				g.notice = fmt.Sprintf("%s is now the host", g.client.DisplayName(ev.ClientID))
+			case nw.EventGameStarted:
+				g.notice = ""
+				g.killFeed = nil
+			}
+		default:
+			return
+		}
+	}
+}
+
+// handleGameEvents takes the events of the match as they arrive, deaths go to the kill feed.
+func (g *Game) handleGameEvents() {
+	for {
+		select {
+		case ev := <-g.client.GameEvents():
+			if ev.Kind != nw.GameEventDeath {
+				continue
+			}
+			line := fmt.Sprintf("%s crashed", g.client.DisplayName(ev.ClientID))
+			if ev.OtherID != "" {
+				line = fmt.Sprintf("%s was taken out by %s", g.client.DisplayName(ev.ClientID), g.client.DisplayName(ev.OtherID))
+			}
+			g.killFeed = append(g.killFeed, line)
+			if len(g.killFeed) > killFeedSize {
+				g.killFeed = g.killFeed[1:]
+			}
+		default:
+			return
+		}
+	}
 }
 
 func (g *Game) gameLoop() {
@@ -40,21 +118,61 @@ func (g *Game) gameLoop() {
 	default:
 		break
 	}
-	g.handleInput()
+	g.handleGameEvents()
+	if g.client.IsSpectating() {
+		g.handleSpectatorCamera()
+	} else {
+		g.handleInput()
+	}
 	g.client.State().Update(float64(rl.GetFrameTime()))
-	g.renderEngine.Render(g.client.State())
+	rl.BeginDrawing()
+	g.renderEngine.Draw(g.client.State())
+	g.renderPauseOverlay()
+	g.renderChatOverlay()
+	g.renderKillFeed()
+	rl.EndDrawing()
+}
+
+// renderPauseOverlay dims the game while it is paused and shows the resume countdown.
+// The lobby owner toggles the pause with P.
+func (g *Game) renderPauseOverlay() {
+	lobby := g.client.Lobby()
+	if lobby == nil {
+		return
+	}
+	if !g.chatEditMode && lobby.OwnerClientID == g.client.ClientID() && rl.IsKeyPressed(rl.KeyP) {
+		if lobby.Paused {
+			g.client.ResumeGame()
+		} else {
+			g.client.PauseGame()
+		}
+	}
+	if !lobby.Paused {
+		return
+	}
+	rl.DrawRectangle(0, 0, windowWidth, windowHeight, rl.Fade(rl.Black, 0.4))
+	text := "PAUSED"
+	if lobby.ResumeCountdown > 0 {
+		text = fmt.Sprintf("Resuming in %d", lobby.ResumeCountdown)
+	}
+	width := rl.MeasureText(text, 40)
+	rl.DrawText(text, (windowWidth-width)/2, windowHeight/2-20, 40, rl.White)
 }
 
 func (g *Game) handleInput() {
-	var input string
+	// while typing a chat message, keys belong to the chat box
+	if g.chatEditMode || g.client.IsPaused() {
+		return
+	}
+	var input snake.Direction
 	if rl.IsKeyPressed(rl.KeyW) {
-		input = "UP"
+		input = snake.Up
 	} else if rl.IsKeyPressed(rl.KeyS) {
-		input = "DOWN"
+		input = snake.Down
 	} else if rl.IsKeyPressed(rl.KeyA) {
-		input = "LEFT"
+		input = snake.Left
 	} else if rl.IsKeyPressed(rl.KeyD) {
-		input = "RIGHT"
+		input = snake.Right
 	}
 	if rl.IsKeyPressed(rl.KeyEqual) || rl.IsKeyPressed(rl.KeyKpAdd) {
 		g.renderEngine.Camera.Zoom += 0.1
@@ -84,6 +202,40 @@ func (g *Game) handleInput() {
 	}
 }
 
+// spectatorCameraSpeed is how many world units per second the free camera pans at zoom 1.
+const spectatorCameraSpeed = 600
+
+// handleSpectatorCamera moves the free camera with WASD or the arrow keys and zooms with the mouse wheel.
+// Backspace stops spectating.
+func (g *Game) handleSpectatorCamera() {
+	if g.chatEditMode {
+		return
+	}
+	camera := &g.renderEngine.Camera
+	step := spectatorCameraSpeed * rl.GetFrameTime() / camera.Zoom
+	if rl.IsKeyDown(rl.KeyW) || rl.IsKeyDown(rl.KeyUp) {
+		camera.Target.Y -= step
+	}
+	if rl.IsKeyDown(rl.KeyS) || rl.IsKeyDown(rl.KeyDown) {
+		camera.Target.Y += step
+	}
+	if rl.IsKeyDown(rl.KeyA) || rl.IsKeyDown(rl.KeyLeft) {
+		camera.Target.X -= step
+	}
+	if rl.IsKeyDown(rl.KeyD) || rl.IsKeyDown(rl.KeyRight) {
+		camera.Target.X += step
+	}
+	if wheel := rl.GetMouseWheelMove(); wheel != 0 {
+		camera.Zoom += wheel * 0.1
+		if camera.Zoom < 0.1 {
+			camera.Zoom = 0.1
+		}
+	}
+	if rl.IsKeyPressed(rl.KeyBackspace) {
+		g.client.LeaveLobby()
+	}
+}
+
 const (
 	// ServerLobbyBrowser is the index of the server lobby browser tab.
 	ServerLobbyBrowser = 0
@@ -102,11 +254,30 @@ func (g *Game) renderLobbies() {
 	gui.SetStyle(gui.BUTTON, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
 	if gui.Button(rl.NewRectangle(115, 75, 100, 20), "Create") {
 		g.client.CreateLobby()
-		g.client.SyncLobbies()
 		g.activeTab = Lobby
 
 	}
 
+	g.renderQuickPlay(rl.NewRectangle(500, 75, 100, 20))
+	g.renderParty(rl.NewRectangle(620, 100, 300, 300))
+	if kicked := g.client.Kicked(); kicked != nil && g.client.Lobby() == nil {
+		rl.DrawText(kickedText(kicked), 10, 50, 16, rl.Maroon)
+	}
+
+	filterRect := rl.NewRectangle(220, 75, 150, 20)
+	if gui.TextBox(filterRect, &g.filterText, 32, g.filterEditMode) {
+		if g.filterEditMode {
+			g.lobbyPage = 0
+			g.subscribeLobbies()
+		}
+		g.filterEditMode = !g.filterEditMode
+	}
+	if openOnly := gui.CheckBox(rl.NewRectangle(380, 75, 20, 20), "Open only", g.openOnly); openOnly != g.openOnly {
+		g.openOnly = openOnly
+		g.lobbyPage = 0
+		g.subscribeLobbies()
+	}
+
 	codeRect := rl.NewRectangle(10, 100, 100, 20)
 	rl.DrawRectangleRounded(codeRect, 0, 0, rl.Black)
 	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
@@ -120,14 +291,14 @@ func (g *Game) renderLobbies() {
 	rl.DrawRectangleRounded(playerRect, 0, 0, rl.Black)
 	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
 	gui.Label(playerRect, "Players")
-	for i, lobby := range g.client.Lobbies.Lobbies {
+	for i, lobby := range g.client.Lobbies().Lobbies {
 
 		codeCellRect := rl.NewRectangle(10, 105+float32((i+1)*20), 100, 20)
 		rl.DrawRectangleRec(codeCellRect, rl.Gray)
 		gui.Label(codeCellRect, lobby.Code)
 		ownerCellRect := rl.NewRectangle(110, 105+float32((i+1)*20), 100, 20)
 		rl.DrawRectangleRec(ownerCellRect, rl.Gray)
-		gui.Label(ownerCellRect, lobby.OwnerID)
+		gui.Label(ownerCellRect, lobby.OwnerName)
 		playerCellRect := rl.NewRectangle(210, 105+float32((i+1)*20), 100, 20)
 		rl.DrawRectangleRec(playerCellRect, rl.Gray)
 		gui.Label(playerCellRect, fmt.Sprintf("%d/%d", lobby.NumClients, lobby.MaxClients))
@@ -136,12 +307,149 @@ func (g *Game) renderLobbies() {
 		if gui.Button(rl.NewRectangle(310, 105+float32((i+1)*20), 100, 20), "Join") {
 			g.client.JoinLobby(lobby.Code)
 		}
+		if gui.Button(rl.NewRectangle(415, 105+float32((i+1)*20), 100, 20), fmt.Sprintf("Watch (%d)", lobby.Spectators)) {
+			g.client.Spectate(lobby.Code)
+			g.activeTab = Lobby
+		}
 		i++
 	}
+
+	pagerY := 105 + float32((lobbyPageSize+1)*20)
+	sync := g.client.Lobbies()
+	if g.lobbyPage > 0 && gui.Button(rl.NewRectangle(10, pagerY, 100, 20), "Prev") {
+		g.lobbyPage--
+		g.subscribeLobbies()
+	}
+	if sync.Offset+len(sync.Lobbies) < sync.Total && gui.Button(rl.NewRectangle(310, pagerY, 100, 20), "Next") {
+		g.lobbyPage++
+		g.subscribeLobbies()
+	}
 }
 
-func (g *Game) renderSettings() {
+// renderParty draws the client's party with its invite controls, or the pending invites outside of a party.
+func (g *Game) renderParty(bounds rl.Rectangle) {
+	gui.Panel(bounds, "Party")
+	gui.SetStyle(gui.BUTTON, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
+	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, int64(gui.TEXT_ALIGN_LEFT))
+	defer gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
+	row := func(i int) float32 {
+		return bounds.Y + 25 + float32(i*25)
+	}
+	if reason := g.client.PartyRejection(); reason != "" {
+		rl.DrawText(reason, int32(bounds.X), int32(bounds.Y+bounds.Height+5), 14, rl.Red)
+	}
+	party := g.client.Party()
+	if party == nil {
+		if gui.Button(rl.NewRectangle(bounds.X+5, row(0), 100, 20), "Create party") {
+			g.client.CreateParty()
+		}
+		// players share their ID to be invited
+		gui.Label(rl.NewRectangle(bounds.X+110, row(0), bounds.Width-115, 20), "ID "+g.client.ClientID())
+		for i, invite := range g.client.PartyInvites() {
+			y := row(i + 1)
+			gui.Label(rl.NewRectangle(bounds.X+5, y, bounds.Width-120, 20), fmt.Sprintf("Invite from %s", invite.FromName))
+			if gui.Button(rl.NewRectangle(bounds.X+bounds.Width-110, y, 50, 20), "Join") {
+				g.client.JoinParty(invite.PartyID)
+			}
+			if gui.Button(rl.NewRectangle(bounds.X+bounds.Width-55, y, 50, 20), "No") {
+				g.client.DeclineParty(invite.PartyID)
+			}
+		}
+		return
+	}
+	for i, id := range party.Members {
+		name := g.client.DisplayName(id)
+		if id == party.LeaderID {
+			name += "  (leader)"
+		}
+		gui.Label(rl.NewRectangle(bounds.X+5, row(i), bounds.Width-10, 20), name)
+	}
+	bottom := bounds.Y + bounds.Height - 25
+	if party.LeaderID == g.client.ClientID() {
+		if gui.TextBox(rl.NewRectangle(bounds.X+5, bottom-25, bounds.Width-90, 20), &g.partyInviteID, 64, g.partyInviteEdit) {
+			g.partyInviteEdit = !g.partyInviteEdit
+		}
+		if gui.Button(rl.NewRectangle(bounds.X+bounds.Width-80, bottom-25, 75, 20), "Invite") && g.partyInviteID != "" {
+			g.client.InviteToParty(g.partyInviteID)
+			g.partyInviteID = ""
+		}
+	}
+	if gui.Button(rl.NewRectangle(bounds.X+5, bottom, 100, 20), "Leave party") {
+		g.client.LeaveParty()
+	}
+}
 
+// quickPlayGroupSize is the number of players quick play asks the matchmaker for.
+const quickPlayGroupSize = 4
+
+// renderQuickPlay draws the quick play button, or the queue status and a cancel button while queued.
+func (g *Game) renderQuickPlay(bounds rl.Rectangle) {
+	gui.SetStyle(gui.BUTTON, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
+	status := g.client.MatchmakeStatus()
+	if status == nil || status.State != nw.MatchmakeQueued {
+		if gui.Button(bounds, "Quick play") {
+			g.client.Matchmake("", quickPlayGroupSize)
+		}
+		// jump to the lobby tab once per match
+		if status != nil && status.State == nw.MatchmakeMatched && status.LobbyID != g.matchedLobby {
+			g.matchedLobby = status.LobbyID
+			g.activeTab = Lobby
+		}
+		return
+	}
+	if gui.Button(bounds, "Cancel") {
+		g.client.CancelMatchmake()
+	}
+	statusRect := rl.NewRectangle(bounds.X+bounds.Width+5, bounds.Y, 200, bounds.Height)
+	gui.Label(statusRect, fmt.Sprintf("#%d in queue, ~%s", status.Position, status.EstimatedWait.Round(time.Second)))
+}
+
+// lobbyPageSize is the number of lobbies shown per page of the lobby browser.
+const lobbyPageSize = 20
+
+// subscribeLobbies resubscribes to the lobby list with the browser's filter and page.
+func (g *Game) subscribeLobbies() {
+	g.client.SubscribeLobbies(nw.LobbyQuery{
+		Filter: nw.LobbyFilter{
+			Name:      g.filterText,
+			OpenSlots: g.openOnly,
+		},
+		Offset: g.lobbyPage * lobbyPageSize,
+		Limit:  lobbyPageSize,
+	})
+}
+
+// profileColors are the snake colors players can pick from, 0 leaves the default.
+var profileColors = []uint32{0, 0xE62937FF, 0xFFA100FF, 0xFDF900FF, 0x873CBEFF, 0xFF6DC2FF, 0x7F6A4FFF}
+
+// renderSettings draws the profile editor.
+func (g *Game) renderSettings() {
+	gui.Label(rl.NewRectangle(10, 75, 100, 20), "Name")
+	if gui.TextBox(rl.NewRectangle(110, 75, 200, 20), &g.profileName, 16, g.profileEditMode) {
+		g.profileEditMode = !g.profileEditMode
+	}
+	gui.Label(rl.NewRectangle(10, 100, 100, 20), "Color")
+	for i, c := range profileColors {
+		swatch := rl.NewRectangle(110+float32(i*25), 100, 20, 20)
+		if c == 0 {
+			rl.DrawRectangleLinesEx(swatch, 1, rl.Black)
+		} else {
+			rl.DrawRectangleRec(swatch, rl.GetColor(uint(c)))
+		}
+		if c == g.profileColor {
+			rl.DrawRectangleLinesEx(rl.NewRectangle(swatch.X-2, swatch.Y-2, swatch.Width+4, swatch.Height+4), 2, rl.Black)
+		}
+		if rl.IsMouseButtonPressed(rl.MouseLeftButton) && rl.CheckCollisionPointRec(rl.GetMousePosition(), swatch) {
+			g.profileColor = c
+		}
+	}
+	gui.SetStyle(gui.BUTTON, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
+	if gui.Button(rl.NewRectangle(110, 130, 100, 20), "Save") {
+		g.client.SetProfile(nw.Profile{Name: g.profileName, Color: g.profileColor})
+	}
+	if reason := g.client.ProfileRejection(); reason != "" {
+		rl.DrawText(reason, 220, 133, 14, rl.Red)
+	}
 }
 
 func (g *Game) renderServerLobbyBrowser() {
@@ -150,8 +458,8 @@ func (g *Game) renderServerLobbyBrowser() {
 	rl.DrawText(fmt.Sprintf("Server: %s"), 10, 10, 20, rl.Black)
 	gui.Label(rl.NewRectangle(10, 40, 100, 20), "Lobbies")
 	tabs := []string{"Lobbies", "Settings"}
-	if g.client.Lobby() != nil {
-		tabs = append(tabs, g.client.Lobby().ID)
+	if lobby := g.client.Lobby(); lobby != nil {
+		tabs = append(tabs, lobby.ID)
 	}
 	gui.TabBar(rl.NewRectangle(10, 40, 100, 20), tabs, &g.activeTab)
 
@@ -163,6 +471,9 @@ func (g *Game) renderServerLobbyBrowser() {
 	case Lobby:
 		g.renderLobby()
 	}
+	if g.notice != "" {
+		rl.DrawText(g.notice, 10, windowHeight-30, 16, rl.DarkGray)
+	}
 
 	rl.EndDrawing()
 }
@@ -173,9 +484,15 @@ func (g *Game) renderLobby() {
 	rl.DrawText("Lobby", 10, 10, 20, rl.Black)
 	gui.Label(rl.NewRectangle(10, 40, 100, 20), "Lobby")
 	lobby := g.client.Lobby()
+	if lobby == nil {
+		return
+	}
 	gui.Label(rl.NewRectangle(10, 40, 100, 20), lobby.ID)
-	gui.Label(rl.NewRectangle(110, 40, 100, 20), lobby.OwnerClientID)
+	gui.Label(rl.NewRectangle(110, 40, 100, 20), g.client.DisplayName(lobby.OwnerClientID))
 	gui.Label(rl.NewRectangle(210, 40, 100, 20), fmt.Sprintf("%d/%d", len(lobby.ConnectedClients), lobby.MaxPlayers))
+	if lobby.Settings.Mode != "" {
+		gui.Label(rl.NewRectangle(210, 60, 100, 20), lobby.Settings.Mode)
+	}
 
 	gui.SetStyle(gui.BUTTON, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
 	if gui.Button(rl.NewRectangle(310, 40, 100, 20), "Start") {
@@ -186,9 +503,305 @@ func (g *Game) renderLobby() {
 	if gui.Button(rl.NewRectangle(310, 60, 100, 20), "Leave") {
 		g.client.LeaveLobby()
 	}
+	ready := "Ready"
+	if lobby.ReadyClients[g.client.ClientID()] {
+		ready = "Not ready"
+	}
+	if gui.Button(rl.NewRectangle(310, 80, 100, 20), ready) {
+		g.client.Ready()
+	}
+	if lobby.OwnerClientID == g.client.ClientID() {
+		settings := lobby.Settings
+		if lateJoin := gui.CheckBox(rl.NewRectangle(420, 40, 20, 20), "Allow late join", settings.LateJoin); lateJoin != settings.LateJoin {
+			settings.LateJoin = lateJoin
+			g.client.UpdateLobbySettings(settings)
+		}
+		if autoBalance := gui.CheckBox(rl.NewRectangle(420, 65, 20, 20), "Auto balance", settings.AutoBalance); autoBalance != settings.AutoBalance {
+			settings.AutoBalance = autoBalance
+			g.client.UpdateLobbySettings(settings)
+		}
+		teams := "Free for all"
+		if settings.Teams > 1 {
+			teams = fmt.Sprintf("%d teams", settings.Teams)
+		}
+		if gui.Button(rl.NewRectangle(570, 40, 100, 20), teams) {
+			settings.Teams = nextTeamCount(settings.Teams)
+			g.client.UpdateLobbySettings(settings)
+		}
+		sight := "See everything"
+		if settings.VisibilityRadius > 0 {
+			sight = fmt.Sprintf("See %d cells", settings.VisibilityRadius)
+		}
+		if gui.Button(rl.NewRectangle(570, 65, 100, 20), sight) {
+			settings.VisibilityRadius = nextVisibilityRadius(settings.VisibilityRadius)
+			g.client.UpdateLobbySettings(settings)
+		}
+	}
+	switch {
+	case lobby.CountingDown:
+		rl.DrawText(fmt.Sprintf("Starting in %d", lobby.Countdown), 700, 40, 20, rl.DarkGreen)
+	case lobby.CountdownCancelled != "":
+		rl.DrawText(fmt.Sprintf("Countdown cancelled: %s", lobby.CountdownCancelled), 700, 40, 20, rl.Maroon)
+	}
+	g.renderChatPanel(rl.NewRectangle(10, 100, 400, 300))
+	g.renderMembers(rl.NewRectangle(10, 410, 400, 300), lobby)
+	g.renderVotes(rl.NewRectangle(420, 410, 400, 300), lobby)
+	if lobby.Results != nil {
+		g.renderResults(rl.NewRectangle(420, 100, 400, 300), lobby.Results)
+	}
 	rl.EndDrawing()
 }
 
+// maxTeams is the largest number of teams the owner can split a lobby into.
+const maxTeams = 4
+
+// nextTeamCount cycles between free for all and two to maxTeams teams.
+func nextTeamCount(teams int) int {
+	if teams < 2 {
+		return 2
+	}
+	if teams >= maxTeams {
+		return 0
+	}
+	return teams + 1
+}
+
+// visibilityRadii are the visibility radii the owner cycles through, 0 shows the whole world.
+var visibilityRadii = []int{0, 15, 25, 40}
+
+// nextVisibilityRadius returns the radius after radius in visibilityRadii.
+func nextVisibilityRadius(radius int) int {
+	i := slices.Index(visibilityRadii, radius)
+	return visibilityRadii[(i+1)%len(visibilityRadii)]
+}
+
+// kickedText explains the last kick to the kicked player.
+func kickedText(k *nw.Kicked) string {
+	text := fmt.Sprintf("Kicked from lobby %s", k.LobbyID)
+	if k.Reason != "" {
+		text += ": " + k.Reason
+	}
+	if wait := time.Until(k.BannedUntil); wait > 0 {
+		text += fmt.Sprintf(", you can rejoin in %s", wait.Round(time.Second))
+	}
+	return text
+}
+
+// voteText describes a vote for the lobby tab.
+func (g *Game) voteText(vs *nw.VoteStatus) string {
+	switch vs.Type {
+	case nw.VoteKick:
+		return fmt.Sprintf("Kick %s?", g.client.DisplayName(vs.Target))
+	case nw.VoteMode:
+		return fmt.Sprintf("Play %s next?", vs.Target)
+	default:
+		return "Rematch?"
+	}
+}
+
+// renderVotes draws the open vote with its ballot buttons, or the outcome of the last one,
+// followed by buttons to call rematch and mode votes.
+func (g *Game) renderVotes(bounds rl.Rectangle, lobby *nw.Lobby) {
+	gui.Panel(bounds, "Votes")
+	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, int64(gui.TEXT_ALIGN_LEFT))
+	line := func(i int) rl.Rectangle {
+		return rl.NewRectangle(bounds.X+5, bounds.Y+25+float32(i*25), bounds.Width-10, 20)
+	}
+	if vs := lobby.Vote; vs != nil {
+		text := g.voteText(vs)
+		if vs.State == nw.VoteOpen {
+			text += fmt.Sprintf("  %d/%d yes, %d no, %s left", vs.Yes, vs.Needed, vs.No, time.Until(vs.EndsAt).Round(time.Second))
+		} else {
+			text += fmt.Sprintf("  %s", vs.State)
+		}
+		gui.Label(line(0), text)
+		if vs.State == nw.VoteOpen && !(vs.Type == nw.VoteKick && vs.Target == g.client.ClientID()) {
+			if gui.Button(rl.NewRectangle(bounds.X+5, bounds.Y+50, 60, 20), "Yes") {
+				g.client.CastVote(true)
+			}
+			if gui.Button(rl.NewRectangle(bounds.X+70, bounds.Y+50, 60, 20), "No") {
+				g.client.CastVote(false)
+			}
+		}
+	}
+	if lobby.VoteRejection != "" {
+		gui.Label(line(3), "Vote refused: "+lobby.VoteRejection)
+	}
+	if lobby.Spectating || lobby.Started {
+		gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
+		return
+	}
+	y := bounds.Y + 100
+	if lobby.Results != nil && gui.Button(rl.NewRectangle(bounds.X+5, y, 120, 20), "Vote rematch") {
+		g.client.CallVote(nw.VoteRematch, "")
+	}
+	for i, mode := range lobby.Modes {
+		if mode == lobby.Settings.Mode {
+			continue
+		}
+		if gui.Button(rl.NewRectangle(bounds.X+130+float32(i*125), y, 120, 20), "Vote "+mode) {
+			g.client.CallVote(nw.VoteMode, mode)
+		}
+	}
+	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
+}
+
+// renderMembers lists the lobby members with their ready state and team.
+// The owner can click a member's team to move them to the next one or kick them, other players can vote to kick.
+func (g *Game) renderMembers(bounds rl.Rectangle, lobby *nw.Lobby) {
+	gui.Panel(bounds, "Players")
+	ids := make([]string, 0, len(lobby.ConnectedClients))
+	for id := range lobby.ConnectedClients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	isOwner := lobby.OwnerClientID == g.client.ClientID()
+	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, int64(gui.TEXT_ALIGN_LEFT))
+	for i, id := range ids {
+		y := bounds.Y + 25 + float32(i*20)
+		if y > bounds.Y+bounds.Height-20 {
+			break
+		}
+		line := g.client.DisplayName(id)
+		if lobby.ReadyClients[id] {
+			line += "  (ready)"
+		}
+		gui.Label(rl.NewRectangle(bounds.X+5, y, bounds.Width-160, 20), line)
+		kickRect := rl.NewRectangle(bounds.X+bounds.Width-150, y, 45, 20)
+		switch {
+		case id == g.client.ClientID() || lobby.Spectating:
+		case isOwner:
+			if gui.Button(kickRect, "Kick") {
+				g.client.KickFromLobby(id, "kicked by the lobby owner")
+			}
+		case gui.Button(kickRect, "Vote"):
+			g.client.CallVote(nw.VoteKick, id)
+		}
+		team, ok := lobby.Teams[id]
+		if !ok {
+			continue
+		}
+		teamRect := rl.NewRectangle(bounds.X+bounds.Width-100, y, 95, 20)
+		if !isOwner {
+			gui.Label(teamRect, fmt.Sprintf("Team %d", team))
+			continue
+		}
+		if gui.Button(teamRect, fmt.Sprintf("Team %d", team)) {
+			g.client.AssignTeam(id, team%lobby.Settings.Teams+1)
+		}
+	}
+	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
+}
+
+// renderResults draws the standings of the last match, the lobby is back in the ready check for a rematch.
+func (g *Game) renderResults(bounds rl.Rectangle, over *nw.GameOver) {
+	gui.Panel(bounds, "Results")
+	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, int64(gui.TEXT_ALIGN_LEFT))
+	gui.Label(rl.NewRectangle(bounds.X+5, bounds.Y+25, bounds.Width-10, 20), over.Reason)
+	top := bounds.Y + 50
+	for _, team := range over.Teams {
+		gui.Label(rl.NewRectangle(bounds.X+5, top, bounds.Width-10, 20), fmt.Sprintf("#%d  Team %d  %d", team.Rank, team.Team, team.Score))
+		top += 20
+	}
+	for i, result := range over.Results {
+		y := top + float32(i*20)
+		if y > bounds.Y+bounds.Height-20 {
+			break
+		}
+		line := fmt.Sprintf("#%d  %s  %d", result.Rank, g.client.DisplayName(result.ClientID), result.Score)
+		if result.ClientID == g.client.ClientID() {
+			line += "  (you)"
+		}
+		gui.Label(rl.NewRectangle(bounds.X+5, y, bounds.Width-10, 20), line)
+	}
+	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
+}
+
+const (
+	chatLineHeight   = 20
+	chatOverlayLines = 6
+	chatMaxLength    = 128
+)
+
+// renderChatPanel draws the lobby chat history and an input box within bounds.
+func (g *Game) renderChatPanel(bounds rl.Rectangle) {
+	gui.Panel(bounds, "Chat")
+	history := g.client.ChatHistory()
+	lines := int(bounds.Height/chatLineHeight) - 3
+	if len(history) > lines {
+		history = history[len(history)-lines:]
+	}
+	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, int64(gui.TEXT_ALIGN_LEFT))
+	for i, cm := range history {
+		lineRect := rl.NewRectangle(bounds.X+5, bounds.Y+25+float32(i*chatLineHeight), bounds.Width-10, chatLineHeight)
+		gui.Label(lineRect, fmt.Sprintf("%s: %s", chatSender(cm), cm.Text))
+	}
+	gui.SetStyle(gui.LABEL, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
+	inputRect := rl.NewRectangle(bounds.X+5, bounds.Y+bounds.Height-25, bounds.Width-70, 20)
+	if gui.TextBox(inputRect, &g.chatText, chatMaxLength, g.chatEditMode) {
+		if g.chatEditMode && rl.IsKeyPressed(rl.KeyEnter) {
+			g.sendChat()
+		}
+		g.chatEditMode = !g.chatEditMode
+	}
+	gui.SetStyle(gui.BUTTON, gui.TEXT_ALIGNMENT, gui.TEXT_ALIGN_CENTER)
+	if gui.Button(rl.NewRectangle(bounds.X+bounds.Width-60, bounds.Y+bounds.Height-25, 55, 20), "Send") {
+		g.sendChat()
+	}
+}
+
+// renderChatOverlay draws the most recent chat lines over the game.
+// Pressing T opens the chat box, Enter sends and Escape closes it.
+func (g *Game) renderChatOverlay() {
+	history := g.client.ChatHistory()
+	if len(history) > chatOverlayLines {
+		history = history[len(history)-chatOverlayLines:]
+	}
+	for i, cm := range history {
+		rl.DrawText(fmt.Sprintf("%s: %s", chatSender(cm), cm.Text), 10, int32(windowHeight-60-(len(history)-i)*chatLineHeight), 16, rl.DarkGray)
+	}
+	if !g.chatEditMode {
+		if rl.IsKeyPressed(rl.KeyT) {
+			g.chatEditMode = true
+		}
+		return
+	}
+	inputRect := rl.NewRectangle(10, windowHeight-50, 400, 20)
+	gui.TextBox(inputRect, &g.chatText, chatMaxLength, true)
+	if rl.IsKeyPressed(rl.KeyEnter) {
+		g.sendChat()
+		g.chatEditMode = false
+	}
+	if rl.IsKeyPressed(rl.KeyEscape) {
+		g.chatText = ""
+		g.chatEditMode = false
+	}
+}
+
+// renderKillFeed lists the latest deaths in the top right corner.
+func (g *Game) renderKillFeed() {
+	for i, line := range g.killFeed {
+		width := rl.MeasureText(line, 16)
+		rl.DrawText(line, windowWidth-width-10, int32(10+i*chatLineHeight), 16, rl.Maroon)
+	}
+}
+
+// chatSender returns the name a chat message is shown as coming from.
+func chatSender(cm nw.ChatMessage) string {
+	if cm.FromName != "" {
+		return cm.FromName
+	}
+	return cm.From
+}
+
+func (g *Game) sendChat() {
+	if g.chatText == "" {
+		return
+	}
+	g.client.SendChat(nw.ChatLobby, g.chatText)
+	g.chatText = ""
+}
+
 func run() error {
 	sm := snake.NewClientStateManger()
 	renderer := snake.NewRaylibRenderer()
@@ -199,7 +812,10 @@ func run() error {
 		client:       nw.NewClient(sm, nw.ClientOpts{QuicConfig: &quic.Config{KeepAlivePeriod: time.Second, MaxIdleTimeout: time.Minute * 15}}),
 		renderEngine: renderer,
 	}
+	g.renderEngine.Profiles = g.client.MemberProfile
+	g.subscribeLobbies()
 	for !g.renderEngine.ShouldClose() {
+		g.handleEvents()
 		if g.client.IsStarted() {
 			g.gameLoop()
 		} else {
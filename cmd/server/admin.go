@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KoduIsGreat/knight-game/nw"
+	"github.com/KoduIsGreat/knight-game/state/snake"
+)
+
+const adminHelp = `commands:
+  ban <id|ip:addr> [duration] [reason]   ban a player, or everyone from an IP, e.g. "ban ip:10.0.0.7 2h spamming",
+                                         no duration bans for good
+  unban <id|ip:addr>                     lift a ban
+  bans                                   list the bans in effect
+  mod <id>                               let a player kick from any lobby
+  unmod <id>                             revoke the moderator role
+  mods                                   list the moderators
+  ticks                                  show how well every lobby keeps up with the tick rate`
+
+// adminConsole reads admin commands from in, one per line, and writes their results to out.
+func adminConsole(s *nw.Server[snake.GameState, snake.Direction], in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := adminCommand(s, fields, out); err != nil {
+			fmt.Fprintln(out, "error:", err)
+		}
+	}
+}
+
+func adminCommand(s *nw.Server[snake.GameState, snake.Direction], fields []string, out io.Writer) error {
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case "ban":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: ban <id|ip:addr> [duration] [reason]")
+		}
+		target, args := args[0], args[1:]
+		var d time.Duration
+		if len(args) > 0 {
+			if parsed, err := time.ParseDuration(args[0]); err == nil {
+				d, args = parsed, args[1:]
+			}
+		}
+		if err := s.Ban(target, strings.Join(args, " "), d); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "banned", target)
+	case "unban":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: unban <id|ip:addr>")
+		}
+		ok, err := s.Unban(args[0])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s is not banned", args[0])
+		}
+		fmt.Fprintln(out, "unbanned", args[0])
+	case "bans":
+		for _, b := range s.Bans() {
+			until := "forever"
+			if !b.Until.IsZero() {
+				until = "until " + b.Until.Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\n", b.Target, until, b.Reason)
+		}
+	case "mod", "unmod":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s <id>", cmd)
+		}
+		return s.SetModerator(args[0], cmd == "mod")
+	case "mods":
+		for _, m := range s.Moderators() {
+			fmt.Fprintln(out, m)
+		}
+	case "ticks":
+		stats := s.TickStats()
+		codes := make([]string, 0, len(stats))
+		for code := range stats {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			t := stats[code]
+			fmt.Fprintf(out, "%s\ttick %d\tp50 %s\tp95 %s\tp99 %s\tmax %s\toverruns %d\tcaught up %d\tskipped %d\n",
+				code, t.Tick, t.P50, t.P95, t.P99, t.Max, t.Overruns, t.CaughtUp, t.Skipped)
+		}
+	case "help":
+		fmt.Fprintln(out, adminHelp)
+	default:
+		return fmt.Errorf("unknown command %q, try help", cmd)
+	}
+	return nil
+}
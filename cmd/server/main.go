@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/KoduIsGreat/knight-game/nw"
@@ -15,11 +17,40 @@ func main() {
 	}
 }
 
+// gameModes are the rule sets lobbies can vote to switch between.
+var gameModes = map[string]func() nw.StateManager[snake.GameState, snake.Direction]{
+	"classic": func() nw.StateManager[snake.GameState, snake.Direction] {
+		return snake.NewServerStateManager(snake.WithRules(snake.Rules{TimeLimit: 5 * time.Minute}))
+	},
+	"blitz": func() nw.StateManager[snake.GameState, snake.Direction] {
+		return snake.NewServerStateManager(snake.WithRules(snake.Rules{TimeLimit: time.Minute, ScoreLimit: 10}))
+	},
+	"survival": func() nw.StateManager[snake.GameState, snake.Direction] {
+		return snake.NewServerStateManager(snake.WithRules(snake.Rules{LastSnakeStanding: true}))
+	},
+}
+
 func run() error {
+	banFile := flag.String("bans", "bans.json", "file the bans and moderators are kept in")
+	maxRewind := flag.Duration("max-rewind", 200*time.Millisecond, "how far back collisions are judged by what players saw, 0 turns lag compensation off")
+	flag.Parse()
+
+	lobbyOptions := []nw.GameServerOption[snake.GameState, snake.Direction]{nw.WithGameModes("classic", gameModes)}
+	if *maxRewind > 0 {
+		lobbyOptions = append(lobbyOptions, nw.WithLagCompensation[snake.GameState, snake.Direction](snake.CloneGameState, *maxRewind))
+	}
+
 	sm := snake.NewServerStateManager()
-	s := nw.NewServer(sm, nw.WithQuicConfig[snake.GameState](&quic.Config{
-		KeepAlivePeriod: time.Second,
-		MaxIdleTimeout:  time.Minute * 15,
-	}))
+	s := nw.NewServer(sm,
+		nw.WithQuicConfig[snake.GameState, snake.Direction](&quic.Config{
+			KeepAlivePeriod: time.Second,
+			MaxIdleTimeout:  time.Minute * 15,
+		}),
+		// every lobby gets its own state from its game mode
+		nw.WithLobbyOptions(lobbyOptions...),
+		nw.WithBanFile[snake.GameState, snake.Direction](*banFile),
+	)
+	// bans and moderators are managed by typing commands into the server's terminal
+	go adminConsole(s, os.Stdin, os.Stdout)
 	return s.Listen()
 }
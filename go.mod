@@ -21,9 +21,9 @@ require (
 
 require (
 	github.com/ebitengine/purego v0.7.1 // indirect
-	github.com/gen2brain/raylib-go/raygui v0.0.0-20240628125141-62016ee92fc0 // indirect
-	github.com/gen2brain/raylib-go/raylib v0.0.0-20240628125141-62016ee92fc0 // indirect
+	github.com/gen2brain/raylib-go/raygui v0.0.0-20240628125141-62016ee92fc0
+	github.com/gen2brain/raylib-go/raylib v0.0.0-20240628125141-62016ee92fc0
 	github.com/quic-go/quic-go v0.47.0
-	golang.org/x/exp v0.0.0-20240707233637-46b078467d37 // indirect
+	golang.org/x/exp v0.0.0-20240707233637-46b078467d37
 	golang.org/x/sys v0.23.0 // indirect
 )
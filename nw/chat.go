@@ -0,0 +1,174 @@
+package nw
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultChatMaxLength = 256
+	defaultChatRate      = 5
+	defaultChatWindow    = 5 * time.Second
+	chatHistorySize      = 100
+)
+
+// ChatScope determines who receives a chat message.
+type ChatScope uint8
+
+const (
+	// ChatLobby delivers the message to the members of the sender's lobby.
+	ChatLobby ChatScope = iota
+	// ChatServer delivers the message to every client connected to the server.
+	ChatServer
+)
+
+type ChatMessage struct {
+	Scope   ChatScope `json:"scope"`
+	LobbyID string    `json:"lobbyId,omitempty"`
+	From    string    `json:"from"`
+	// FromName is the sender's display name at the time it was sent
+	FromName string    `json:"fromName,omitempty"`
+	Text     string    `json:"text"`
+	SentAt   time.Time `json:"sentAt"`
+}
+
+// ChatFilter inspects and optionally rewrites chat text before it is delivered.
+// Returning false drops the message.
+type ChatFilter interface {
+	Filter(text string) (string, bool)
+}
+
+type ChatFilterFunc func(text string) (string, bool)
+
+func (f ChatFilterFunc) Filter(text string) (string, bool) {
+	return f(text)
+}
+
+// WordFilter masks every occurrence of the given words with asterisks.
+// Matching is case insensitive for ASCII text.
+func WordFilter(words ...string) ChatFilter {
+	lowered := make([]string, 0, len(words))
+	for _, w := range words {
+		if w != "" {
+			lowered = append(lowered, asciiLower(w))
+		}
+	}
+	return ChatFilterFunc(func(text string) (string, bool) {
+		lower := asciiLower(text)
+		out := []byte(text)
+		for _, w := range lowered {
+			for i := 0; ; {
+				j := strings.Index(lower[i:], w)
+				if j < 0 {
+					break
+				}
+				start := i + j
+				for k := start; k < start+len(w); k++ {
+					out[k] = '*'
+				}
+				i = start + len(w)
+			}
+		}
+		return string(out), true
+	})
+}
+
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+// rateLimiter allows at most limit events within a sliding window.
+// It is not safe for concurrent use, each client owns its own limiter.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	events []time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		events: make([]time.Time, 0, limit),
+	}
+}
+
+func (r *rateLimiter) allow(now time.Time) bool {
+	if r.limit <= 0 {
+		return true
+	}
+	cutoff := now.Add(-r.window)
+	kept := r.events[:0]
+	for _, t := range r.events {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	r.events = kept
+	if len(r.events) >= r.limit {
+		return false
+	}
+	r.events = append(r.events, now)
+	return true
+}
+
+// sanitizeChat trims, length limits and filters the text of a chat message.
+// The text is cut to at most maxLength bytes without splitting a character.
+// It reports false if the message should not be delivered.
+func sanitizeChat(text string, maxLength int, filter ChatFilter) (string, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", false
+	}
+	if maxLength > 0 && len(text) > maxLength {
+		cut := maxLength
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+	if filter != nil {
+		return filter.Filter(text)
+	}
+	return text, true
+}
+
+// chatHistory is a bounded buffer of the most recent chat messages a client received.
+type chatHistory struct {
+	mu       sync.Mutex
+	messages []ChatMessage
+	size     int
+}
+
+func newChatHistory(size int) *chatHistory {
+	return &chatHistory{
+		messages: make([]ChatMessage, 0, size),
+		size:     size,
+	}
+}
+
+func (h *chatHistory) add(cm ChatMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.messages) == h.size {
+		copy(h.messages, h.messages[1:])
+		h.messages = h.messages[:h.size-1]
+	}
+	h.messages = append(h.messages, cm)
+}
+
+func (h *chatHistory) snapshot() []ChatMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]ChatMessage, len(h.messages))
+	copy(out, h.messages)
+	return out
+}
@@ -0,0 +1,68 @@
+package nw
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChatRateLimiter(t *testing.T) {
+	now := time.Now()
+	rl := newRateLimiter(2, time.Second)
+	if !rl.allow(now) || !rl.allow(now.Add(100*time.Millisecond)) {
+		t.Fatal("expected first two messages to be allowed")
+	}
+	if rl.allow(now.Add(200 * time.Millisecond)) {
+		t.Error("expected third message within the window to be rejected")
+	}
+	if !rl.allow(now.Add(1100 * time.Millisecond)) {
+		t.Error("expected message after the window to be allowed")
+	}
+}
+
+func TestSanitizeChat(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		max    int
+		filter ChatFilter
+		want   string
+		ok     bool
+	}{
+		{name: "plain", text: "hello", max: 10, want: "hello", ok: true},
+		{name: "blank", text: "   ", max: 10, want: "", ok: false},
+		{name: "truncated", text: "hello world", max: 5, want: "hello", ok: true},
+		{name: "truncated between characters", text: "héllo wörld", max: 8, want: "héllo w", ok: true},
+		{name: "truncated inside a character", text: "héllo", max: 2, want: "h", ok: true},
+		{name: "word filter", text: "Darn it, darn", max: 20, filter: WordFilter("darn"), want: "**** it, ****", ok: true},
+		{
+			name: "dropping filter",
+			text: "spam",
+			max:  10,
+			filter: ChatFilterFunc(func(string) (string, bool) {
+				return "", false
+			}),
+			want: "",
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sanitizeChat(tt.text, tt.max, tt.filter)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got (%q, %v), want (%q, %v)", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestChatHistoryBounded(t *testing.T) {
+	h := newChatHistory(3)
+	for _, text := range []string{"a", "b", "c", "d"} {
+		h.add(ChatMessage{Text: text})
+	}
+	got := h.snapshot()
+	if len(got) != 3 || got[0].Text != "b" || got[2].Text != "d" {
+		t.Errorf("got %v, want the three most recent messages", got)
+	}
+}
@@ -1,32 +1,69 @@
 package nw
 
 import (
-	"bufio"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	quic "github.com/quic-go/quic-go"
 )
 
-type Client[T any] struct {
+type Client[T any, I any] struct {
 	stream quic.Stream
 	// sendChan is used to send messages to the server
 	sendChan chan Message
 	// recvChan is used to receive messages from the server
 	// gameStateChan is used to game state from the server
 	gameStateChan chan ServerStateMessage[T]
+	// gameEvents are the game events not yet taken by the game loop
+	gameEvents chan GameEvent
 	// quitChan is used to signal the network handlers to stop
 	quitChan chan struct{}
 	// state is the client's state manager
-	state   ClientStateManager[T]
-	Lobbies LobbiesSync
-	lobby   *Lobby
-	// clientID is the client's ID determined by the server
+	state ClientStateManager[T, I]
+	// inputs are the inputs not acknowledged by the server yet
+	inputs *inputBatcher[I]
+	// lastTick is the tick of the last state received, it is written by the reader goroutine
+	lastTick atomic.Uint64
+	// inputSendRate is how often the inputs made in between are sent together, 0 sends every input right away
+	inputSendRate time.Duration
+	// events are the lobby changes not yet taken by the UI
+	events chan ClientEvent
+	// clientID is the client's ID determined by the server, it is set before the network handlers start
 	clientID string
+	// chat holds the most recent chat messages received from the server
+	chat *chatHistory
+	// mu guards the fields below, they are written by the reader goroutine and read by the UI every frame
+	mu      sync.RWMutex
+	lobbies LobbiesSync
+	lobby   *Lobby
+	// lobbyQuery is the query of the current lobby list subscription
+	lobbyQuery LobbyQuery
+	// matchmakeStatus is the last quick play status received from the server
+	matchmakeStatus *MatchmakeStatus
+	// profile is the client's profile as accepted by the server
+	profile Profile
+	// profileRejection is why the server refused the last profile change
+	profileRejection string
+	// kicked is the last kick from a lobby, nil if the client was never kicked
+	kicked *Kicked
+	// disconnectReason is why the server closed the connection, for instance a ban
+	disconnectReason string
+	// party is the party the client is in, nil outside of one
+	party *Party
+	// partyInvites are the invites received and not acted on yet
+	partyInvites []PartyInvite
+	// partyRejection is why the server refused the last party request
+	partyRejection string
 }
 
 type Lobby struct {
@@ -37,126 +74,605 @@ type Lobby struct {
 	MaxPlayers       int
 	Started          bool `json:"started"`
 	Countdown        int
+	// CountingDown is true while the start countdown runs
+	CountingDown bool
+	// CountdownCancelled is why the last start countdown was cancelled
+	CountdownCancelled string
+	// Spectating is true when the client joined the lobby to watch
+	Spectating bool
+	Settings   LobbySettings
+	// Results of the last match played in the lobby, nil until one ends
+	Results *GameOver
+	// Teams maps members to their team, it is empty in free for all lobbies
+	Teams  map[string]int
+	Paused bool
+	// ResumeCountdown is the number of seconds left before a paused match resumes, 0 if it is not resuming
+	ResumeCountdown int
+	// Modes are the game modes the lobby can switch to
+	Modes []string
+	// Vote is the open vote or the last one to end, nil before the first vote
+	Vote *VoteStatus
+	// VoteRejection is why the server refused the last vote this client called
+	VoteRejection string
 }
 type otherClient struct {
+	Profile Profile
 }
 
 type ClientOpts struct {
 	ServerAddress string
 	TLSConfig     *tls.Config
 	QuicConfig    *quic.Config
+	// Profile is sent to the server once connected, the zero value keeps the defaults
+	Profile Profile
+	// InputRedundancy is how many sent but unacknowledged inputs are repeated with every input message,
+	// 0 uses the default and a negative value turns the repetition off
+	InputRedundancy int
+	// InputSendRate is how often inputs are sent, all inputs made since the last send go in one message.
+	// 0 sends every input as soon as it is made
+	InputSendRate time.Duration
 }
 
 // NewClient creates a new client with the given state manager.
-func NewClient[T any](state ClientStateManager[T], co ClientOpts) *Client[T] {
-	c := &Client[T]{
+func NewClient[T any, I any](state ClientStateManager[T, I], co ClientOpts) *Client[T, I] {
+	c := &Client[T, I]{
 		sendChan:      make(chan Message),
 		gameStateChan: make(chan ServerStateMessage[T]),
+		gameEvents:    make(chan GameEvent, gameEventsBuffer),
 		quitChan:      make(chan struct{}),
 		state:         state,
+		inputs:        newInputBatcher[I](inputRedundancy(co.InputRedundancy)),
+		inputSendRate: co.InputSendRate,
+		events:        make(chan ClientEvent, clientEventsBuffer),
+		chat:          newChatHistory(chatHistorySize),
 	}
 	c.connectToServer(co)
 	c.waitUntilConnected()
 	c.startNetworkHandlers()
-	go func() {
-		for {
-
-			c.SyncLobbies()
-			time.Sleep(time.Second * 5)
-		}
-	}()
+	c.SubscribeLobbies(LobbyQuery{})
+	if co.Profile != (Profile{}) {
+		c.SetProfile(co.Profile)
+	}
 	return c
 }
 
-func (c *Client[T]) State() ClientStateManager[T] {
+func (c *Client[T, I]) State() ClientStateManager[T, I] {
 	return c.state
 }
 
-func (c *Client[T]) Lobby() *Lobby {
-	return c.lobby
+// Lobby returns a snapshot of the client's lobby, or nil outside of one.
+// The snapshot is never changed by the client, so it can be kept and read from any goroutine.
+func (c *Client[T, I]) Lobby() *Lobby {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lobby.clone()
+}
+
+// Lobbies returns a snapshot of the lobbies matching the current subscription query.
+func (c *Client[T, I]) Lobbies() LobbiesSync {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	sync := c.lobbies
+	sync.Lobbies = slices.Clone(sync.Lobbies)
+	return sync
 }
 
-func (c *Client[T]) makeClientInputMessage(input string) (Message, error) {
-	ci := ClientInput{
+// Events returns the changes to the client's lobby as they arrive from the server.
+// Events are dropped while the channel is full, Lobby always has the latest state.
+func (c *Client[T, I]) Events() <-chan ClientEvent {
+	return c.events
+}
+
+// emit hands ev to the UI without ever blocking the reader goroutine.
+func (c *Client[T, I]) emit(ev ClientEvent) {
+	select {
+	case c.events <- ev:
+	default:
+		log.Println("Dropping client event, events are not being read:", ev.Kind)
+	}
+}
+
+// currentLobby returns the ID of the client's lobby, ok is false outside of one.
+func (c *Client[T, I]) currentLobby() (lobbyID string, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.lobby == nil {
+		return "", false
+	}
+	return c.lobby.ID, true
+}
+
+func inputRedundancy(n int) int {
+	if n == 0 {
+		return defaultInputRedundancy
+	}
+	return n
+}
+
+// SendInputToServer sends input with the sequence number of the last input applied to the state,
+// right away or with the next batch when an input send rate is set.
+func (c *Client[T, I]) SendInputToServer(input I) {
+	if c.IsSpectating() || c.IsPaused() {
+		return
+	}
+	ci := ClientInput[I]{
 		ClientID: c.clientID,
 		Sequence: c.state.InputSeq(),
 		Input:    input,
+		ViewTick: c.lastTick.Load(),
+	}
+	if rd, ok := c.state.(RenderDelayer); ok {
+		ci.RenderDelay = rd.RenderDelay()
+	}
+	c.inputs.add(ci)
+	if c.inputSendRate == 0 {
+		if msg, ok := c.makeInputMessage(); ok {
+			c.sendChan <- msg
+		}
 	}
-	return NewClientInputMessage(FmtJSON, ci)
 }
 
-func (c *Client[T]) SendInputToServer(input string) {
-	fmt.Println("Sending input:", input)
-	msg, err := c.makeClientInputMessage(input)
+// makeInputMessage bundles the inputs not sent yet with the last unacknowledged ones, ok is false without new inputs.
+func (c *Client[T, I]) makeInputMessage() (Message, bool) {
+	batch, ok := c.inputs.next()
+	if !ok {
+		return Message{}, false
+	}
+	msg, err := NewClientInputMessage(FmtJSON, batch)
 	if err != nil {
 		log.Println("Error creating client input message:", err)
+		return Message{}, false
 	}
-	c.sendChan <- msg
+	return msg, true
 }
 
-func (c *Client[T]) CreateLobby() {
+func (c *Client[T, I]) CreateLobby() {
 	msg := NewMessage(MsgLobbyCreate, FmtText, []byte{})
 	c.sendChan <- msg
 }
 
-func (c *Client[T]) SyncLobbies() {
-	msg := NewMessage(MsgLobbiesSync, FmtText, []byte{})
+// SyncLobbies requests a one off snapshot of the lobbies matching the current subscription query.
+func (c *Client[T, I]) SyncLobbies() {
+	msg, err := NewLobbiesSyncMessage(FmtJSON, c.LobbyQuery())
+	if err != nil {
+		log.Println("Error creating lobbies sync message:", err)
+		return
+	}
 	fmt.Println("Syncing lobbies...")
 	c.sendChan <- msg
 }
 
-func (c *Client[T]) JoinLobby(lobbyID string) {
+// SubscribeLobbies replaces the lobby list subscription with q.
+// The server replies with a snapshot and then pushes changes to Lobbies as they happen.
+func (c *Client[T, I]) SubscribeLobbies(q LobbyQuery) {
+	msg, err := NewLobbiesSubscribeMessage(FmtJSON, q)
+	if err != nil {
+		log.Println("Error creating lobbies subscribe message:", err)
+		return
+	}
+	c.mu.Lock()
+	c.lobbyQuery = q
+	c.mu.Unlock()
+	c.sendChan <- msg
+}
+
+func (c *Client[T, I]) UnsubscribeLobbies() {
+	c.sendChan <- NewMessage(MsgLobbiesUnsubscribe, FmtText, []byte{})
+}
+
+// LobbyQuery returns the query of the current lobby list subscription.
+func (c *Client[T, I]) LobbyQuery() LobbyQuery {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lobbyQuery
+}
+
+// Matchmake puts the client in the server's quick play queue for a match of groupSize players.
+func (c *Client[T, I]) Matchmake(gameType string, groupSize int) {
+	msg, err := NewMatchmakeMessage(FmtJSON, MatchmakeRequest{GameType: gameType, GroupSize: groupSize})
+	if err != nil {
+		log.Println("Error creating matchmake message:", err)
+		return
+	}
+	fmt.Println("Queueing for a match...")
+	c.sendChan <- msg
+}
+
+func (c *Client[T, I]) CancelMatchmake() {
+	c.sendChan <- NewMessage(MsgMatchmakeCancel, FmtText, []byte{})
+}
+
+// MatchmakeStatus returns the last quick play status, or nil if the client never queued.
+func (c *Client[T, I]) MatchmakeStatus() *MatchmakeStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.matchmakeStatus == nil {
+		return nil
+	}
+	status := *c.matchmakeStatus
+	return &status
+}
+
+// applyLobbyEvent folds an incremental lobby event into lobbies, keeping it sorted by code.
+func (c *Client[T, I]) applyLobbyEvent(ev LobbyEvent) {
+	lobbies := c.lobbies.Lobbies
+	i := sort.Search(len(lobbies), func(i int) bool {
+		return lobbies[i].Code >= ev.Lobby.Code
+	})
+	found := i < len(lobbies) && lobbies[i].Code == ev.Lobby.Code
+	switch ev.Kind {
+	case LobbyAdded, LobbyUpdated:
+		if found {
+			lobbies[i] = ev.Lobby
+			return
+		}
+		lobbies = append(lobbies, LobbyView{})
+		copy(lobbies[i+1:], lobbies[i:])
+		lobbies[i] = ev.Lobby
+		c.lobbies.Total++
+	case LobbyRemoved:
+		if !found {
+			return
+		}
+		lobbies = append(lobbies[:i], lobbies[i+1:]...)
+		c.lobbies.Total--
+	}
+	c.lobbies.Lobbies = lobbies
+}
+
+// SendChat sends a chat message to the current lobby or, with ChatServer, to everyone on the server.
+func (c *Client[T, I]) SendChat(scope ChatScope, text string) {
+	cm := ChatMessage{
+		Scope: scope,
+		From:  c.clientID,
+		Text:  text,
+	}
+	if scope == ChatLobby {
+		lobbyID, ok := c.currentLobby()
+		if !ok {
+			log.Println("Not in a lobby, cannot send lobby chat")
+			return
+		}
+		cm.LobbyID = lobbyID
+	}
+	msg, err := NewChatMessage(FmtJSON, cm)
+	if err != nil {
+		log.Println("Error creating chat message:", err)
+		return
+	}
+	c.sendChan <- msg
+}
+
+// SetProfile asks the server to change the client's profile.
+// The name must be unique within the client's lobby, ProfileRejection reports why a change was refused.
+func (c *Client[T, I]) SetProfile(p Profile) {
+	msg, err := NewProfileMessage(FmtJSON, ProfileMessage{ClientID: c.clientID, Profile: p})
+	if err != nil {
+		log.Println("Error creating profile message:", err)
+		return
+	}
+	c.sendChan <- msg
+}
+
+// Profile returns the client's profile as last accepted by the server.
+func (c *Client[T, I]) Profile() Profile {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.profile
+}
+
+// ProfileRejection returns why the server refused the last profile change, or an empty string.
+func (c *Client[T, I]) ProfileRejection() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.profileRejection
+}
+
+// MemberProfile returns the profile of clientID if it is the client itself or a member of its lobby.
+func (c *Client[T, I]) MemberProfile(clientID string) (Profile, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if clientID == c.clientID {
+		return c.profile, true
+	}
+	if c.lobby == nil {
+		return Profile{}, false
+	}
+	member, ok := c.lobby.ConnectedClients[clientID]
+	return member.Profile, ok
+}
+
+// DisplayName returns the name clientID should be shown as.
+func (c *Client[T, I]) DisplayName(clientID string) string {
+	p, _ := c.MemberProfile(clientID)
+	return displayName(clientID, p)
+}
+
+// ChatHistory returns a copy of the most recent chat messages, oldest first.
+func (c *Client[T, I]) ChatHistory() []ChatMessage {
+	return c.chat.snapshot()
+}
+
+func (c *Client[T, I]) JoinLobby(lobbyID string) {
 	data := fmt.Sprintf("%s|%s", lobbyID, c.clientID)
 	msg := NewMessage(MsgLobbyClientJoin, FmtText, []byte(data))
 	fmt.Println("Joining lobby:", lobbyID)
 	c.sendChan <- msg
 }
 
-func (c *Client[T]) Start() {
+// Spectate joins a lobby as a spectator, the client receives state but cannot send inputs.
+func (c *Client[T, I]) Spectate(lobbyID string) {
+	data := fmt.Sprintf("%s|%s", lobbyID, c.clientID)
+	msg := NewMessage(MsgLobbySpectate, FmtText, []byte(data))
+	fmt.Println("Spectating lobby:", lobbyID)
+	c.sendChan <- msg
+}
+
+// UpdateLobbySettings asks the server to change the settings of the current lobby.
+// Only the lobby owner is allowed to do so.
+func (c *Client[T, I]) UpdateLobbySettings(settings LobbySettings) {
+	lobbyID, ok := c.currentLobby()
+	if !ok {
+		log.Println("Not in a lobby, cannot change settings")
+		return
+	}
+	msg, err := NewLobbySettingsMessage(FmtJSON, LobbySettingsMessage{LobbyID: lobbyID, Settings: settings})
+	if err != nil {
+		log.Println("Error creating lobby settings message:", err)
+		return
+	}
+	c.sendChan <- msg
+}
+
+// AssignTeam asks the server to move a member of the lobby to another team.
+// Only the lobby owner is allowed to do so.
+func (c *Client[T, I]) AssignTeam(clientID string, team int) {
+	lobbyID, ok := c.currentLobby()
+	if !ok {
+		log.Println("Not in a lobby, cannot assign teams")
+		return
+	}
+	msg, err := NewTeamAssignmentMessage(FmtJSON, TeamAssignment{LobbyID: lobbyID, ClientID: clientID, Team: team})
+	if err != nil {
+		log.Println("Error creating team assignment message:", err)
+		return
+	}
+	c.sendChan <- msg
+}
+
+// CallVote starts a vote in the lobby, target is the client to kick or the mode to switch to.
+// Any player can call a vote, it passes once a majority of the players vote yes.
+func (c *Client[T, I]) CallVote(voteType VoteType, target string) {
+	lobbyID, ok := c.currentLobby()
+	if !ok {
+		log.Println("Not in a lobby, cannot call a vote")
+		return
+	}
+	msg, err := NewVoteCallMessage(FmtJSON, VoteCall{LobbyID: lobbyID, Type: voteType, Target: target})
+	if err != nil {
+		log.Println("Error creating vote call message:", err)
+		return
+	}
+	c.sendChan <- msg
+}
+
+// CastVote answers the open vote of the lobby.
+func (c *Client[T, I]) CastVote(yes bool) {
+	lobby := c.Lobby()
+	if lobby == nil || lobby.Vote == nil || lobby.Vote.State != VoteOpen {
+		log.Println("No vote to cast a ballot in")
+		return
+	}
+	msg, err := NewVoteBallotMessage(FmtJSON, VoteBallot{LobbyID: lobby.ID, VoteID: lobby.Vote.ID, Yes: yes})
+	if err != nil {
+		log.Println("Error creating vote ballot message:", err)
+		return
+	}
+	c.sendChan <- msg
+}
+
+func (c *Client[T, I]) sendPartyRequest(h MessageHeader, pr PartyRequest) {
+	msg, err := NewPartyRequestMessage(FmtJSON, h, pr)
+	if err != nil {
+		log.Println("Error creating party message:", err)
+		return
+	}
+	c.sendChan <- msg
+}
+
+// CreateParty starts a party led by the client. When the leader joins a lobby or queues for matchmaking
+// the whole party comes along.
+func (c *Client[T, I]) CreateParty() {
+	c.sendPartyRequest(MsgPartyCreate, PartyRequest{})
+}
+
+// InviteToParty invites clientID to the party the client leads.
+func (c *Client[T, I]) InviteToParty(clientID string) {
+	c.sendPartyRequest(MsgPartyInvite, PartyRequest{ClientID: clientID})
+}
+
+// JoinParty accepts an invite to partyID.
+func (c *Client[T, I]) JoinParty(partyID string) {
+	c.DeclineParty(partyID)
+	c.sendPartyRequest(MsgPartyJoin, PartyRequest{PartyID: partyID})
+}
+
+// DeclineParty drops the invite to partyID.
+func (c *Client[T, I]) DeclineParty(partyID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.partyInvites = slices.DeleteFunc(c.partyInvites, func(pi PartyInvite) bool { return pi.PartyID == partyID })
+}
+
+// LeaveParty leaves the client's party, the longest standing member leads it if the leader leaves.
+func (c *Client[T, I]) LeaveParty() {
+	c.sendPartyRequest(MsgPartyLeave, PartyRequest{})
+}
+
+// Party returns the party the client is in, or nil.
+func (c *Client[T, I]) Party() *Party {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.party == nil {
+		return nil
+	}
+	p := *c.party
+	p.Members = slices.Clone(p.Members)
+	p.Invited = slices.Clone(p.Invited)
+	return &p
+}
+
+// PartyInvites returns the party invites the client has not accepted or declined.
+func (c *Client[T, I]) PartyInvites() []PartyInvite {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Clone(c.partyInvites)
+}
+
+// PartyRejection returns why the server refused the last party request, or an empty string.
+func (c *Client[T, I]) PartyRejection() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.partyRejection
+}
+
+// PauseGame asks the server to pause the running match, only the lobby owner is allowed to.
+func (c *Client[T, I]) PauseGame() {
+	c.sendChan <- NewMessage(MsgGamePause, FmtText, []byte{})
+}
+
+// ResumeGame asks the server to resume a paused match after the resume countdown.
+func (c *Client[T, I]) ResumeGame() {
+	c.sendChan <- NewMessage(MsgGameResume, FmtText, []byte{})
+}
+
+func (c *Client[T, I]) IsPaused() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lobby != nil && c.lobby.Paused
+}
+
+// IsSpectating reports whether the client is watching its current lobby.
+func (c *Client[T, I]) IsSpectating() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lobby != nil && c.lobby.Spectating
+}
+
+// Ready toggles the client's ready state in its lobby.
+func (c *Client[T, I]) Ready() {
+	lobbyID, ok := c.currentLobby()
+	if !ok {
+		log.Println("Not in a lobby, cannot ready up")
+		return
+	}
+	data := fmt.Sprintf("%s|%s", lobbyID, c.clientID)
+	c.sendChan <- NewMessage(MsgLobbyClientReady, FmtText, []byte(data))
+}
+
+func (c *Client[T, I]) Start() {
 	msg := NewMessage(MsgLobbyGameStart, FmtText, []byte{})
 	fmt.Println("Starting game...")
 	c.sendChan <- msg
 }
 
-func (c *Client[T]) LeaveLobby() {
-	msg := NewMessage(MsgLobbyClientLeave, FmtText, []byte(c.clientID))
-	fmt.Println("Leaving lobby:", c.lobby.ID)
+func (c *Client[T, I]) LeaveLobby() {
+	lobbyID, ok := c.currentLobby()
+	if !ok {
+		log.Println("Not in a lobby, cannot leave")
+		return
+	}
+	msg := NewLobbyLeaveMessage(FmtText, lobbyID, c.clientID)
+	fmt.Println("Leaving lobby:", lobbyID)
 	c.sendChan <- msg
 }
 
-func (c *Client[T]) KickFromLobby(clientID string) {
-	msg := NewMessage(MsgLobbyKick, FmtText, []byte(clientID))
+// KickFromLobby removes clientID from the lobby and keeps it out for a while, reason is shown to the kicked client.
+// Only the lobby owner and server moderators can kick.
+func (c *Client[T, I]) KickFromLobby(clientID, reason string) {
+	lobbyID, ok := c.currentLobby()
+	if !ok {
+		log.Println("Not in a lobby, cannot kick")
+		return
+	}
+	msg, err := NewKickRequestMessage(FmtJSON, KickRequest{LobbyID: lobbyID, ClientID: clientID, Reason: reason})
+	if err != nil {
+		log.Println("Error creating kick message:", err)
+		return
+	}
 	fmt.Println("Kicking client from lobby:", clientID)
 	c.sendChan <- msg
 }
 
-func (c Client[T]) IsStarted() bool {
+// Kicked returns the last kick from a lobby, or nil if the client was never kicked.
+func (c *Client[T, I]) Kicked() *Kicked {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.kicked == nil {
+		return nil
+	}
+	k := *c.kicked
+	return &k
+}
+
+// DisconnectReason returns why the server closed the connection, or an empty string.
+func (c *Client[T, I]) DisconnectReason() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.disconnectReason
+}
+
+// noteDisconnect records the reason the server gave for closing the connection, if it gave one.
+func (c *Client[T, I]) noteDisconnect(err error) {
+	var appErr *quic.ApplicationError
+	if errors.As(err, &appErr) && appErr.Remote {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.disconnectReason = appErr.ErrorMessage
+	}
+}
+
+func (c *Client[T, I]) IsStarted() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if c.lobby == nil {
 		return false
 	}
 	return c.lobby.Started
 }
 
-func (c *Client[T]) Promote(clientID string) {
-	msg := NewMessage(MsgLobbyPromote, FmtText, []byte(clientID))
+func (c *Client[T, I]) Promote(clientID string) {
+	lobbyID, ok := c.currentLobby()
+	if !ok {
+		log.Println("Not in a lobby, cannot promote")
+		return
+	}
+	data := fmt.Sprintf("%s|%s", lobbyID, clientID)
+	msg := NewMessage(MsgLobbyPromote, FmtText, []byte(data))
 	fmt.Println("Promoting client to host:", clientID)
 	c.sendChan <- msg
 }
 
-func (c *Client[T]) RecvFromServer() <-chan ServerStateMessage[T] {
+func (c *Client[T, I]) RecvFromServer() <-chan ServerStateMessage[T] {
 	return c.gameStateChan
 }
 
-func (c *Client[T]) QuitChan() <-chan struct{} {
+// GameEvents returns the events of the match, like deaths and pickups, in the order they happened.
+// Events are dropped while the channel is full.
+func (c *Client[T, I]) GameEvents() <-chan GameEvent {
+	return c.gameEvents
+}
+
+func (c *Client[T, I]) QuitChan() <-chan struct{} {
 	return c.quitChan
 }
 
-func (c *Client[T]) ClientID() string {
+func (c *Client[T, I]) ClientID() string {
 	return c.clientID
 }
 
 // connectToServer establishes a QUIC connection to the server.
-func (c *Client[T]) connectToServer(co ClientOpts) {
+func (c *Client[T, I]) connectToServer(co ClientOpts) {
 	if co.ServerAddress == "" {
 		co.ServerAddress = "localhost:4242"
 	}
@@ -166,7 +682,7 @@ func (c *Client[T]) connectToServer(co ClientOpts) {
 			NextProtos:         []string{"snake-game"},
 		}
 	}
-	session, err := quic.DialAddr(context.Background(), co.ServerAddress, co.TLSConfig, nil)
+	session, err := quic.DialAddr(context.Background(), co.ServerAddress, co.TLSConfig, co.QuicConfig)
 	if err != nil {
 		log.Fatal("Failed to connect to server:", err)
 	}
@@ -181,7 +697,13 @@ func (c *Client[T]) connectToServer(co ClientOpts) {
 	}
 }
 
-func (c *Client[T]) writer() {
+func (c *Client[T, I]) writer() {
+	var sendInputs <-chan time.Time
+	if c.inputSendRate > 0 {
+		ticker := time.NewTicker(c.inputSendRate)
+		defer ticker.Stop()
+		sendInputs = ticker.C
+	}
 	for {
 		select {
 		case msg := <-c.sendChan:
@@ -189,37 +711,46 @@ func (c *Client[T]) writer() {
 				log.Println("Error sending message to server:", err)
 				return
 			}
+		case <-sendInputs:
+			msg, ok := c.makeInputMessage()
+			if !ok {
+				continue
+			}
+			if err := msg.EncodeTo(c.stream); err != nil {
+				log.Println("Error sending message to server:", err)
+				return
+			}
 		case <-c.quitChan:
 			return
 		}
 	}
 }
 
-func (c *Client[T]) reader(mh MessageHandler) {
+func (c *Client[T, I]) reader(mh MessageHandler) {
 	defer func() {
 		c.quitChan <- struct{}{}
 	}()
-	reader := bufio.NewReader(c.stream)
 	for {
 		var msg Message
-		if err := msg.DecodeFrom(reader); err != nil {
+		if err := msg.DecodeFrom(c.stream); err != nil {
 			log.Println("error decoding message:", err)
+			c.noteDisconnect(err)
 			return
 		}
 		mh.Handle(msg)
 	}
 }
 
-func (c *Client[T]) waitUntilConnected() {
+func (c *Client[T, I]) waitUntilConnected() {
 	fmt.Println("Waiting for client ID...")
-	reader := bufio.NewReader(c.stream)
 	for {
 		if c.clientID != "" {
 			return
 		}
 		var connectMsg Message
-		if err := connectMsg.DecodeFrom(reader); err != nil {
+		if err := connectMsg.DecodeFrom(c.stream); err != nil {
 			log.Println("Error decoding connect message:", err)
+			c.noteDisconnect(err)
 			return
 		}
 		clientId := string(connectMsg.data.Data)
@@ -229,74 +760,338 @@ func (c *Client[T]) waitUntilConnected() {
 	}
 }
 
-func (c *Client[T]) startNetworkHandlers() {
+func (c *Client[T, I]) startNetworkHandlers() {
 	go c.writer()
-	go c.reader(MessageHandlerFunc(func(msg Message) error {
-		switch msg.header {
-		case MsgLobbyCreated:
-			lobbyID := string(msg.data.Data)
-			fmt.Println("Lobby created:", lobbyID)
+	go c.reader(MessageHandlerFunc(c.handleMessage))
+}
+
+// handleMessage applies a message from the server, it runs on the reader goroutine.
+func (c *Client[T, I]) handleMessage(msg Message) error {
+	if msg.header == MsgServerState {
+		// the state is handed over unlocked, the game loop may take a while to receive it
+		ssm, err := ServerStateMessageFromMessage[T](msg)
+		if err != nil {
+			fmt.Println("Error decoding server state message:", err)
+			return nil
+		}
+		c.inputs.acknowledge(ssm.AcknowledgedSeq[c.clientID])
+		c.lastTick.Store(ssm.Tick)
+		c.gameStateChan <- ssm
+		return nil
+	}
+	if msg.header == MsgGameEvent {
+		events, err := GameEventsFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			select {
+			case c.gameEvents <- ev:
+			default:
+				fmt.Println("Dropping game event, the game is not taking them:", ev.Kind)
+			}
+		}
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch msg.header {
+	case MsgLobbyCreated:
+		lobbyID := string(msg.data.Data)
+		fmt.Println("Lobby created:", lobbyID)
+		// the join broadcast for the owner may arrive first
+		if c.lobby == nil || c.lobby.ID != lobbyID {
 			c.lobby = &Lobby{
 				ID:               lobbyID,
 				ReadyClients:     make(map[string]bool),
 				ConnectedClients: make(map[string]otherClient),
 				Countdown:        10,
 			}
-		case MsgLobbiesSynced:
-			fmt.Println("Lobbies synced")
-			if err := json.Unmarshal(msg.data.Data, &c.Lobbies); err != nil {
-				fmt.Println("Error decoding lobbies sync message:", err)
-			}
-		case MsgServerState:
-			msg, err := ServerStateMessageFromMessage[T](msg)
-			if err != nil {
-				fmt.Println("Error decoding server state message:", err)
+		}
+		c.lobby.OwnerClientID = c.clientID
+	case MsgLobbyEvent:
+		ev, err := LobbyEventFromMessage(msg)
+		if err != nil {
+			fmt.Println("Error decoding lobby event:", err)
+			return nil
+		}
+		c.applyLobbyEvent(ev)
+	case MsgMatchmakeStatus:
+		var status MatchmakeStatus
+		if err := json.Unmarshal(msg.data.Data, &status); err != nil {
+			fmt.Println("Error decoding matchmake status:", err)
+			return nil
+		}
+		c.matchmakeStatus = &status
+	case MsgLobbiesSynced:
+		fmt.Println("Lobbies synced")
+		if err := json.Unmarshal(msg.data.Data, &c.lobbies); err != nil {
+			fmt.Println("Error decoding lobbies sync message:", err)
+		}
+	case MsgLobbyClientJoin:
+		parts := strings.Split(string(msg.data.Data), "|")
+		if len(parts) != 2 {
+			fmt.Println("Invalid lobby join message:", msg)
+			return nil
+		}
+		lobbyID, clientID := parts[0], parts[1]
+		fmt.Println("Client joined lobby:", clientID)
+		switch {
+		case clientID == c.clientID && (c.lobby == nil || c.lobby.ID != lobbyID):
+			// the join can arrive before the leave of the lobby the client moved on from, the new lobby replaces it
+			if c.lobby != nil {
+				c.state.SetPaused(false)
 			}
-			c.gameStateChan <- msg
-		case MsgLobbyClientJoin:
-			clientID := string(msg.data.Data)
-			fmt.Println("Client joined lobby:", clientID)
-			if c.lobby == nil {
-				c.lobby = &Lobby{
-					OwnerClientID:    c.clientID,
-					ReadyClients:     make(map[string]bool),
-					ConnectedClients: make(map[string]otherClient),
-					Countdown:        10,
-				}
+			c.lobby = &Lobby{
+				ID:               lobbyID,
+				ReadyClients:     make(map[string]bool),
+				ConnectedClients: make(map[string]otherClient),
+				Countdown:        10,
 			}
+		case c.lobby == nil || c.lobby.ID != lobbyID:
+			// joins to a lobby the client is not in are stale
+			return nil
+		}
+		if _, ok := c.lobby.ConnectedClients[clientID]; !ok {
 			c.lobby.ConnectedClients[clientID] = otherClient{}
-			c.lobby.ReadyClients[clientID] = false
-		case MsgLobbyPromote:
-			clientID := string(msg.data.Data)
-			fmt.Println("Client promoted to host:", clientID)
-			c.lobby.OwnerClientID = clientID
-		case MsgLobbyClientLeave, MsgLobbyKick:
-			clientID := string(msg.data.Data)
-			fmt.Println("Client left lobby:", clientID)
-			delete(c.lobby.ConnectedClients, clientID)
-			if c.clientID == clientID {
-				c.lobby = nil
+		}
+		c.lobby.ReadyClients[clientID] = false
+		c.emit(ClientEvent{Kind: EventLobbyJoined, LobbyID: lobbyID, ClientID: clientID})
+	case MsgLobbySettings:
+		lsm, err := LobbySettingsMessageFromMessage(msg)
+		if err != nil {
+			fmt.Println("Error decoding lobby settings:", err)
+			return nil
+		}
+		if c.lobby != nil && c.lobby.ID == lsm.LobbyID {
+			c.lobby.Settings = lsm.Settings
+			c.lobby.Modes = lsm.Modes
+		}
+	case MsgPartySync:
+		p, err := PartySyncFromMessage(msg)
+		if err != nil {
+			fmt.Println("Error decoding party sync message:", err)
+			return nil
+		}
+		c.partyRejection = ""
+		if p.ID == "" {
+			c.party = nil
+			return nil
+		}
+		c.party = &p
+	case MsgPartyInvite:
+		pi, err := PartyInviteFromMessage(msg)
+		if err != nil {
+			fmt.Println("Error decoding party invite message:", err)
+			return nil
+		}
+		fmt.Println("Invited to party by:", pi.FromName)
+		c.partyInvites = append(c.partyInvites, pi)
+	case MsgPartyRejected:
+		c.partyRejection = string(msg.data.Data)
+		fmt.Println("Party request rejected:", c.partyRejection)
+	case MsgVoteStatus:
+		vs, err := VoteStatusFromMessage(msg)
+		if err != nil {
+			fmt.Println("Error decoding vote status message:", err)
+			return nil
+		}
+		if c.lobby == nil || c.lobby.ID != vs.LobbyID {
+			return nil
+		}
+		if vs.State == VoteRejected {
+			c.lobby.VoteRejection = vs.Reason
+			return nil
+		}
+		c.lobby.Vote = &vs
+	case MsgLobbyJoinRejected:
+		fmt.Println("Lobby join rejected:", string(msg.data.Data))
+	case MsgLobbySpectate:
+		parts := strings.Split(string(msg.data.Data), "|")
+		if len(parts) != 2 {
+			fmt.Println("Invalid lobby spectate message:", msg)
+			return nil
+		}
+		fmt.Println("Spectating lobby:", parts[0])
+		c.lobby = &Lobby{
+			ID:               parts[0],
+			ReadyClients:     make(map[string]bool),
+			ConnectedClients: make(map[string]otherClient),
+			Countdown:        10,
+			Spectating:       true,
+		}
+		c.emit(ClientEvent{Kind: EventLobbyJoined, LobbyID: parts[0], ClientID: c.clientID})
+	case MsgLobbyPromoted:
+		parts := strings.Split(string(msg.data.Data), "|")
+		if len(parts) != 2 {
+			fmt.Println("Invalid lobby promoted message:", msg)
+			return nil
+		}
+		if c.lobby == nil || c.lobby.ID != parts[0] {
+			return nil
+		}
+		fmt.Println("Client promoted to host:", parts[1])
+		c.lobby.OwnerClientID = parts[1]
+		c.emit(ClientEvent{Kind: EventPromoted, LobbyID: parts[0], ClientID: parts[1]})
+	case MsgLobbyKicked:
+		k, err := KickedFromMessage(msg)
+		if err != nil {
+			fmt.Println("Error decoding kicked message:", err)
+			return nil
+		}
+		fmt.Println("Kicked from lobby:", k.LobbyID, k.Reason)
+		c.kicked = &k
+		c.emit(ClientEvent{Kind: EventKicked, LobbyID: k.LobbyID, ClientID: c.clientID, Reason: k.Reason})
+	case MsgLobbyClientLeave:
+		parts := strings.Split(string(msg.data.Data), "|")
+		if len(parts) != 2 {
+			fmt.Println("Invalid lobby leave message:", msg)
+			return nil
+		}
+		clientID := parts[1]
+		fmt.Println("Client left lobby:", clientID)
+		// leaves from a lobby the client already moved on from are stale
+		if c.lobby == nil || c.lobby.ID != parts[0] {
+			return nil
+		}
+		delete(c.lobby.ConnectedClients, clientID)
+		delete(c.lobby.ReadyClients, clientID)
+		delete(c.lobby.Teams, clientID)
+		if c.clientID == clientID {
+			c.lobby = nil
+			c.state.SetPaused(false)
+		}
+		c.emit(ClientEvent{Kind: EventLobbyLeft, LobbyID: parts[0], ClientID: clientID})
+	case MsgLobbyClientReady:
+		if c.lobby == nil {
+			return nil
+		}
+		clientID := string(msg.data.Data)
+		fmt.Println("Client ready:", clientID)
+		c.lobby.ReadyClients[clientID] = !c.lobby.ReadyClients[clientID]
+		c.emit(ClientEvent{Kind: EventReadyToggled, LobbyID: c.lobby.ID, ClientID: clientID, Ready: c.lobby.ReadyClients[clientID]})
+	case MsgChat:
+		cm, err := ChatMessageFromMessage(msg)
+		if err != nil {
+			fmt.Println("Error decoding chat message:", err)
+			return nil
+		}
+		c.chat.add(cm)
+	case MsgLobbyGameStarted:
+		type countdownMsg struct {
+			Countdown int `json:"countdown"`
+		}
+		if c.lobby == nil {
+			return nil
+		}
+		switch msg.data.Fmt {
+		case FmtText:
+			c.lobby.Started = true
+			c.lobby.CountingDown = false
+			c.lobby.Results = nil
+			// the server starts acknowledging anew, inputs of the last match must not leak into this one
+			c.inputs.reset()
+			c.emit(ClientEvent{Kind: EventGameStarted, LobbyID: c.lobby.ID})
+		case FmtJSON:
+			var cm countdownMsg
+			if err := json.Unmarshal(msg.data.Data, &cm); err != nil {
+				fmt.Println("Error decoding countdown message:", err)
 			}
-		case MsgLobbyClientReady:
-			clientID := string(msg.data.Data)
-			fmt.Println("Client ready:", clientID)
-			c.lobby.ReadyClients[clientID] = !c.lobby.ReadyClients[clientID]
-		case MsgLobbyGameStarted:
-			type countdownMsg struct {
+			c.lobby.Countdown = cm.Countdown
+			c.lobby.CountingDown = true
+			c.lobby.CountdownCancelled = ""
+			c.emit(ClientEvent{Kind: EventCountdown, LobbyID: c.lobby.ID, Countdown: cm.Countdown})
+		}
+	case MsgLobbyCountdownCancelled:
+		if c.lobby == nil {
+			return nil
+		}
+		fmt.Println("Countdown cancelled:", string(msg.data.Data))
+		c.lobby.CountingDown = false
+		c.lobby.CountdownCancelled = string(msg.data.Data)
+		c.emit(ClientEvent{Kind: EventCountdown, LobbyID: c.lobby.ID, Reason: c.lobby.CountdownCancelled})
+	case MsgProfile:
+		pm, err := ProfileMessageFromMessage(msg)
+		if err != nil {
+			fmt.Println("Error decoding profile message:", err)
+			return nil
+		}
+		if pm.ClientID == c.clientID {
+			c.profile = pm.Profile
+			c.profileRejection = ""
+		}
+		if c.lobby == nil {
+			return nil
+		}
+		if _, ok := c.lobby.ConnectedClients[pm.ClientID]; ok {
+			c.lobby.ConnectedClients[pm.ClientID] = otherClient{Profile: pm.Profile}
+		}
+	case MsgLobbyTeam:
+		ta, err := TeamAssignmentFromMessage(msg)
+		if err != nil {
+			fmt.Println("Error decoding team assignment:", err)
+			return nil
+		}
+		if c.lobby == nil || c.lobby.ID != ta.LobbyID {
+			return nil
+		}
+		if c.lobby.Teams == nil {
+			c.lobby.Teams = make(map[string]int)
+		}
+		if ta.Team == 0 {
+			delete(c.lobby.Teams, ta.ClientID)
+			return nil
+		}
+		c.lobby.Teams[ta.ClientID] = ta.Team
+	case MsgProfileRejected:
+		c.profileRejection = string(msg.data.Data)
+		fmt.Println("Profile rejected:", c.profileRejection)
+	case MsgGamePause:
+		if c.lobby == nil {
+			return nil
+		}
+		fmt.Println("Game paused")
+		c.lobby.Paused = true
+		c.lobby.ResumeCountdown = 0
+		c.state.SetPaused(true)
+	case MsgGameResume:
+		if c.lobby == nil {
+			return nil
+		}
+		switch msg.data.Fmt {
+		case FmtText:
+			fmt.Println("Game resumed")
+			c.lobby.Paused = false
+			c.lobby.ResumeCountdown = 0
+			c.state.SetPaused(false)
+		case FmtJSON:
+			var cm struct {
 				Countdown int `json:"countdown"`
 			}
-			switch msg.data.Fmt {
-			case FmtText:
-				c.lobby.Started = true
-			case FmtJSON:
-				var cm countdownMsg
-				if err := json.Unmarshal(msg.data.Data, &cm); err != nil {
-					fmt.Println("Error decoding countdown message:", err)
-				}
-				c.lobby.Countdown = cm.Countdown
+			if err := json.Unmarshal(msg.data.Data, &cm); err != nil {
+				fmt.Println("Error decoding resume countdown:", err)
+				return nil
 			}
+			c.lobby.ResumeCountdown = cm.Countdown
+		}
+	case MsgGameOver:
+		over, err := GameOverFromMessage(msg)
+		if err != nil {
+			fmt.Println("Error decoding game over message:", err)
+			return nil
 		}
+		if c.lobby == nil || c.lobby.ID != over.LobbyID {
+			return nil
+		}
+		fmt.Println("Game over:", over.Reason)
+		c.lobby.Started = false
+		c.lobby.Paused = false
+		c.lobby.ResumeCountdown = 0
+		c.state.SetPaused(false)
+		c.lobby.ReadyClients = make(map[string]bool)
+		c.lobby.Results = &over
+	}
 
-		return nil
-	}))
+	return nil
 }
@@ -0,0 +1,66 @@
+package nw
+
+import (
+	"maps"
+	"slices"
+)
+
+// clientEventsBuffer is how many events a client keeps for a UI that has not caught up,
+// newer events are dropped once it is full.
+const clientEventsBuffer = 64
+
+type ClientEventKind uint8
+
+const (
+	// EventLobbyJoined is sent when a player, the client included, joins the client's lobby
+	EventLobbyJoined ClientEventKind = iota
+	// EventLobbyLeft is sent when a player leaves the client's lobby, ClientID is the client itself when it left
+	EventLobbyLeft
+	// EventKicked is sent when the client was kicked from its lobby
+	EventKicked
+	// EventPromoted is sent when ClientID became the owner of the lobby
+	EventPromoted
+	// EventReadyToggled is sent when ClientID toggled its ready state
+	EventReadyToggled
+	// EventCountdown is sent every second of the start countdown and, with Reason set, when it is cancelled
+	EventCountdown
+	// EventGameStarted is sent when the match starts
+	EventGameStarted
+)
+
+// ClientEvent is a change to the client's lobby, received from Client.Events.
+type ClientEvent struct {
+	Kind    ClientEventKind
+	LobbyID string
+	// ClientID is the player the event is about, empty for events about the whole lobby
+	ClientID string
+	// Ready is the new ready state of ClientID for EventReadyToggled
+	Ready bool
+	// Countdown is the number of seconds left for EventCountdown
+	Countdown int
+	// Reason is why the client was kicked or the countdown cancelled
+	Reason string
+}
+
+// clone returns a deep copy of the lobby that does not change when l does.
+func (l *Lobby) clone() *Lobby {
+	if l == nil {
+		return nil
+	}
+	lc := *l
+	lc.ReadyClients = maps.Clone(l.ReadyClients)
+	lc.ConnectedClients = maps.Clone(l.ConnectedClients)
+	lc.Teams = maps.Clone(l.Teams)
+	lc.Modes = slices.Clone(l.Modes)
+	if l.Results != nil {
+		results := *l.Results
+		results.Results = slices.Clone(l.Results.Results)
+		results.Teams = slices.Clone(l.Results.Teams)
+		lc.Results = &results
+	}
+	if l.Vote != nil {
+		vote := *l.Vote
+		lc.Vote = &vote
+	}
+	return &lc
+}
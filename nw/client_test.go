@@ -0,0 +1,160 @@
+package nw
+
+import (
+	"reflect"
+	"testing"
+)
+
+// nopClientState is a ClientStateManager that ignores everything.
+type nopClientState struct{}
+
+func (nopClientState) Update(dt float64)                          {}
+func (nopClientState) ReconcileState(msg ServerStateMessage[int]) {}
+func (nopClientState) UpdateLocal(input string)                   {}
+func (nopClientState) InputSeq() uint32                           { return 0 }
+func (nopClientState) GetCurrent() int                            { return 0 }
+func (nopClientState) GetTarget() *int                            { return nil }
+func (nopClientState) SetClientID(string)                         {}
+func (nopClientState) ClientID() string                           { return "" }
+func (nopClientState) SetPaused(paused bool)                      {}
+
+// newTestGameClient returns a client that is not connected, messages are fed to it with handleMessage.
+func newTestGameClient(clientID string) *Client[int, string] {
+	return &Client[int, string]{
+		clientID:   clientID,
+		state:      nopClientState{},
+		inputs:     newInputBatcher[string](defaultInputRedundancy),
+		events:     make(chan ClientEvent, clientEventsBuffer),
+		gameEvents: make(chan GameEvent, gameEventsBuffer),
+		chat:       newChatHistory(chatHistorySize),
+	}
+}
+
+func TestClientEvents(t *testing.T) {
+	c := newTestGameClient("me")
+	kicked, err := NewKickedMessage(FmtJSON, Kicked{LobbyID: "L1", Reason: "afk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []Message{
+		NewMessage(MsgLobbyClientJoin, FmtText, []byte("L1|me")),
+		NewMessage(MsgLobbyClientJoin, FmtText, []byte("L1|other")),
+		NewMessage(MsgLobbyClientReady, FmtText, []byte("other")),
+		NewMessage(MsgLobbyPromoted, FmtText, []byte("L1|other")),
+		NewMessage(MsgLobbyGameStarted, FmtJSON, []byte(`{"countdown":3}`)),
+		NewMessage(MsgLobbyCountdownCancelled, FmtText, []byte("other is no longer ready")),
+		NewMessage(MsgLobbyGameStarted, FmtText, []byte{}),
+		// stale leaves from another lobby are ignored
+		NewLobbyLeaveMessage(FmtText, "L0", "other"),
+		NewLobbyLeaveMessage(FmtText, "L1", "other"),
+		kicked,
+		NewLobbyLeaveMessage(FmtText, "L1", "me"),
+	}
+	for _, msg := range msgs {
+		if err := c.handleMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []ClientEvent{
+		{Kind: EventLobbyJoined, LobbyID: "L1", ClientID: "me"},
+		{Kind: EventLobbyJoined, LobbyID: "L1", ClientID: "other"},
+		{Kind: EventReadyToggled, LobbyID: "L1", ClientID: "other", Ready: true},
+		{Kind: EventPromoted, LobbyID: "L1", ClientID: "other"},
+		{Kind: EventCountdown, LobbyID: "L1", Countdown: 3},
+		{Kind: EventCountdown, LobbyID: "L1", Reason: "other is no longer ready"},
+		{Kind: EventGameStarted, LobbyID: "L1"},
+		{Kind: EventLobbyLeft, LobbyID: "L1", ClientID: "other"},
+		{Kind: EventKicked, LobbyID: "L1", ClientID: "me", Reason: "afk"},
+		{Kind: EventLobbyLeft, LobbyID: "L1", ClientID: "me"},
+	}
+	var got []ClientEvent
+	for len(c.Events()) > 0 {
+		got = append(got, <-c.Events())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if c.Lobby() != nil {
+		t.Errorf("still in lobby %+v after leaving", c.Lobby())
+	}
+}
+
+func TestClientLobbySnapshot(t *testing.T) {
+	c := newTestGameClient("me")
+	c.handleMessage(NewMessage(MsgLobbyClientJoin, FmtText, []byte("L1|me")))
+	snapshot := c.Lobby()
+
+	c.handleMessage(NewMessage(MsgLobbyClientJoin, FmtText, []byte("L1|other")))
+	c.handleMessage(NewMessage(MsgLobbyClientReady, FmtText, []byte("me")))
+	if len(snapshot.ConnectedClients) != 1 || snapshot.ReadyClients["me"] {
+		t.Errorf("snapshot changed with the lobby: %+v", snapshot)
+	}
+	if lobby := c.Lobby(); len(lobby.ConnectedClients) != 2 || !lobby.ReadyClients["me"] {
+		t.Errorf("got %+v, want both members with me ready", lobby)
+	}
+}
+
+func TestClientJoinBeforeLeave(t *testing.T) {
+	c := newTestGameClient("me")
+	msgs := []Message{
+		NewMessage(MsgLobbyClientJoin, FmtText, []byte("L1|me")),
+		NewMessage(MsgLobbyClientJoin, FmtText, []byte("L1|other")),
+		// the new lobby's join overtakes the old lobby's leave
+		NewMessage(MsgLobbyClientJoin, FmtText, []byte("L2|me")),
+		NewMessage(MsgLobbyClientJoin, FmtText, []byte("L1|late")),
+		NewMessage(MsgLobbyClientLeave, FmtText, []byte("L1|me")),
+	}
+	for _, msg := range msgs {
+		if err := c.handleMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lobby := c.Lobby()
+	if lobby == nil || lobby.ID != "L2" {
+		t.Fatalf("got lobby %+v, want L2", lobby)
+	}
+	if _, ok := lobby.ConnectedClients["me"]; !ok || len(lobby.ConnectedClients) != 1 {
+		t.Errorf("got members %v, want only me", lobby.ConnectedClients)
+	}
+}
+
+func TestClientEventsDropWhenFull(t *testing.T) {
+	c := newTestGameClient("me")
+	c.handleMessage(NewMessage(MsgLobbyClientJoin, FmtText, []byte("L1|me")))
+	for i := 0; i < clientEventsBuffer*2; i++ {
+		c.handleMessage(NewMessage(MsgLobbyClientReady, FmtText, []byte("me")))
+	}
+	if n := len(c.Events()); n != clientEventsBuffer {
+		t.Errorf("got %d buffered events, want %d", n, clientEventsBuffer)
+	}
+	// the lobby keeps up even when the events do not
+	if c.Lobby().ReadyClients["me"] {
+		t.Errorf("got me ready after an even number of toggles")
+	}
+}
+
+func TestClientGameEvents(t *testing.T) {
+	c := newTestGameClient("me")
+	want := []GameEvent{
+		{Tick: 7, Kind: GameEventKill, ClientID: "me", OtherID: "other"},
+		{Tick: 7, Kind: GameEventDeath, ClientID: "other", OtherID: "me"},
+	}
+	msg, err := NewGameEventMessage(FmtJSON, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.handleMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range want {
+		select {
+		case got := <-c.GameEvents():
+			if got != w {
+				t.Errorf("got %+v, want %+v", got, w)
+			}
+		default:
+			t.Fatalf("got no event, want %+v", w)
+		}
+	}
+}
@@ -5,4 +5,26 @@ import "time"
 const (
 	address      = "localhost:4242"
 	gameInterval = time.Second / 30 // 30 ticks per second
+	// defaultMaxCatchUpTicks is how many late ticks a lobby runs back to back before it skips ahead
+	defaultMaxCatchUpTicks = 5
+	// tickStatsWindow is the number of recent ticks the tick timing percentiles are taken over
+	tickStatsWindow = 300
+	// defaultCountdown is the number of seconds between the owner starting and the first game tick
+	defaultCountdown = 10
+	// defaultResumeCountdown is the number of seconds between the owner resuming and the game ticking again
+	defaultResumeCountdown = 3
+	// defaultKickBanDuration is how long a kicked client cannot rejoin the lobby it was kicked from
+	defaultKickBanDuration = 5 * time.Minute
+	// defaultVoteTimeout is how long lobby members have to vote
+	defaultVoteTimeout = 30 * time.Second
+	// defaultVoteThreshold is the share of eligible voters that has to be exceeded for a vote to pass
+	defaultVoteThreshold = 0.5
+	// defaultMaxClients is the lobby size used when none is configured
+	defaultMaxClients = 8
+	// clientSendBuffer bounds how many messages can queue up for a client's writer
+	clientSendBuffer = 256
+	// clientInputsBuffer bounds how many input messages can queue up for a lobby
+	clientInputsBuffer = 64
+	// defaultInputRedundancy is how many unacknowledged inputs a client repeats with every input message
+	defaultInputRedundancy = 4
 )
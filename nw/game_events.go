@@ -0,0 +1,73 @@
+package nw
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// gameEventsBuffer is how many game events a client keeps for a game loop that has not caught up
+const gameEventsBuffer = 256
+
+// GameEventKind tells what a game event is about, games may define kinds of their own.
+type GameEventKind string
+
+const (
+	// GameEventDeath is a player's entity dying, OtherID is the killer if there is one
+	GameEventDeath GameEventKind = "death"
+	// GameEventKill is a player killing another one, OtherID is the victim
+	GameEventKill GameEventKind = "kill"
+	// GameEventPickup is a player picking something up, Value is how much
+	GameEventPickup GameEventKind = "pickup"
+	// GameEventScore is a player's score changing, Value is the new score
+	GameEventScore GameEventKind = "score"
+)
+
+// GameEvent is something that happened in a game tick, sent to clients so they can react to it
+// right away instead of finding it by comparing states.
+type GameEvent struct {
+	// Tick is the tick the event happened on, it is filled in by the lobby
+	Tick     uint64        `json:"tick"`
+	Kind     GameEventKind `json:"kind"`
+	ClientID string        `json:"clientID,omitempty"`
+	OtherID  string        `json:"otherID,omitempty"`
+	Value    int           `json:"value,omitempty"`
+}
+
+// GameEventEmitter is implemented by states that report what happened during Update,
+// the lobby takes the events after every tick and sends them to the players and spectators.
+type GameEventEmitter interface {
+	// TakeEvents returns the events since the last call and forgets them
+	TakeEvents() []GameEvent
+}
+
+func NewGameEventMessage(f MessageFmt, events []GameEvent) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(events)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgGameEvent, f, data), nil
+}
+
+func GameEventsFromMessage(m Message) ([]GameEvent, error) {
+	var events []GameEvent
+	if m.header != MsgGameEvent {
+		return nil, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &events); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported message format")
+	}
+	return events, nil
+}
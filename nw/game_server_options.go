@@ -1,3 +1,125 @@
 package nw
 
-type GameServerOption[T any] func(*GameServer[T])
+import "time"
+
+type GameServerOption[T any, I any] func(*GameServer[T, I])
+
+// WithLobbyName sets the display name of the lobby, it defaults to the lobby code.
+func WithLobbyName[T any, I any](name string) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.name = name
+	}
+}
+
+// WithLobbyGameType tags the lobby with the kind of game it hosts.
+func WithLobbyGameType[T any, I any](gameType string) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.gameType = gameType
+	}
+}
+
+func WithLobbyMaxClients[T any, I any](maxClients int) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.maxClients = maxClients
+	}
+}
+
+// withLobbyChanges makes the lobby publish its view to changes whenever it changes
+// and report itself closed once the last member has left.
+func withLobbyChanges[T any, I any](changes *lobbyChanges) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.changes = changes
+	}
+}
+
+// WithSpectatorDelay holds back state broadcasts to spectators by delay to prevent ghosting.
+func WithSpectatorDelay[T any, I any](delay time.Duration) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.spectatorQueue.delay = delay
+	}
+}
+
+// WithLobbySettings sets the initial settings of the lobby.
+func WithLobbySettings[T any, I any](settings LobbySettings) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.settings = settings
+	}
+}
+
+// WithResumeCountdown sets the number of seconds counted down before a paused game resumes.
+func WithResumeCountdown[T any, I any](seconds int) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.resumeCountdown = seconds
+	}
+}
+
+// WithReadyTimeout removes members that have not readied up within timeout of joining or unreadying.
+func WithReadyTimeout[T any, I any](timeout time.Duration) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.readyTimeout = timeout
+	}
+}
+
+// WithKickBanDuration sets how long kicked clients cannot rejoin the lobby, 0 lets them back right away.
+func WithKickBanDuration[T any, I any](d time.Duration) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.kickBanDuration = d
+	}
+}
+
+// WithVoteTimeout sets how long lobby members have to vote.
+func WithVoteTimeout[T any, I any](timeout time.Duration) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.voteTimeout = timeout
+	}
+}
+
+// WithVoteThreshold sets the share of eligible voters, between 0 and 1, that has to vote yes for a vote to pass.
+// Votes pass with more than that share, the default of 0.5 is a simple majority.
+func WithVoteThreshold[T any, I any](threshold float64) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.voteThreshold = threshold
+	}
+}
+
+// WithGameModes lets the lobby switch between game modes, each creating the state its matches are played in.
+// The lobby starts in defaultMode.
+func WithGameModes[T any, I any](defaultMode string, modes map[string]func() StateManager[T, I]) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.modes = modes
+		s.settings.Mode = defaultMode
+	}
+}
+
+// WithCountdown sets the number of seconds counted down before the game starts.
+func WithCountdown[T any, I any](seconds int) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.countdown = seconds
+	}
+}
+
+// WithLobbyTickRate sets how much time every game tick advances the match by.
+func WithLobbyTickRate[T any, I any](rate time.Duration) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.tickRate = rate
+	}
+}
+
+// WithLagCompensation keeps the states sent over the last maxRewind so that states implementing LagCompensated
+// can judge actions against the world as the player saw it. clone must copy a state deep enough that
+// later ticks do not change the copy. A maxRewind of 0 uses the default.
+func WithLagCompensation[T any, I any](clone func(T) T, maxRewind time.Duration) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		if maxRewind <= 0 {
+			maxRewind = defaultMaxRewind
+		}
+		s.lag = newLagCompensator(clone, maxRewind)
+	}
+}
+
+// WithMaxCatchUpTicks bounds how many late ticks the lobby runs back to back, ticks further behind are skipped.
+func WithMaxCatchUpTicks[T any, I any](n int) GameServerOption[T, I] {
+	return func(s *GameServer[T, I]) {
+		s.maxCatchUp = n
+	}
+}
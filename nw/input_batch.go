@@ -0,0 +1,61 @@
+package nw
+
+import "sync"
+
+// inputBatcher collects a client's inputs until they are sent and keeps the ones the server has not
+// acknowledged yet, every send repeats a few of those so a lost message does not lose an input.
+type inputBatcher[I any] struct {
+	mu sync.Mutex
+	// redundancy is how many already sent inputs are repeated with every send
+	redundancy int
+	// inputs are not acknowledged yet, oldest first, the last unsent of them have not been sent
+	inputs []ClientInput[I]
+	unsent int
+}
+
+func newInputBatcher[I any](redundancy int) *inputBatcher[I] {
+	return &inputBatcher[I]{redundancy: max(redundancy, 0)}
+}
+
+// add queues an input for the next send.
+func (b *inputBatcher[I]) add(ci ClientInput[I]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inputs = append(b.inputs, ci)
+	b.unsent++
+}
+
+// next returns the inputs to send, every input added since the last send and up to redundancy
+// unacknowledged ones sent before, oldest first. ok is false when nothing was added since the last send.
+func (b *inputBatcher[I]) next() (batch []ClientInput[I], ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.unsent == 0 {
+		return nil, false
+	}
+	first := max(len(b.inputs)-b.unsent-b.redundancy, 0)
+	batch = append([]ClientInput[I](nil), b.inputs[first:]...)
+	// older inputs will not be sent again, a server that still misses them missed them for good
+	b.inputs = append(b.inputs[:0], b.inputs[first:]...)
+	b.unsent = 0
+	return batch, true
+}
+
+// acknowledge drops the inputs the server applied, every input up to seq.
+func (b *inputBatcher[I]) acknowledge(seq uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	acked := 0
+	for acked < len(b.inputs)-b.unsent && b.inputs[acked].Sequence <= seq {
+		acked++
+	}
+	b.inputs = append(b.inputs[:0], b.inputs[acked:]...)
+}
+
+// reset forgets every input, the server starts counting sequence numbers anew for a match.
+func (b *inputBatcher[I]) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inputs = nil
+	b.unsent = 0
+}
@@ -0,0 +1,76 @@
+package nw
+
+import (
+	"slices"
+	"testing"
+)
+
+func seqs[I any](inputs []ClientInput[I]) []uint32 {
+	s := make([]uint32, len(inputs))
+	for i, ci := range inputs {
+		s[i] = ci.Sequence
+	}
+	return s
+}
+
+func TestInputBatcher(t *testing.T) {
+	b := newInputBatcher[string](2)
+	if _, ok := b.next(); ok {
+		t.Fatal("got a batch without inputs")
+	}
+
+	steps := []struct {
+		name  string
+		add   []uint32
+		acked uint32
+		want  []uint32
+	}{
+		{name: "first input", add: []uint32{1}, want: []uint32{1}},
+		{name: "bundles inputs since the last send", add: []uint32{2, 3}, want: []uint32{1, 2, 3}},
+		{name: "repeats at most two sent inputs", add: []uint32{4}, want: []uint32{2, 3, 4}},
+		{name: "drops acknowledged inputs", add: []uint32{5}, acked: 3, want: []uint32{4, 5}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			for _, seq := range step.add {
+				b.add(ClientInput[string]{Sequence: seq})
+			}
+			b.acknowledge(step.acked)
+			batch, ok := b.next()
+			if got := seqs(batch); !ok || !slices.Equal(got, step.want) {
+				t.Errorf("got %v, want %v", got, step.want)
+			}
+		})
+	}
+	if _, ok := b.next(); ok {
+		t.Error("got a batch with nothing new to send")
+	}
+}
+
+func TestLobbyAppliesRepeatedInputsOnce(t *testing.T) {
+	state := newCountState()
+	s := NewGameServer("lobby", "owner", state)
+	s.clients["owner"] = &client{ID: "owner"}
+	state.InitClientEntity("owner", 0)
+	s.started = true
+
+	// the second message repeats inputs 1 and 2, the third one arrives after input 3 was applied
+	messages := [][]uint32{{1, 2}, {1, 2, 3}, {2, 3, 4}}
+	for i, msg := range messages {
+		inputs := make([]ClientInput[string], len(msg))
+		for j, seq := range msg {
+			inputs[j] = ClientInput[string]{ClientID: "owner", Sequence: seq, Input: "up"}
+		}
+		s.acceptInput(inputs)
+		if i > 0 {
+			s.processInputs()
+		}
+	}
+
+	if got := state.Get()["owner"]; got != 4 {
+		t.Errorf("got %d inputs applied, want 4", got)
+	}
+	if got := s.lastSequences["owner"]; got != 4 {
+		t.Errorf("got last sequence %d, want 4", got)
+	}
+}
@@ -1,37 +1,61 @@
 package nw
 
-type StateManager[T any] interface {
+// InputValidator is implemented by input types that can check themselves,
+// the server drops inputs that fail validation before they reach the game.
+type InputValidator interface {
+	Validate() error
+}
+
+type StateManager[T any, I any] interface {
 	Update(dt float64)
-	ApplyInputToState(ci ClientInput)
-	InitClientEntity(clientID string)
+	ApplyInputToState(ci ClientInput[I])
+	// InitClientEntity creates the entity of a player, team is 0 in free for all lobbies
+	InitClientEntity(clientID string, team int)
 	RemoveClientEntity(clientID string)
 	Get() T
+	// GameOver reports whether the match has ended and, if so, the results
+	GameOver() (GameOver, bool)
+	// Reset clears the state between matches, entities are initialized again when the next match starts
+	Reset()
+}
+
+// InterestManaged is implemented by states that show every player only the part of the world relevant to them,
+// players get GetFor instead of Get. radius is the lobby's visibility radius, 0 shows the whole world.
+// Spectators still get the whole state.
+type InterestManaged[T any] interface {
+	GetFor(clientID string, radius int) T
 }
 
-type ClientStateManager[T any] interface {
+type ClientStateManager[T any, I any] interface {
 	Update(dt float64)
 	ReconcileState(msg ServerStateMessage[T])
-	UpdateLocal(input string)
+	UpdateLocal(input I)
 	InputSeq() uint32
 	GetCurrent() T
 	GetTarget() *T
 	SetClientID(string)
 	ClientID() string
+	// SetPaused freezes prediction while the match is paused, it is called from the network goroutine
+	SetPaused(paused bool)
 }
 
-type GameClient[T any] interface {
-	SendInputToServer(input string)
-	State() ClientStateManager[T]
+type GameClient[T any, I any] interface {
+	SendInputToServer(input I)
+	State() ClientStateManager[T, I]
 	ClientID() string
 	RecvFromServer() <-chan ServerStateMessage[T]
+	GameEvents() <-chan GameEvent
 	QuitChan() <-chan struct{}
 	Start()
 	Promote(clientId string)
-	KickFromLobby(clientId string)
+	KickFromLobby(clientId, reason string)
 	JoinLobby(lobbyId string)
 	SyncLobbies()
 	Lobby() *Lobby
 	Lobbies() LobbiesSync
+	Events() <-chan ClientEvent
 	IsStarted() bool
 	LeaveLobby()
+	SendChat(scope ChatScope, text string)
+	ChatHistory() []ChatMessage
 }
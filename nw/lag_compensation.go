@@ -0,0 +1,135 @@
+package nw
+
+import "time"
+
+// defaultMaxRewind is how far back lag compensation looks at most when no limit is configured
+const defaultMaxRewind = 250 * time.Millisecond
+
+// LagCompensation lets a state judge a player's actions against the world as that player saw it,
+// with their latency and render delay taken into account.
+type LagCompensation[T any] interface {
+	// ViewOf returns the state clientID was looking at when it made its last input,
+	// ok is false before the client sent an input, when that input is older than the max rewind
+	// or when no state was recorded yet. Players without a view are judged by the current state.
+	// The state is shared, it must not be changed.
+	ViewOf(clientID string) (state T, ok bool)
+}
+
+// LagCompensated is implemented by states that use lag compensation,
+// lobbies with lag compensation enabled hand it to their state before the match starts.
+type LagCompensated[T any] interface {
+	SetLagCompensation(lc LagCompensation[T])
+}
+
+// RenderDelayer is implemented by client states that render the world behind the server,
+// the delay is sent with every input so the server can rewind to what the player saw.
+type RenderDelayer interface {
+	RenderDelay() time.Duration
+}
+
+type pastState[T any] struct {
+	tick  uint64
+	at    time.Time
+	state T
+}
+
+// StateHistory keeps the states sent to the clients over the last max rewind.
+// It is not safe for concurrent use, it is owned by the lobby.
+type StateHistory[T any] struct {
+	clone     func(T) T
+	maxRewind time.Duration
+	// states are oldest first
+	states []pastState[T]
+}
+
+// NewStateHistory creates a history that keeps maxRewind worth of states,
+// clone must return a copy of a state that later ticks do not change.
+func NewStateHistory[T any](clone func(T) T, maxRewind time.Duration) *StateHistory[T] {
+	return &StateHistory[T]{clone: clone, maxRewind: maxRewind}
+}
+
+// Record keeps a copy of the state of tick, sent at at. Ticks that are already recorded are ignored.
+func (h *StateHistory[T]) Record(tick uint64, at time.Time, state T) {
+	if n := len(h.states); n > 0 && h.states[n-1].tick >= tick {
+		return
+	}
+	h.states = append(h.states, pastState[T]{tick: tick, at: at, state: h.clone(state)})
+	// the oldest state kept is the one the longest rewind lands on
+	old := 0
+	for old+1 < len(h.states) && !h.states[old+1].at.After(at.Add(-h.maxRewind)) {
+		old++
+	}
+	h.states = append(h.states[:0], h.states[old:]...)
+}
+
+// View returns the state a client saw delay after it got the state of tick.
+// A tick that is no longer kept or a delay beyond the max rewind lands on the oldest state kept,
+// a tick from the future on the newest.
+func (h *StateHistory[T]) View(tick uint64, delay time.Duration) (state T, ok bool) {
+	n := len(h.states)
+	if n == 0 {
+		return state, false
+	}
+	i := n - 1
+	for i > 0 && h.states[i].tick > tick {
+		i--
+	}
+	t := h.states[i].at.Add(-max(delay, 0))
+	for i > 0 && h.states[i].at.After(t) {
+		i--
+	}
+	return h.states[i].state, true
+}
+
+// latest returns when the newest state was sent, the zero time if none was recorded.
+func (h *StateHistory[T]) latest() time.Time {
+	if len(h.states) == 0 {
+		return time.Time{}
+	}
+	return h.states[len(h.states)-1].at
+}
+
+// Reset forgets every state, the next match starts from scratch.
+func (h *StateHistory[T]) Reset() {
+	h.states = nil
+}
+
+// clientView is what a client was looking at when it made its last input.
+type clientView struct {
+	tick  uint64
+	delay time.Duration
+	// at is when the newest state was sent as the input was applied, an idle client's view goes stale
+	at time.Time
+}
+
+// lagCompensator tracks what every player saw, it is owned by the lobby.
+type lagCompensator[T any] struct {
+	history *StateHistory[T]
+	views   map[string]clientView
+}
+
+func newLagCompensator[T any](clone func(T) T, maxRewind time.Duration) *lagCompensator[T] {
+	return &lagCompensator[T]{
+		history: NewStateHistory(clone, maxRewind),
+		views:   make(map[string]clientView),
+	}
+}
+
+func (lc *lagCompensator[T]) ViewOf(clientID string) (state T, ok bool) {
+	view, ok := lc.views[clientID]
+	if !ok || lc.history.latest().Sub(view.at) > lc.history.maxRewind {
+		return state, false
+	}
+	return lc.history.View(view.tick, view.delay)
+}
+
+// see keeps what clientID was looking at when it made the input that was just applied.
+func (lc *lagCompensator[T]) see(clientID string, tick uint64, delay time.Duration) {
+	lc.views[clientID] = clientView{tick: tick, delay: delay, at: lc.history.latest()}
+}
+
+// reset forgets the history and views of the last match.
+func (lc *lagCompensator[T]) reset() {
+	lc.history.Reset()
+	clear(lc.views)
+}
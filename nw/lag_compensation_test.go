@@ -0,0 +1,68 @@
+package nw
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStateHistoryView(t *testing.T) {
+	start := time.Unix(100, 0)
+	h := NewStateHistory(func(s int) int { return s }, 100*time.Millisecond)
+	if _, ok := h.View(1, 0); ok {
+		t.Fatal("got a view before any state was recorded")
+	}
+	// a state every 20ms, the state of tick i is i*10
+	for tick := uint64(1); tick <= 10; tick++ {
+		h.Record(tick, start.Add(time.Duration(tick)*20*time.Millisecond), int(tick)*10)
+	}
+	h.Record(10, start.Add(time.Second), -1)
+
+	tests := []struct {
+		name  string
+		tick  uint64
+		delay time.Duration
+		want  int
+	}{
+		{name: "the state the client had", tick: 8, want: 80},
+		{name: "rendered behind it", tick: 8, delay: 45 * time.Millisecond, want: 50},
+		{name: "a tick from the future", tick: 99, want: 100},
+		{name: "a tick no longer kept", tick: 2, want: 50},
+		{name: "rewinds at most the max rewind", tick: 10, delay: time.Second, want: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := h.View(tt.tick, tt.delay)
+			if !ok || got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLagCompensatorExpiresIdleViews(t *testing.T) {
+	start := time.Unix(100, 0)
+	lc := newLagCompensator(func(s int) int { return s }, 100*time.Millisecond)
+	record := func(tick uint64) {
+		lc.history.Record(tick, start.Add(time.Duration(tick)*20*time.Millisecond), int(tick)*10)
+	}
+	for tick := uint64(1); tick <= 5; tick++ {
+		record(tick)
+	}
+	lc.see("active", 4, 0)
+	lc.see("idle", 4, 0)
+	if got, ok := lc.ViewOf("idle"); !ok || got != 40 {
+		t.Fatalf("got %d, want the state of tick 4", got)
+	}
+
+	// only active keeps sending inputs while the max rewind passes
+	for tick := uint64(6); tick <= 11; tick++ {
+		record(tick)
+		lc.see("active", tick-1, 0)
+	}
+	if got, ok := lc.ViewOf("active"); !ok || got != 100 {
+		t.Errorf("got %d, want the state of tick 10", got)
+	}
+	if got, ok := lc.ViewOf("idle"); ok {
+		t.Errorf("got view %d of an idle client, want none", got)
+	}
+}
@@ -3,13 +3,20 @@ package nw
 import (
 	"fmt"
 	"log"
+	"slices"
 	"sort"
+	"strings"
 	"time"
 )
 
-type GameServer[T any] struct {
+// GameServer is a lobby and the matches played in it.
+// All of its state is owned by the handleLobbyActions goroutine, which also runs the game ticks,
+// other goroutines only talk to it through the channels behind its unexported methods.
+type GameServer[T any, I any] struct {
 	ID         string
-	state      StateManager[T]
+	name       string
+	gameType   string
+	state      StateManager[T, I]
 	maxClients int
 	log        *log.Logger
 	countdown  int
@@ -17,173 +24,666 @@ type GameServer[T any] struct {
 
 	OwnerID           string
 	clients           map[string]*client
-	clientInputs      chan ClientInput
-	clientInputQueues map[string][]ClientInput
-	newClients        chan *client
-	promoteChan       chan string
-	removeClients     chan *client
-	readyChan         chan *client
-	readyClients      map[string]bool
-	startChan         chan struct{}
-	stopChan          chan struct{}
-	started           bool
+	members           []string
+	clientInputs      chan []ClientInput[I]
+	clientInputQueues map[string][]ClientInput[I]
+	// lastSequences is the sequence number of the last input applied for every member
+	lastSequences map[string]uint32
+	newClients    chan *client
+	promoteChan   chan promotion
+	removeClients chan *client
+	readyChan     chan *client
+	readyClients  map[string]bool
+	chatChan      chan ChatMessage
+	// changes are taken by the server loop, nil for lobbies outside a server
+	changes   *lobbyChanges
+	startChan chan string
+	done      chan struct{}
+	started   bool
+	// ticks paces the game ticks while a match is running
+	ticks *tickScheduler
+	// tick is the number of the last game tick, it keeps counting across matches
+	tick        uint64
+	maxCatchUp  int
+	tickMetrics *tickMetrics
+	// lag rewinds the world to what players saw, nil unless lag compensation is enabled
+	lag *lagCompensator[T]
+
+	// spectators receive state broadcasts but never get an entity or send inputs
+	spectators     map[string]*client
+	newSpectators  chan *client
+	spectatorQueue *delayQueue
+	settings       LobbySettings
+	settingsChan   chan settingsChange
+	// profileChanges are checked against the names already taken in the lobby
+	profileChanges  chan profileChange
+	teams           *teamRoster
+	teamChanges     chan teamChange
+	pauseRequests   chan pauseRequest
+	pause           pauseState
+	resumeCountdown int
+	// countdownLeft is the number of seconds before the game starts while countdownTicker runs
+	countdownLeft   int
+	countdownTicker *time.Ticker
+	// readyTimeout removes members that have not readied up for that long, 0 disables it
+	readyTimeout time.Duration
+	unreadySince map[string]time.Time
+	kickRequests chan kickRequest
+	// bans keeps kicked clients from rejoining for kickBanDuration
+	bans            lobbyBans
+	kickBanDuration time.Duration
+	// vote is the open vote, nil while none runs
+	vote          *vote
+	voteCount     int
+	voteActions   chan voteAction
+	voteTimeout   time.Duration
+	voteThreshold float64
+	// modes create the state of each game mode the lobby can switch to between matches
+	modes map[string]func() StateManager[T, I]
+}
+
+type promotion struct {
+	clientID string
+	target   string
 }
 
 func NewGameServerID() string {
 	return fmt.Sprintf("game_%d", time.Now().Unix())
 }
 
-func NewGameServer[T any](id, ownerId string, state StateManager[T], opts ...GameServerOption[T]) *GameServer[T] {
-	s := &GameServer[T]{
-		ID: id,
+func NewGameServer[T any, I any](id, ownerId string, state StateManager[T, I], opts ...GameServerOption[T, I]) *GameServer[T, I] {
+	s := &GameServer[T, I]{
+		ID:         id,
+		name:       id,
+		maxClients: defaultMaxClients,
+		countdown:  defaultCountdown,
+
+		resumeCountdown: defaultResumeCountdown,
+		kickBanDuration: defaultKickBanDuration,
+		voteTimeout:     defaultVoteTimeout,
+		voteThreshold:   defaultVoteThreshold,
 
 		OwnerID:           ownerId,
 		clients:           make(map[string]*client),
 		state:             state,
-		clientInputs:      make(chan ClientInput),
+		clientInputs:      make(chan []ClientInput[I], clientInputsBuffer),
 		log:               log.Default(),
-		clientInputQueues: make(map[string][]ClientInput),
-		tickRate:          time.Second / 30,
+		clientInputQueues: make(map[string][]ClientInput[I]),
+		lastSequences:     make(map[string]uint32),
+		tickRate:          gameInterval,
+		maxCatchUp:        defaultMaxCatchUpTicks,
+		tickMetrics:       newTickMetrics(tickStatsWindow),
 		newClients:        make(chan *client),
 		removeClients:     make(chan *client),
-		startChan:         make(chan struct{}),
+		startChan:         make(chan string),
 		readyChan:         make(chan *client),
 		readyClients:      make(map[string]bool),
-		promoteChan:       make(chan string),
+		promoteChan:       make(chan promotion),
+		chatChan:          make(chan ChatMessage),
+		spectators:        make(map[string]*client),
+		newSpectators:     make(chan *client),
+		spectatorQueue:    &delayQueue{},
+		settingsChan:      make(chan settingsChange),
+		profileChanges:    make(chan profileChange),
+		teams:             newTeamRoster(),
+		teamChanges:       make(chan teamChange),
+		pauseRequests:     make(chan pauseRequest),
+		unreadySince:      make(map[string]time.Time),
+		kickRequests:      make(chan kickRequest),
+		bans:              make(lobbyBans),
+		voteActions:       make(chan voteAction),
 
-		stopChan: make(chan struct{}),
+		done: make(chan struct{}),
 	}
 	for _, opt := range opts {
 		opt(s)
 	}
+	s.teams.count = s.settings.Teams
+	if _, ok := s.modes[s.settings.Mode]; ok {
+		s.setMode(s.settings.Mode)
+	}
 	go s.handleLobbyActions()
 	return s
 }
 
-func (s *GameServer[T]) promote(clientId string) {
-	s.promoteChan <- clientId
+// sendTo hands v to a lobby goroutine over ch, it gives up once the lobby is closed.
+func sendTo[V any](done <-chan struct{}, ch chan<- V, v V) bool {
+	select {
+	case ch <- v:
+		return true
+	case <-done:
+		return false
+	}
 }
-func (s *GameServer[T]) kick(clientId string) {
-	client, ok := s.clients[clientId]
-	if !ok {
-		s.log.Println("Client not found to kick")
-		return
+
+// promote asks the lobby to hand ownership to target on behalf of clientID.
+func (s *GameServer[T, I]) promote(clientID, target string) {
+	sendTo(s.done, s.promoteChan, promotion{clientID: clientID, target: target})
+}
+
+// kick asks the lobby to remove a member on behalf of kickerID, moderators may kick from any lobby.
+func (s *GameServer[T, I]) kick(kickerID string, moderator bool, kr KickRequest) {
+	sendTo(s.done, s.kickRequests, kickRequest{kickerID: kickerID, moderator: moderator, request: kr})
+}
+
+func (s *GameServer[T, I]) ready(client *client) {
+	sendTo(s.done, s.readyChan, client)
+}
+
+func (s *GameServer[T, I]) view() LobbyView {
+	ownerName := s.OwnerID
+	if owner, ok := s.clients[s.OwnerID]; ok {
+		ownerName = owner.displayName()
+	}
+	return LobbyView{
+		Code:       s.ID,
+		Name:       s.name,
+		GameType:   s.gameType,
+		OwnerID:    s.OwnerID,
+		OwnerName:  ownerName,
+		MaxClients: s.maxClients,
+		NumClients: len(s.clients),
+		Spectators: len(s.spectators),
+		Started:    s.started,
+		LateJoin:   s.settings.LateJoin,
+		TeamSizes:  s.teams.sizes(),
+	}
+}
+
+// notifyChanged publishes the current view of the lobby to the server's lobby directory.
+func (s *GameServer[T, I]) notifyChanged() {
+	if s.changes != nil {
+		s.changes.update(s.view())
 	}
-	s.removeClients <- client
 }
 
-func (s *GameServer[T]) broadcast(msg Message) {
+func (s *GameServer[T, I]) chat(cm ChatMessage) {
+	sendTo(s.done, s.chatChan, cm)
+}
+
+func (s *GameServer[T, I]) broadcast(msg Message) {
 	for _, client := range s.clients {
-		client.sendChan <- msg
+		client.send(msg)
 	}
 }
 
-func (s *GameServer[T]) addClient(client *client) {
-	s.newClients <- client
+// broadcastAll sends msg to players and spectators alike.
+func (s *GameServer[T, I]) broadcastAll(msg Message) {
+	s.broadcast(msg)
+	for _, spectator := range s.spectators {
+		spectator.send(msg)
+	}
 }
 
-func (s *GameServer[T]) removeClient(client *client) {
-	s.removeClients <- client
+// broadcastDelayed sends msg to the players now and to the spectators after the spectator delay,
+// so spectators learn about the match in the order they watch it.
+func (s *GameServer[T, I]) broadcastDelayed(msg Message) {
+	s.broadcast(msg)
+	s.broadcastSpectators(time.Now(), msg)
+}
+
+// broadcastSpectators queues msg for the spectators and sends the ones that are past the spectator delay.
+func (s *GameServer[T, I]) broadcastSpectators(now time.Time, msg Message) {
+	if len(s.spectators) == 0 {
+		return
+	}
+	s.spectatorQueue.push(now, msg)
+	s.releaseSpectators(now)
+}
+
+// releaseSpectators sends the spectators every queued message that is past the spectator delay.
+func (s *GameServer[T, I]) releaseSpectators(now time.Time) {
+	for _, delayed := range s.spectatorQueue.due(now) {
+		for _, spectator := range s.spectators {
+			spectator.send(delayed)
+		}
+	}
+}
+
+// requestStart asks the lobby to start the game on behalf of clientID.
+func (s *GameServer[T, I]) requestStart(clientID string) {
+	sendTo(s.done, s.startChan, clientID)
+}
+
+// queueInput hands the inputs of a message to the lobby, they are dropped when the lobby falls behind.
+func (s *GameServer[T, I]) queueInput(inputs []ClientInput[I]) {
+	if len(inputs) == 0 {
+		return
+	}
+	select {
+	case s.clientInputs <- inputs:
+	default:
+		s.log.Println("Dropping input, input queue is full:", inputs[0].ClientID)
+	}
+}
+
+func (s *GameServer[T, I]) addClient(client *client) {
+	if !sendTo(s.done, s.newClients, client) {
+		client.send(NewMessage(MsgLobbyJoinRejected, FmtText, []byte(fmt.Sprintf("%s|%s", s.ID, "lobby closed"))))
+	}
+}
+
+func (s *GameServer[T, I]) updateSettings(clientID string, settings LobbySettings) {
+	sendTo(s.done, s.settingsChan, settingsChange{clientID: clientID, settings: settings})
+}
+
+func (s *GameServer[T, I]) addSpectator(client *client) {
+	sendTo(s.done, s.newSpectators, client)
+}
+
+func (s *GameServer[T, I]) removeClient(client *client) {
+	sendTo(s.done, s.removeClients, client)
+}
+
+// changeProfile asks the lobby to apply a profile change, it reports false if the lobby is closed.
+func (s *GameServer[T, I]) changeProfile(client *client, p Profile) bool {
+	return sendTo(s.done, s.profileChanges, profileChange{client: client, profile: p})
+}
+
+// nameTaken reports whether anyone in the lobby other than clientID goes by name.
+func (s *GameServer[T, I]) nameTaken(clientID, name string) bool {
+	for _, members := range []map[string]*client{s.clients, s.spectators} {
+		for id, member := range members {
+			if id != clientID && strings.EqualFold(member.displayName(), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// assignTeam asks the lobby to move a member to another team on behalf of clientID.
+func (s *GameServer[T, I]) assignTeam(clientID string, ta TeamAssignment) {
+	sendTo(s.done, s.teamChanges, teamChange{clientID: clientID, assignment: ta})
+}
+
+// broadcastTeams tells everyone in the lobby the teams of clientIDs.
+func (s *GameServer[T, I]) broadcastTeams(clientIDs ...string) {
+	for _, id := range clientIDs {
+		msg, err := s.makeTeamMessage(id)
+		if err != nil {
+			s.log.Println("Error making team message:", err)
+			continue
+		}
+		s.broadcastAll(msg)
+	}
 }
 
-func (s *GameServer[T]) makeServerStateMessage(gameState T) (Message, error) {
+func (s *GameServer[T, I]) makeTeamMessage(clientID string) (Message, error) {
+	return NewTeamAssignmentMessage(FmtJSON, TeamAssignment{LobbyID: s.ID, ClientID: clientID, Team: s.teams.team(clientID)})
+}
+
+func (s *GameServer[T, I]) makeSettingsMessage() (Message, error) {
+	return NewLobbySettingsMessage(FmtJSON, LobbySettingsMessage{LobbyID: s.ID, Settings: s.settings, Modes: s.modeNames()})
+}
+
+// broadcastSettings tells everyone in the lobby the current settings.
+func (s *GameServer[T, I]) broadcastSettings() {
+	msg, err := s.makeSettingsMessage()
+	if err != nil {
+		s.log.Println("Error making lobby settings message:", err)
+		return
+	}
+	s.broadcastAll(msg)
+}
+
+// setMode switches the lobby to a game mode with a fresh state, it must only be called between matches.
+func (s *GameServer[T, I]) setMode(mode string) {
+	s.settings.Mode = mode
+	s.state = s.modes[mode]()
+}
+
+// modeNames returns the game modes of the lobby in alphabetical order.
+func (s *GameServer[T, I]) modeNames() []string {
+	names := make([]string, 0, len(s.modes))
+	for name := range s.modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *GameServer[T, I]) makeProfileMessage(client *client) (Message, error) {
+	return NewProfileMessage(FmtJSON, ProfileMessage{ClientID: client.ID, Profile: client.profile()})
+}
+
+// setOwner hands the lobby over to clientID and tells everyone in it.
+func (s *GameServer[T, I]) setOwner(clientID string) {
+	s.OwnerID = clientID
+	s.broadcastAll(NewMessage(MsgLobbyPromoted, FmtText, []byte(fmt.Sprintf("%s|%s", s.ID, clientID))))
+	s.notifyChanged()
+}
+
+// close stops the lobby and asks the server to forget it.
+func (s *GameServer[T, I]) close() {
+	s.log.Println("Closing lobby", s.ID)
+	for id, spectator := range s.spectators {
+		spectator.leaveLobby(s.ID)
+		spectator.send(NewLobbyLeaveMessage(FmtText, s.ID, id))
+	}
+	close(s.done)
+	if s.changes != nil {
+		s.changes.close(s.ID)
+	}
+}
+
+func (s *GameServer[T, I]) makeServerStateMessage(gameState T, now time.Time) (Message, error) {
 	ackSeq := make(map[string]uint32)
-	for clientID, client := range s.clients {
-		ackSeq[clientID] = client.lastSequence
+	for clientID := range s.clients {
+		ackSeq[clientID] = s.lastSequences[clientID]
 	}
 	serverMessage := ServerStateMessage[T]{
+		Tick:            s.tick,
+		ServerTime:      now,
 		GameState:       gameState,
 		AcknowledgedSeq: ackSeq,
 	}
 	return NewGameStateMessage(FmtJSON, serverMessage)
 }
 
-func (s *GameServer[T]) start() {
-	countDownTicker := time.NewTicker(time.Second)
-	countDown := 10
-	for {
-		select {
-		case <-countDownTicker.C:
-			countDown--
-			s.log.Println("Starting in", countDown)
-			countDownMsg := fmt.Sprintf(`{"countdown": %d}`, countDown)
-			msg := NewMessage(MsgLobbyGameStarted, FmtJSON, []byte(countDownMsg))
-			s.broadcast(msg)
-			if countDown == 0 {
-				s.startChan <- struct{}{}
-				break
-			}
-		case <-s.startChan:
-			countDownTicker.Stop()
-			s.started = true
-			msg := NewMessage(MsgLobbyGameStarted, FmtText, []byte{})
-			s.broadcast(msg)
-			goto Started
+// start creates an entity for every member and starts ticking the game.
+func (s *GameServer[T, I]) start() {
+	if s.vote != nil && s.vote.status.Type != VoteKick {
+		// mode and rematch votes are about the time between matches
+		s.endVote(VoteCancelled)
+	}
+	if s.settings.AutoBalance {
+		s.broadcastTeams(s.teams.balance(s.members)...)
+	}
+	for clientID := range s.clients {
+		s.state.InitClientEntity(clientID, s.teams.team(clientID))
+		s.clientInputQueues[clientID] = []ClientInput[I]{}
+		s.lastSequences[clientID] = 0
+	}
+	if s.lag != nil {
+		s.lag.reset()
+		if lc, ok := s.state.(LagCompensated[T]); ok {
+			lc.SetLagCompensation(s.lag)
 		}
-	Started:
-		break
 	}
-	go s.gameLoop()
+	s.started = true
+	s.pause = pauseState{}
+	s.ticks = newTickScheduler(s.tickRate, s.maxCatchUp, time.Now())
+	msg := NewMessage(MsgLobbyGameStarted, FmtText, []byte{})
+	s.broadcastAll(msg)
+	s.notifyChanged()
 }
-func (s *GameServer[T]) stop() {
-	s.log.Println("Stopping server")
-	s.stopChan <- struct{}{}
-	for _, client := range s.clients {
-		s.removeClients <- client
+
+// gameC fires when the next game tick is due, it is nil while no match is running.
+func (s *GameServer[T, I]) gameC() <-chan time.Time {
+	if s.ticks == nil {
+		return nil
+	}
+	return s.ticks.C()
+}
+
+func (s *GameServer[T, I]) stopGame() {
+	if s.ticks != nil {
+		s.ticks.stop()
+		s.ticks = nil
 	}
 }
 
-func (s *GameServer[T]) processInputs() {
+// TickStats returns how well the lobby keeps up with its tick rate, it is safe to call from any goroutine.
+func (s *GameServer[T, I]) TickStats() TickStats {
+	return s.tickMetrics.snapshot()
+}
+
+func (s *GameServer[T, I]) processInputs() {
 	for clientID, queue := range s.clientInputQueues {
-		client := s.clients[clientID]
+		if _, ok := s.clients[clientID]; !ok {
+			delete(s.clientInputQueues, clientID)
+			continue
+		}
 		sort.Slice(queue, func(i, j int) bool {
 			return queue[i].Sequence < queue[j].Sequence
 		})
 
-		newQueue := make([]ClientInput, 0)
+		// the same input may be queued more than once when messages repeating it arrived in the same tick,
+		// only the first copy is applied
 		for _, input := range queue {
-			if input.Sequence > client.lastSequence {
+			if input.Sequence > s.lastSequences[clientID] {
 				s.state.ApplyInputToState(input)
-				client.lastSequence = input.Sequence
-			}
-			if input.Sequence > client.lastSequence {
-				newQueue = append(newQueue, input)
+				s.lastSequences[clientID] = input.Sequence
+				if s.lag != nil {
+					s.lag.see(clientID, input.ViewTick, input.RenderDelay)
+				}
 			}
 		}
-		s.clientInputQueues[clientID] = newQueue
+		s.clientInputQueues[clientID] = queue[:0]
 	}
 }
 
-func (s *GameServer[T]) handleLobbyActions() {
+func (s *GameServer[T, I]) handleLobbyActions() {
+	defer s.stopCountdown()
+	defer s.stopGame()
+	var readyCheck <-chan time.Time
+	if s.readyTimeout > 0 {
+		ticker := time.NewTicker(readyCheckInterval)
+		defer ticker.Stop()
+		readyCheck = ticker.C
+	}
 	for {
 		select {
 		case readyClient := <-s.readyChan:
 			s.log.Println("Client ready msg:", readyClient.ID)
+			if _, ok := s.clients[readyClient.ID]; !ok {
+				continue
+			}
 			s.readyClients[readyClient.ID] = !s.readyClients[readyClient.ID]
 			s.broadcast(NewMessage(MsgLobbyClientReady, FmtText, []byte(readyClient.ID)))
+			if s.readyClients[readyClient.ID] {
+				delete(s.unreadySince, readyClient.ID)
+				continue
+			}
+			s.unreadySince[readyClient.ID] = time.Now()
+			s.cancelCountdown(fmt.Sprintf("%s is no longer ready", readyClient.displayName()))
+		case <-s.countdownC():
+			s.tickCountdown()
+		case now := <-readyCheck:
+			for _, client := range s.idleMembers(now) {
+				if s.kickMember(client, "not ready in time", 0) {
+					return
+				}
+			}
+		case action := <-s.voteActions:
+			if s.handleVoteAction(action) {
+				return
+			}
+		case <-s.voteC():
+			if s.expireVote() {
+				return
+			}
+		case req := <-s.kickRequests:
+			if req.kickerID != s.OwnerID && !req.moderator {
+				s.log.Println("Only the lobby owner or a moderator can kick clients:", req.kickerID)
+				continue
+			}
+			target, ok := s.clients[req.request.ClientID]
+			if !ok {
+				target, ok = s.spectators[req.request.ClientID]
+			}
+			if !ok || target.ID == req.kickerID {
+				s.log.Println("Client not found to kick:", req.request.ClientID)
+				continue
+			}
+			if s.kickMember(target, req.request.Reason, s.kickBanDuration) {
+				return
+			}
 		case client := <-s.newClients:
+			if reason := s.rejectJoin(client); reason != "" {
+				s.log.Printf("Rejecting client %s from lobby %s: %s\n", client.ID, s.ID, reason)
+				client.send(NewMessage(MsgLobbyJoinRejected, FmtText, []byte(fmt.Sprintf("%s|%s", s.ID, reason))))
+				continue
+			}
 			fmt.Printf("Adding client %s to lobby %s\n", client.ID, s.ID)
 			s.clients[client.ID] = client
-			message := NewMessage(MsgLobbyClientJoin, FmtText, []byte(client.ID))
-			client.sendChan <- message
-			s.clientInputQueues[client.ID] = []ClientInput{}
-			s.broadcast(message)
-		case toPromote := <-s.promoteChan:
-			_, ok := s.clients[toPromote]
-			if !ok {
+			s.members = append(s.members, client.ID)
+			s.unreadySince[client.ID] = time.Now()
+			s.cancelCountdown(fmt.Sprintf("%s joined", client.displayName()))
+			client.setLobby(s.ID)
+			s.broadcast(NewLobbyJoinMessage(FmtText, s.ID, client.ID))
+			// tell the newcomer who is already here
+			for id, member := range s.clients {
+				if id == client.ID {
+					continue
+				}
+				client.send(NewLobbyJoinMessage(FmtText, s.ID, id))
+				if msg, err := s.makeProfileMessage(member); err == nil {
+					client.send(msg)
+				}
+				if msg, err := s.makeTeamMessage(id); err == nil && s.teams.enabled() {
+					client.send(msg)
+				}
+			}
+			if msg, err := s.makeProfileMessage(client); err == nil {
+				s.broadcast(msg)
+			}
+			if s.teams.join(client.ID) > 0 {
+				s.broadcastTeams(client.ID)
+			}
+			client.send(NewMessage(MsgLobbyPromoted, FmtText, []byte(fmt.Sprintf("%s|%s", s.ID, s.OwnerID))))
+			if msg, err := s.makeSettingsMessage(); err == nil {
+				client.send(msg)
+			}
+			if s.vote != nil {
+				// the newcomer can vote too
+				s.tallyVote()
+			}
+			if s.started {
+				client.send(NewMessage(MsgLobbyGameStarted, FmtText, []byte{}))
+				s.log.Printf("Client %s joined the running game in lobby %s\n", client.ID, s.ID)
+				s.joinRunningGame(client)
+			} else {
+				s.clientInputQueues[client.ID] = []ClientInput[I]{}
+			}
+			s.notifyChanged()
+		case change := <-s.settingsChan:
+			if change.clientID != s.OwnerID {
+				s.log.Println("Only the lobby owner can change settings:", change.clientID)
+				continue
+			}
+			if s.started && change.settings.Teams != s.settings.Teams {
+				s.log.Println("Teams can only change between matches")
+				change.settings.Teams = s.settings.Teams
+			}
+			if _, ok := s.modes[change.settings.Mode]; change.settings.Mode != s.settings.Mode && (s.started || !ok) {
+				s.log.Println("Invalid mode change:", change.settings.Mode)
+				change.settings.Mode = s.settings.Mode
+			}
+			if change.settings.Mode != s.settings.Mode {
+				s.setMode(change.settings.Mode)
+			}
+			moved := s.teams.resize(change.settings.Teams, s.members)
+			if change.settings.AutoBalance && !s.started {
+				moved = append(moved, s.teams.balance(s.members)...)
+			}
+			s.settings = change.settings
+			s.broadcastSettings()
+			s.broadcastTeams(moved...)
+			s.notifyChanged()
+		case change := <-s.profileChanges:
+			if s.nameTaken(change.client.ID, displayName(change.client.ID, change.profile)) {
+				change.client.send(NewMessage(MsgProfileRejected, FmtText, []byte("name already taken in lobby")))
+				continue
+			}
+			change.client.setProfile(change.profile)
+			msg, err := s.makeProfileMessage(change.client)
+			if err != nil {
+				s.log.Println("Error making profile message:", err)
+				continue
+			}
+			s.broadcastAll(msg)
+			s.notifyChanged()
+		case req := <-s.pauseRequests:
+			if req.clientID != s.OwnerID {
+				s.log.Println("Only the lobby owner can pause the game:", req.clientID)
+				continue
+			}
+			if !s.started {
+				s.log.Println("No game running to pause")
+				continue
+			}
+			s.handlePause(&s.pause, req.paused, time.Now())
+		case change := <-s.teamChanges:
+			ta := change.assignment
+			if change.clientID != s.OwnerID {
+				s.log.Println("Only the lobby owner can assign teams:", change.clientID)
+				continue
+			}
+			if s.started {
+				s.log.Println("Teams can only change between matches")
+				continue
+			}
+			if _, ok := s.clients[ta.ClientID]; !ok {
+				s.log.Println("Client not found to assign a team:", ta.ClientID)
+				continue
+			}
+			if err := s.teams.assign(ta.ClientID, ta.Team); err != nil {
+				s.log.Println("Error assigning team:", err)
+				continue
+			}
+			s.broadcastTeams(ta.ClientID)
+			s.notifyChanged()
+		case p := <-s.promoteChan:
+			if p.clientID != s.OwnerID {
+				s.log.Println("Only the lobby owner can promote clients:", p.clientID)
+				continue
+			}
+			if _, ok := s.clients[p.target]; !ok {
 				s.log.Println("Client not found to promote")
 				continue
 			}
-			s.OwnerID = toPromote
+			s.setOwner(p.target)
+		case spectator := <-s.newSpectators:
+			if _, ok := s.clients[spectator.ID]; ok {
+				// a member cannot watch its own lobby, it would be a player and a spectator at once
+				spectator.send(NewMessage(MsgLobbyJoinRejected, FmtText, []byte(fmt.Sprintf("%s|%s", s.ID, "already in lobby"))))
+				continue
+			}
+			if until := s.bans.until(spectator.ID, time.Now()); !until.IsZero() {
+				spectator.send(NewMessage(MsgLobbyJoinRejected, FmtText, []byte(fmt.Sprintf("%s|%s", s.ID, "banned from lobby"))))
+				continue
+			}
+			fmt.Printf("Adding spectator %s to lobby %s\n", spectator.ID, s.ID)
+			s.spectators[spectator.ID] = spectator
+			spectator.setLobby(s.ID)
+			spectator.send(NewMessage(MsgLobbySpectate, FmtText, []byte(fmt.Sprintf("%s|%s", s.ID, spectator.ID))))
+			if s.started {
+				spectator.send(NewMessage(MsgLobbyGameStarted, FmtText, []byte{}))
+			}
+			s.notifyChanged()
+		case cm := <-s.chatChan:
+			_, isClient := s.clients[cm.From]
+			_, isSpectator := s.spectators[cm.From]
+			if !isClient && !isSpectator {
+				s.log.Println("Chat from client not in lobby:", cm.From)
+				continue
+			}
+			msg, err := NewChatMessage(FmtJSON, cm)
+			if err != nil {
+				s.log.Println("Error making chat message:", err)
+				continue
+			}
+			s.broadcastAll(msg)
 		case client := <-s.removeClients:
-			s.state.RemoveClientEntity(client.ID)
-			message := NewMessage(MsgLobbyClientLeave, FmtText, []byte(client.ID))
-			delete(s.clientInputQueues, client.ID)
-			close(client.sendChan)
-			s.broadcast(message)
-			s.log.Println("Client removed, clients count:", len(s.clients))
-		case <-s.startChan:
+			if s.remove(client) {
+				return
+			}
+		case clientID := <-s.startChan:
 			s.log.Println("attempting to start game")
+			if clientID != s.OwnerID {
+				s.log.Println("Only the lobby owner can start the game:", clientID)
+				continue
+			}
+			if s.started {
+				s.log.Println("Game already started")
+				continue
+			}
+			if s.countdownTicker != nil {
+				s.log.Println("Countdown already running")
+				continue
+			}
 			var allReady bool = true
 			for _, client := range s.clients {
 				allReady = s.readyClients[client.ID] && allReady
@@ -194,33 +694,260 @@ func (s *GameServer[T]) handleLobbyActions() {
 				continue
 			}
 			s.log.Println("Starting game")
-			s.start()
+			s.beginCountdown()
+		case inputs := <-s.clientInputs:
+			s.acceptInput(inputs)
+		case now := <-s.gameC():
+			s.runTicks(now)
+		case now := <-s.spectatorQueue.C():
+			s.releaseSpectators(now)
 
 		}
 	}
 }
 
-func (s *GameServer[T]) gameLoop() {
-	ticker := time.NewTicker(s.tickRate)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-s.stopChan:
+// endMatch announces the results and puts the lobby back in the ready check for a rematch.
+func (s *GameServer[T, I]) endMatch(over GameOver) {
+	s.log.Printf("Match in lobby %s is over: %s\n", s.ID, over.Reason)
+	over.LobbyID = s.ID
+	s.started = false
+	s.readyClients = make(map[string]bool)
+	now := time.Now()
+	for _, id := range s.members {
+		s.unreadySince[id] = now
+	}
+	s.state.Reset()
+	msg, err := NewGameOverMessage(FmtJSON, over)
+	if err != nil {
+		s.log.Println("Error making game over message:", err)
+	} else {
+		s.broadcastDelayed(msg)
+	}
+	s.notifyChanged()
+}
+
+// kickMember tells client why it is removed, bans it from rejoining for banFor and removes it.
+// It reports whether that closed the lobby.
+func (s *GameServer[T, I]) kickMember(client *client, reason string, banFor time.Duration) bool {
+	s.log.Printf("Kicking client %s from lobby %s: %s\n", client.ID, s.ID, reason)
+	kicked := Kicked{LobbyID: s.ID, Reason: reason}
+	if banFor > 0 {
+		kicked.BannedUntil = time.Now().Add(banFor)
+		s.bans.add(client.ID, kicked.BannedUntil)
+	}
+	if msg, err := NewKickedMessage(FmtJSON, kicked); err == nil {
+		client.send(msg)
+	} else {
+		s.log.Println("Error making kicked message:", err)
+	}
+	return s.remove(client)
+}
+
+// remove takes a member or spectator out of the lobby and reports whether that closed the lobby.
+func (s *GameServer[T, I]) remove(client *client) bool {
+	if _, ok := s.spectators[client.ID]; ok {
+		delete(s.spectators, client.ID)
+		client.leaveLobby(s.ID)
+		client.send(NewLobbyLeaveMessage(FmtText, s.ID, client.ID))
+		s.notifyChanged()
+		return false
+	}
+	if _, ok := s.clients[client.ID]; !ok {
+		return false
+	}
+	s.state.RemoveClientEntity(client.ID)
+	message := NewLobbyLeaveMessage(FmtText, s.ID, client.ID)
+	client.send(message)
+	delete(s.clientInputQueues, client.ID)
+	delete(s.clients, client.ID)
+	delete(s.readyClients, client.ID)
+	delete(s.unreadySince, client.ID)
+	s.members = slices.DeleteFunc(s.members, func(id string) bool { return id == client.ID })
+	delete(s.lastSequences, client.ID)
+	if s.lag != nil {
+		delete(s.lag.views, client.ID)
+	}
+	s.teams.leave(client.ID)
+	s.voterLeft(client.ID)
+	client.leaveLobby(s.ID)
+	s.broadcast(message)
+	s.log.Println("Client removed, clients count:", len(s.clients))
+	if len(s.members) == 0 {
+		s.close()
+		return true
+	}
+	s.cancelCountdown(fmt.Sprintf("%s left", client.displayName()))
+	if client.ID == s.OwnerID {
+		// the longest connected member takes over
+		s.setOwner(s.members[0])
+	}
+	if s.settings.AutoBalance && !s.started {
+		s.broadcastTeams(s.teams.balance(s.members)...)
+	}
+	s.notifyChanged()
+	return false
+}
+
+// rejectJoin returns why client cannot join right now, or an empty string if it can.
+func (s *GameServer[T, I]) rejectJoin(client *client) string {
+	if until := s.bans.until(client.ID, time.Now()); !until.IsZero() {
+		return "banned from lobby"
+	}
+	if len(s.clients) >= s.maxClients {
+		return "lobby is full"
+	}
+	if s.nameTaken(client.ID, client.displayName()) {
+		return "name already taken in lobby"
+	}
+	if s.started && !s.settings.LateJoin {
+		return "game already started"
+	}
+	return ""
+}
+
+// joinRunningGame folds a late joiner into the match: it gets a fresh entity and a full snapshot.
+func (s *GameServer[T, I]) joinRunningGame(client *client) {
+	s.state.InitClientEntity(client.ID, s.teams.team(client.ID))
+	s.clientInputQueues[client.ID] = []ClientInput[I]{}
+	s.lastSequences[client.ID] = 0
+	msg, err := s.makeServerStateMessage(s.stateFor(client.ID), time.Now())
+	if err != nil {
+		s.log.Println("Error making server state message:", err)
+		return
+	}
+	client.send(msg)
+}
+
+// acceptInput queues a player's inputs for the next tick, inputs outside of a running match are stale.
+// Clients repeat the inputs that were not acknowledged yet, the ones already applied are dropped here.
+func (s *GameServer[T, I]) acceptInput(inputs []ClientInput[I]) {
+	if !s.started || s.pause.paused {
+		return
+	}
+	for _, input := range inputs {
+		if _, ok := s.clients[input.ClientID]; !ok {
+			s.log.Println("Dropping input from non player:", input.ClientID)
 			return
-		case input := <-s.clientInputs:
-			s.log.Println("Client input received:", input)
-			queue := s.clientInputQueues[input.ClientID]
-			queue = append(queue, input)
-			s.clientInputQueues[input.ClientID] = queue
-		case <-ticker.C:
-			s.processInputs()
-			s.state.Update(s.tickRate.Seconds())
-			msg, err := s.makeServerStateMessage(s.state.Get())
-			if err != nil {
-				s.log.Println("Error making server state message:", err)
-				continue
-			}
-			s.broadcast(msg)
 		}
+		if input.Sequence <= s.lastSequences[input.ClientID] {
+			continue
+		}
+		s.clientInputQueues[input.ClientID] = append(s.clientInputQueues[input.ClientID], input)
+	}
+}
+
+// runTicks runs the game ticks due at now and schedules the next one.
+func (s *GameServer[T, I]) runTicks(now time.Time) {
+	steps, skipped := s.ticks.due(now)
+	if skipped > 0 {
+		s.log.Printf("Lobby %s fell behind, skipping %d ticks\n", s.ID, skipped)
+		s.tickMetrics.skip(skipped)
+	}
+	if steps == 0 {
+		s.ticks.schedule(time.Now())
+		return
+	}
+	if s.pause.paused && !s.resumeDue(&s.pause, now) {
+		// the frozen state keeps flowing so clients stay in sync
+		s.broadcastState(now)
+		s.ticks.schedule(time.Now())
+		return
+	}
+	// every step is timed on its own, the steps after the first catch up on missed ticks
+	for i := 0; i < steps; i++ {
+		start := time.Now()
+		if s.step() {
+			return
+		}
+		caughtUp := 0
+		if i > 0 {
+			caughtUp = 1
+		}
+		if i == steps-1 {
+			// the state goes out once, after the last step
+			s.broadcastState(now)
+		}
+		took := time.Since(start)
+		s.tickMetrics.record(s.tick, took, s.tickRate, caughtUp)
+		if took > s.tickRate {
+			s.log.Printf("Lobby %s tick %d overran: took %s, the tick rate is %s\n", s.ID, s.tick, took, s.tickRate)
+		}
+	}
+	s.ticks.schedule(time.Now())
+}
+
+// step advances the game by one fixed timestep and reports whether that ended the match.
+func (s *GameServer[T, I]) step() bool {
+	s.processInputs()
+	s.state.Update(s.tickRate.Seconds())
+	s.tick++
+	s.sendGameEvents(time.Now())
+	over, ok := s.state.GameOver()
+	if !ok {
+		return false
+	}
+	s.broadcastState(time.Now())
+	s.stopGame()
+	s.endMatch(over)
+	return true
+}
+
+// sendGameEvents sends the events of the tick that just ran to the players and queues them for the spectators.
+func (s *GameServer[T, I]) sendGameEvents(now time.Time) {
+	emitter, ok := s.state.(GameEventEmitter)
+	if !ok {
+		return
+	}
+	events := emitter.TakeEvents()
+	if len(events) == 0 {
+		return
+	}
+	for i := range events {
+		events[i].Tick = s.tick
+	}
+	msg, err := NewGameEventMessage(FmtJSON, events)
+	if err != nil {
+		s.log.Println("Error making game event message:", err)
+		return
+	}
+	s.broadcast(msg)
+	s.broadcastSpectators(now, msg)
+}
+
+// broadcastState sends the current state to the players and queues it for the spectators.
+func (s *GameServer[T, I]) broadcastState(now time.Time) {
+	if s.lag != nil {
+		s.lag.history.Record(s.tick, now, s.state.Get())
+	}
+	msg, err := s.makeServerStateMessage(s.state.Get(), now)
+	if err != nil {
+		s.log.Println("Error making server state message:", err)
+		return
+	}
+	if _, ok := s.state.(InterestManaged[T]); ok {
+		s.sendStates(now)
+	} else {
+		s.broadcast(msg)
+	}
+	s.broadcastSpectators(now, msg)
+}
+
+// sendStates sends every player its own view of the state.
+func (s *GameServer[T, I]) sendStates(now time.Time) {
+	for id, client := range s.clients {
+		msg, err := s.makeServerStateMessage(s.stateFor(id), now)
+		if err != nil {
+			s.log.Println("Error making server state message:", err)
+			continue
+		}
+		client.send(msg)
+	}
+}
+
+// stateFor returns the state clientID gets, only what is relevant to it when the state manages interest.
+func (s *GameServer[T, I]) stateFor(clientID string) T {
+	if im, ok := s.state.(InterestManaged[T]); ok {
+		return im.GetFor(clientID, s.settings.VisibilityRadius)
 	}
+	return s.state.Get()
 }
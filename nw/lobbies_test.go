@@ -0,0 +1,89 @@
+package nw
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+// ownCountState is a countState that shows every player only its own count.
+type ownCountState struct {
+	countState
+}
+
+func (s *ownCountState) GetFor(clientID string, radius int) map[string]int {
+	return map[string]int{clientID: s.entities[clientID]}
+}
+
+func TestLobbySendsEveryPlayerItsOwnView(t *testing.T) {
+	state := &ownCountState{countState{entities: map[string]int{"a": 1, "b": 2}}}
+	s := NewGameServer[map[string]int, string]("lobby", "a", state)
+	spectator := newTestClient("spectator")
+	s.spectators[spectator.ID] = spectator.client
+	players := map[string]*testClient{"a": newTestClient("a"), "b": newTestClient("b")}
+	for id, c := range players {
+		s.clients[id] = c.client
+	}
+
+	s.broadcastState(time.Now())
+	for id, c := range players {
+		var ssm ServerStateMessage[map[string]int]
+		if err := json.Unmarshal([]byte(c.wait(t, MsgServerState)), &ssm); err != nil {
+			t.Fatal(err)
+		}
+		if len(ssm.GameState) != 1 || ssm.GameState[id] != state.entities[id] {
+			t.Errorf("client %s got %v, want only its own count", id, ssm.GameState)
+		}
+	}
+	var ssm ServerStateMessage[map[string]int]
+	if err := json.Unmarshal([]byte(spectator.wait(t, MsgServerState)), &ssm); err != nil {
+		t.Fatal(err)
+	}
+	if len(ssm.GameState) != 2 {
+		t.Errorf("the spectator got %v, want the whole state", ssm.GameState)
+	}
+}
+
+// eventCountState is a countState that reports every update as a score event.
+type eventCountState struct {
+	countState
+	events []GameEvent
+}
+
+func (s *eventCountState) Update(dt float64) {
+	s.events = append(s.events, GameEvent{Kind: GameEventScore, ClientID: "a", Value: len(s.events) + 1})
+}
+
+func (s *eventCountState) TakeEvents() []GameEvent {
+	events := s.events
+	s.events = nil
+	return events
+}
+
+func TestLobbySendsGameEventsWithTheirTick(t *testing.T) {
+	state := &eventCountState{countState: countState{entities: map[string]int{"a": 0}}}
+	s := NewGameServer[map[string]int, string]("lobby", "a", state)
+	player := newTestClient("a")
+	s.clients[player.ID] = player.client
+
+	s.step()
+	s.step()
+	// messages are recorded in order, once the state arrived so did the events before it
+	s.broadcastState(time.Now())
+	player.wait(t, MsgServerState)
+	player.mu.Lock()
+	messages := player.seen[MsgGameEvent]
+	player.mu.Unlock()
+	if len(messages) != 2 {
+		t.Fatalf("got %d game event messages, want one per tick", len(messages))
+	}
+	var events []GameEvent
+	if err := json.Unmarshal([]byte(messages[1]), &events); err != nil {
+		t.Fatal(err)
+	}
+	want := []GameEvent{{Tick: 2, Kind: GameEventScore, ClientID: "a", Value: 1}}
+	if !slices.Equal(events, want) {
+		t.Errorf("got %+v, want %+v", events, want)
+	}
+}
@@ -0,0 +1,265 @@
+package nw
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type LobbyView struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	GameType   string `json:"gameType"`
+	OwnerID    string `json:"ownerID"`
+	OwnerName  string `json:"ownerName"`
+	MaxClients int    `json:"maxClients"`
+	NumClients int    `json:"numClients"`
+	Spectators int    `json:"spectators"`
+	Started    bool   `json:"started"`
+	LateJoin   bool   `json:"lateJoin"`
+	// TeamSizes holds the number of members of each team, it is empty in free for all lobbies
+	TeamSizes []int `json:"teamSizes,omitempty"`
+}
+
+type LobbiesSync struct {
+	Lobbies []LobbyView `json:"lobbies"`
+	// Total is the number of lobbies matching the query before pagination
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+}
+
+// LobbyFilter narrows down the lobbies a client is interested in.
+// The zero value matches every lobby.
+type LobbyFilter struct {
+	GameType string `json:"gameType,omitempty"`
+	// OpenSlots only matches lobbies that are not full and either have not started or allow late joins
+	OpenSlots bool `json:"openSlots,omitempty"`
+	// Name matches lobbies whose name or code contains it, case insensitive
+	Name string `json:"name,omitempty"`
+}
+
+func (f LobbyFilter) Match(v LobbyView) bool {
+	if f.GameType != "" && !strings.EqualFold(f.GameType, v.GameType) {
+		return false
+	}
+	if f.OpenSlots && ((v.Started && !v.LateJoin) || (v.MaxClients > 0 && v.NumClients >= v.MaxClients)) {
+		return false
+	}
+	if f.Name != "" {
+		name := strings.ToLower(f.Name)
+		if !strings.Contains(strings.ToLower(v.Name), name) && !strings.Contains(strings.ToLower(v.Code), name) {
+			return false
+		}
+	}
+	return true
+}
+
+// LobbyQuery is sent with MsgLobbiesSync and MsgLobbiesSubscribe.
+// Offset and Limit page the snapshot, a Limit of 0 returns every match.
+type LobbyQuery struct {
+	Filter LobbyFilter `json:"filter"`
+	Offset int         `json:"offset,omitempty"`
+	Limit  int         `json:"limit,omitempty"`
+}
+
+type LobbyEventKind uint8
+
+const (
+	LobbyAdded LobbyEventKind = iota
+	LobbyUpdated
+	LobbyRemoved
+)
+
+// LobbyEvent is pushed to subscribed clients whenever a lobby matching their filter changes.
+type LobbyEvent struct {
+	Kind  LobbyEventKind `json:"kind"`
+	Lobby LobbyView      `json:"lobby"`
+}
+
+type lobbySubscription struct {
+	query LobbyQuery
+	// visible holds the codes of the lobbies the subscriber currently knows about
+	visible map[string]bool
+}
+
+// paged reports whether the subscriber only sees a page of the matching lobbies.
+func (sub *lobbySubscription) paged() bool {
+	return sub.query.Limit > 0
+}
+
+// lobbyDirectory keeps the latest view of every lobby and the clients subscribed to changes.
+// It is owned by the Server loop goroutine.
+type lobbyDirectory struct {
+	views       map[string]LobbyView
+	subscribers map[string]*lobbySubscription
+}
+
+func newLobbyDirectory() *lobbyDirectory {
+	return &lobbyDirectory{
+		views:       make(map[string]LobbyView),
+		subscribers: make(map[string]*lobbySubscription),
+	}
+}
+
+// query returns the page of lobbies matching q, sorted by code.
+func (d *lobbyDirectory) query(q LobbyQuery) LobbiesSync {
+	matches := make([]LobbyView, 0, len(d.views))
+	for _, v := range d.views {
+		if q.Filter.Match(v) {
+			matches = append(matches, v)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Code < matches[j].Code
+	})
+	total := len(matches)
+	offset := min(max(q.Offset, 0), total)
+	end := total
+	if q.Limit > 0 {
+		end = min(offset+q.Limit, total)
+	}
+	return LobbiesSync{
+		Lobbies: matches[offset:end],
+		Total:   total,
+		Offset:  offset,
+	}
+}
+
+// subscribe registers the client for lobby events and returns its initial snapshot.
+func (d *lobbyDirectory) subscribe(clientID string, q LobbyQuery) LobbiesSync {
+	sub := &lobbySubscription{query: q}
+	d.subscribers[clientID] = sub
+	return d.page(sub)
+}
+
+// page returns the subscriber's page and remembers the lobbies on it.
+func (d *lobbyDirectory) page(sub *lobbySubscription) LobbiesSync {
+	snapshot := d.query(sub.query)
+	sub.visible = make(map[string]bool, len(snapshot.Lobbies))
+	for _, v := range snapshot.Lobbies {
+		sub.visible[v.Code] = true
+	}
+	return snapshot
+}
+
+func (d *lobbyDirectory) unsubscribe(clientID string) {
+	delete(d.subscribers, clientID)
+}
+
+// update records the new view of a lobby and returns what each subscriber should receive.
+// Subscribers that see every matching lobby get an event, paged ones get their page again
+// whenever the lobby is on it or the lobbies matching their filter changed, so the page and its total stay right.
+func (d *lobbyDirectory) update(v LobbyView) (events map[string]LobbyEvent, pages map[string]LobbiesSync) {
+	old, known := d.views[v.Code]
+	d.views[v.Code] = v
+	events = make(map[string]LobbyEvent)
+	pages = make(map[string]LobbiesSync)
+	for clientID, sub := range d.subscribers {
+		matched := known && sub.query.Filter.Match(old)
+		matches := sub.query.Filter.Match(v)
+		if sub.paged() {
+			if matched != matches || sub.visible[v.Code] {
+				pages[clientID] = d.page(sub)
+			}
+			continue
+		}
+		switch {
+		case matches && sub.visible[v.Code]:
+			events[clientID] = LobbyEvent{Kind: LobbyUpdated, Lobby: v}
+		case matches:
+			sub.visible[v.Code] = true
+			events[clientID] = LobbyEvent{Kind: LobbyAdded, Lobby: v}
+		case sub.visible[v.Code]:
+			delete(sub.visible, v.Code)
+			events[clientID] = LobbyEvent{Kind: LobbyRemoved, Lobby: v}
+		}
+	}
+	return events, pages
+}
+
+// remove forgets a lobby and returns the removal events for subscribers that knew about it
+// and the new pages of paged subscribers it matched.
+func (d *lobbyDirectory) remove(code string) (events map[string]LobbyEvent, pages map[string]LobbiesSync) {
+	v, known := d.views[code]
+	if !known {
+		v = LobbyView{Code: code}
+	}
+	delete(d.views, code)
+	events = make(map[string]LobbyEvent)
+	pages = make(map[string]LobbiesSync)
+	for clientID, sub := range d.subscribers {
+		switch {
+		case sub.paged() && known && sub.query.Filter.Match(v):
+			pages[clientID] = d.page(sub)
+		case !sub.paged() && sub.visible[code]:
+			delete(sub.visible, code)
+			events[clientID] = LobbyEvent{Kind: LobbyRemoved, Lobby: v}
+		}
+	}
+	return events, pages
+}
+
+func lobbyQueryFromMessage(m Message) (LobbyQuery, error) {
+	var q LobbyQuery
+	if len(m.data.Data) == 0 {
+		return q, nil
+	}
+	if err := json.Unmarshal(m.data.Data, &q); err != nil {
+		return LobbyQuery{}, err
+	}
+	return q, nil
+}
+
+// lobbyChanges hands lobby views and closed lobbies over to the server loop without ever blocking a lobby,
+// only the latest view of every lobby is kept until the loop takes them.
+type lobbyChanges struct {
+	mu     sync.Mutex
+	views  map[string]LobbyView
+	closed []string
+	// ready has a value while there are changes to take
+	ready chan struct{}
+}
+
+func newLobbyChanges() *lobbyChanges {
+	return &lobbyChanges{
+		views: make(map[string]LobbyView),
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// update replaces the pending view of the lobby.
+func (c *lobbyChanges) update(view LobbyView) {
+	c.mu.Lock()
+	c.views[view.Code] = view
+	c.mu.Unlock()
+	c.signal()
+}
+
+// close drops the pending view of the lobby and reports it closed.
+func (c *lobbyChanges) close(code string) {
+	c.mu.Lock()
+	delete(c.views, code)
+	c.closed = append(c.closed, code)
+	c.mu.Unlock()
+	c.signal()
+}
+
+func (c *lobbyChanges) signal() {
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the lobbies closed and the views changed since the last call.
+func (c *lobbyChanges) take() (closed []string, views []LobbyView) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	closed, c.closed = c.closed, nil
+	for code, view := range c.views {
+		views = append(views, view)
+		delete(c.views, code)
+	}
+	return closed, views
+}
@@ -0,0 +1,124 @@
+package nw
+
+import (
+	"testing"
+)
+
+func TestLobbyDirectoryQuery(t *testing.T) {
+	d := newLobbyDirectory()
+	d.update(LobbyView{Code: "AAA", Name: "casual", GameType: "snake", MaxClients: 2, NumClients: 1})
+	d.update(LobbyView{Code: "BBB", Name: "ranked", GameType: "snake", MaxClients: 2, NumClients: 2})
+	d.update(LobbyView{Code: "CCC", Name: "casual two", GameType: "knight", MaxClients: 4, NumClients: 1})
+
+	tests := []struct {
+		name  string
+		query LobbyQuery
+		want  []string
+		total int
+	}{
+		{name: "all", query: LobbyQuery{}, want: []string{"AAA", "BBB", "CCC"}, total: 3},
+		{name: "game type", query: LobbyQuery{Filter: LobbyFilter{GameType: "snake"}}, want: []string{"AAA", "BBB"}, total: 2},
+		{name: "open slots", query: LobbyQuery{Filter: LobbyFilter{OpenSlots: true}}, want: []string{"AAA", "CCC"}, total: 2},
+		{name: "name", query: LobbyQuery{Filter: LobbyFilter{Name: "CASUAL"}}, want: []string{"AAA", "CCC"}, total: 2},
+		{name: "page", query: LobbyQuery{Offset: 1, Limit: 1}, want: []string{"BBB"}, total: 3},
+		{name: "past the end", query: LobbyQuery{Offset: 5, Limit: 1}, want: []string{}, total: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := d.query(tt.query)
+			if got.Total != tt.total {
+				t.Errorf("got total %d, want %d", got.Total, tt.total)
+			}
+			if len(got.Lobbies) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got.Lobbies, tt.want)
+			}
+			for i, code := range tt.want {
+				if got.Lobbies[i].Code != code {
+					t.Errorf("got %s at %d, want %s", got.Lobbies[i].Code, i, code)
+				}
+			}
+		})
+	}
+}
+
+func TestLobbyDirectoryEvents(t *testing.T) {
+	d := newLobbyDirectory()
+	d.subscribe("client1", LobbyQuery{Filter: LobbyFilter{OpenSlots: true}})
+
+	events, _ := d.update(LobbyView{Code: "AAA", MaxClients: 2, NumClients: 1})
+	if ev, ok := events["client1"]; !ok || ev.Kind != LobbyAdded {
+		t.Errorf("got %v, want added event", ev)
+	}
+	events, _ = d.update(LobbyView{Code: "AAA", MaxClients: 2, NumClients: 2})
+	if ev, ok := events["client1"]; !ok || ev.Kind != LobbyRemoved {
+		t.Errorf("got %v, want removed event once the lobby is full", ev)
+	}
+	events, _ = d.update(LobbyView{Code: "AAA", MaxClients: 2, NumClients: 2, Started: true})
+	if _, ok := events["client1"]; ok {
+		t.Error("expected no event for a lobby outside the filter")
+	}
+	events, _ = d.update(LobbyView{Code: "BBB", MaxClients: 2, NumClients: 1})
+	if _, ok := events["client1"]; !ok {
+		t.Fatal("expected an added event for BBB")
+	}
+	events, _ = d.remove("BBB")
+	if ev, ok := events["client1"]; !ok || ev.Kind != LobbyRemoved || ev.Lobby.Code != "BBB" {
+		t.Errorf("got %v, want BBB removed", ev)
+	}
+}
+
+func TestLobbyDirectoryResendsPages(t *testing.T) {
+	d := newLobbyDirectory()
+	d.update(LobbyView{Code: "BBB", MaxClients: 2, NumClients: 1})
+	d.update(LobbyView{Code: "CCC", MaxClients: 2, NumClients: 1})
+	d.subscribe("client1", LobbyQuery{Filter: LobbyFilter{OpenSlots: true}, Limit: 1})
+
+	// a lobby sorting before the page shifts it and grows the total
+	events, pages := d.update(LobbyView{Code: "AAA", MaxClients: 2, NumClients: 1})
+	if len(events) != 0 {
+		t.Errorf("got events %v for a paged subscription", events)
+	}
+	page, ok := pages["client1"]
+	if !ok || page.Total != 3 || len(page.Lobbies) != 1 || page.Lobbies[0].Code != "AAA" {
+		t.Fatalf("got page %+v, want AAA of 3", page)
+	}
+	// a lobby on a later page changing without leaving the filter leaves the page alone
+	if _, pages = d.update(LobbyView{Code: "CCC", Name: "renamed", MaxClients: 2, NumClients: 1}); len(pages) != 0 {
+		t.Errorf("got pages %v for a change off the page", pages)
+	}
+	// a lobby on a later page filling up changes the total
+	_, pages = d.update(LobbyView{Code: "CCC", MaxClients: 2, NumClients: 2})
+	if page := pages["client1"]; page.Total != 2 {
+		t.Errorf("got total %d, want 2 once CCC is full", page.Total)
+	}
+	_, pages = d.remove("AAA")
+	page = pages["client1"]
+	if page.Total != 1 || len(page.Lobbies) != 1 || page.Lobbies[0].Code != "BBB" {
+		t.Errorf("got page %+v, want BBB of 1", page)
+	}
+}
+
+func TestLobbyChangesKeepLatestView(t *testing.T) {
+	c := newLobbyChanges()
+	// nobody takes the changes, publishing must never block a lobby
+	for i := 1; i <= 100; i++ {
+		c.update(LobbyView{Code: "AAA", NumClients: i})
+	}
+	c.update(LobbyView{Code: "BBB", NumClients: 1})
+	c.close("BBB")
+
+	<-c.ready
+	closed, views := c.take()
+	if len(closed) != 1 || closed[0] != "BBB" {
+		t.Errorf("got closed %v, want [BBB]", closed)
+	}
+	if len(views) != 1 || views[0].Code != "AAA" || views[0].NumClients != 100 {
+		t.Errorf("got views %v, want the latest view of AAA only", views)
+	}
+	select {
+	case <-c.ready:
+		t.Error("got signaled with nothing left to take")
+	default:
+	}
+}
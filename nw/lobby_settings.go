@@ -0,0 +1,67 @@
+package nw
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// LobbySettings are the lobby options the owner can change before and during a match.
+type LobbySettings struct {
+	// LateJoin lets clients join after the game has started, they get a fresh entity and a full snapshot
+	LateJoin bool `json:"lateJoin"`
+	// Teams is the number of teams, fewer than two makes the lobby free for all.
+	// It can only change between matches.
+	Teams int `json:"teams,omitempty"`
+	// AutoBalance evens out team sizes when members leave and when a match starts
+	AutoBalance bool `json:"autoBalance,omitempty"`
+	// Mode is the game mode the next match is played in, it can only change between matches
+	Mode string `json:"mode,omitempty"`
+	// VisibilityRadius is how far, in the game's world units, players see around them in games that
+	// manage interest, 0 shows the whole world
+	VisibilityRadius int `json:"visibilityRadius,omitempty"`
+}
+
+// LobbySettingsMessage is sent by the owner to change settings and broadcast by the lobby when they change.
+type LobbySettingsMessage struct {
+	LobbyID  string        `json:"lobbyId"`
+	Settings LobbySettings `json:"settings"`
+	// Modes are the game modes the lobby can switch to, they are filled in by the lobby
+	Modes []string `json:"modes,omitempty"`
+}
+
+type settingsChange struct {
+	clientID string
+	settings LobbySettings
+}
+
+func NewLobbySettingsMessage(f MessageFmt, lsm LobbySettingsMessage) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(lsm)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgLobbySettings, f, data), nil
+}
+
+func LobbySettingsMessageFromMessage(m Message) (LobbySettingsMessage, error) {
+	var lsm LobbySettingsMessage
+	if m.header != MsgLobbySettings {
+		return LobbySettingsMessage{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &lsm); err != nil {
+			return LobbySettingsMessage{}, err
+		}
+	default:
+		return LobbySettingsMessage{}, fmt.Errorf("unsupported message format")
+	}
+	return lsm, nil
+}
@@ -0,0 +1,113 @@
+package nw
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// PlayerResult is one player's standing at the end of a match.
+type PlayerResult struct {
+	ClientID string `json:"clientID"`
+	Score    int    `json:"score"`
+	// Eliminated players rank below everyone still in the game
+	Eliminated bool `json:"eliminated,omitempty"`
+	Team       int  `json:"team,omitempty"`
+	Rank       int  `json:"rank"`
+}
+
+// TeamResult is the combined standing of a team at the end of a match.
+type TeamResult struct {
+	Team  int `json:"team"`
+	Score int `json:"score"`
+	Rank  int `json:"rank"`
+}
+
+// GameOver is reported by a StateManager when its end condition is met and broadcast with MsgGameOver.
+type GameOver struct {
+	LobbyID string         `json:"lobbyID"`
+	Reason  string         `json:"reason"`
+	Results []PlayerResult `json:"results"`
+	// Teams is empty unless the match was played in teams
+	Teams []TeamResult `json:"teams,omitempty"`
+}
+
+// RankResults sorts results best first and fills in their rank, tied players share a rank.
+func RankResults(results []PlayerResult) {
+	better := func(a, b PlayerResult) bool {
+		if a.Eliminated != b.Eliminated {
+			return !a.Eliminated
+		}
+		return a.Score > b.Score
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return better(results[i], results[j])
+	})
+	for i := range results {
+		if i > 0 && !better(results[i-1], results[i]) {
+			results[i].Rank = results[i-1].Rank
+			continue
+		}
+		results[i].Rank = i + 1
+	}
+}
+
+// RankTeams sums the scores of the players of every team and ranks the teams best first.
+func RankTeams(results []PlayerResult) []TeamResult {
+	scores := make(map[int]int)
+	for _, r := range results {
+		if r.Team > 0 {
+			scores[r.Team] += r.Score
+		}
+	}
+	teams := make([]TeamResult, 0, len(scores))
+	for team, score := range scores {
+		teams = append(teams, TeamResult{Team: team, Score: score})
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		if teams[i].Score != teams[j].Score {
+			return teams[i].Score > teams[j].Score
+		}
+		return teams[i].Team < teams[j].Team
+	})
+	for i := range teams {
+		if i > 0 && teams[i-1].Score == teams[i].Score {
+			teams[i].Rank = teams[i-1].Rank
+			continue
+		}
+		teams[i].Rank = i + 1
+	}
+	return teams
+}
+
+func NewGameOverMessage(f MessageFmt, over GameOver) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(over)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgGameOver, f, data), nil
+}
+
+func GameOverFromMessage(m Message) (GameOver, error) {
+	var over GameOver
+	if m.header != MsgGameOver {
+		return GameOver{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &over); err != nil {
+			return GameOver{}, err
+		}
+	default:
+		return GameOver{}, fmt.Errorf("unsupported message format")
+	}
+	return over, nil
+}
@@ -0,0 +1,45 @@
+package nw
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRankResults(t *testing.T) {
+	results := []PlayerResult{
+		{ClientID: "a", Score: 3},
+		{ClientID: "b", Score: 9, Eliminated: true},
+		{ClientID: "c", Score: 5},
+		{ClientID: "d", Score: 3},
+	}
+	RankResults(results)
+
+	want := []PlayerResult{
+		{ClientID: "c", Score: 5, Rank: 1},
+		{ClientID: "a", Score: 3, Rank: 2},
+		{ClientID: "d", Score: 3, Rank: 2},
+		{ClientID: "b", Score: 9, Eliminated: true, Rank: 4},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("got %+v, want %+v", results, want)
+	}
+}
+
+func TestRankTeams(t *testing.T) {
+	results := []PlayerResult{
+		{ClientID: "a", Score: 3, Team: 1},
+		{ClientID: "b", Score: 4, Team: 2},
+		{ClientID: "c", Score: 2, Team: 1},
+		{ClientID: "d", Score: 5, Team: 3},
+	}
+	got := RankTeams(results)
+
+	want := []TeamResult{
+		{Team: 1, Score: 5, Rank: 1},
+		{Team: 3, Score: 5, Rank: 1},
+		{Team: 2, Score: 4, Rank: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+package nw
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	defaultMatchmakeTimeout      = 30 * time.Second
+	defaultMatchmakeMinGroupSize = 2
+	matchmakeInterval            = time.Second
+)
+
+// MatchmakeRequest is sent by a client with MsgMatchmake to enter the quick play queue.
+type MatchmakeRequest struct {
+	GameType string `json:"gameType"`
+	// GroupSize is the number of players the client would like to play with, itself included
+	GroupSize int `json:"groupSize"`
+}
+
+type MatchmakeState uint8
+
+const (
+	MatchmakeQueued MatchmakeState = iota
+	MatchmakeMatched
+	MatchmakeCancelled
+)
+
+// MatchmakeStatus is sent by the server with MsgMatchmakeStatus whenever a client's ticket changes.
+type MatchmakeStatus struct {
+	State         MatchmakeState `json:"state"`
+	Position      int            `json:"position"`
+	EstimatedWait time.Duration  `json:"estimatedWait"`
+	LobbyID       string         `json:"lobbyId,omitempty"`
+}
+
+type matchKey struct {
+	gameType  string
+	groupSize int
+}
+
+type matchTicket struct {
+	client *client
+	// party are the members queued along with the client, who leads their party
+	party    []*client
+	key      matchKey
+	queuedAt time.Time
+}
+
+// size is the number of players the ticket places.
+func (t *matchTicket) size() int {
+	return 1 + len(t.party)
+}
+
+// clients returns everyone the ticket places, the client first.
+func (t *matchTicket) clients() []*client {
+	return append([]*client{t.client}, t.party...)
+}
+
+// takeTickets picks tickets from the front of queue in order, skipping those that would not fit,
+// until they place capacity players. It returns the picked tickets, their size and the rest of the queue.
+func takeTickets(queue []*matchTicket, capacity int) (taken []*matchTicket, size int, rest []*matchTicket) {
+	for _, t := range queue {
+		if size+t.size() > capacity {
+			rest = append(rest, t)
+			continue
+		}
+		taken = append(taken, t)
+		size += t.size()
+	}
+	return taken, size, rest
+}
+
+// match is a group of tickets that should be placed together.
+// An empty lobbyCode means a new lobby has to be created for them.
+type match struct {
+	lobbyCode string
+	key       matchKey
+	tickets   []*matchTicket
+}
+
+// matchmaker holds the quick play queues. It is owned by the Server loop goroutine.
+type matchmaker struct {
+	queues       map[matchKey][]*matchTicket
+	byClient     map[string]matchKey
+	timeout      time.Duration
+	minGroupSize int
+	// avgWait is a moving average of how long matched tickets waited, per game type
+	avgWait map[string]time.Duration
+}
+
+func newMatchmaker(timeout time.Duration, minGroupSize int) *matchmaker {
+	return &matchmaker{
+		queues:       make(map[matchKey][]*matchTicket),
+		byClient:     make(map[string]matchKey),
+		timeout:      timeout,
+		minGroupSize: minGroupSize,
+		avgWait:      make(map[string]time.Duration),
+	}
+}
+
+// enqueue adds the ticket to its queue, replacing any ticket the client already had,
+// and returns the client's position in the queue.
+func (m *matchmaker) enqueue(t *matchTicket) int {
+	m.cancel(t.client.ID)
+	// a party never gets split up
+	if t.key.groupSize < t.size() {
+		t.key.groupSize = t.size()
+	}
+	m.queues[t.key] = append(m.queues[t.key], t)
+	m.byClient[t.client.ID] = t.key
+	return len(m.queues[t.key])
+}
+
+func (m *matchmaker) cancel(clientID string) bool {
+	key, ok := m.byClient[clientID]
+	if !ok {
+		return false
+	}
+	delete(m.byClient, clientID)
+	queue := m.queues[key]
+	for i, t := range queue {
+		if t.client.ID == clientID {
+			m.queues[key] = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(m.queues[key]) == 0 {
+		delete(m.queues, key)
+	}
+	return true
+}
+
+// estimate returns the expected wait for a new ticket of the given game type.
+func (m *matchmaker) estimate(gameType string) time.Duration {
+	if wait, ok := m.avgWait[gameType]; ok {
+		return wait
+	}
+	return m.timeout
+}
+
+// matches pulls every ticket that can be placed right now out of the queues.
+// Tickets first fill open lobbies of their game type, then form new lobbies of their group size,
+// and once the oldest ticket waited longer than the timeout a smaller group of at least minGroupSize is formed.
+// Party tickets are placed whole, tickets that do not fit wait for the next lobby.
+func (m *matchmaker) matches(now time.Time, open []LobbyView) []match {
+	free := make(map[string]int, len(open))
+	for _, v := range open {
+		if !v.Started && v.MaxClients > v.NumClients {
+			free[v.Code] = v.MaxClients - v.NumClients
+		}
+	}
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].Code < open[j].Code
+	})
+
+	keys := make([]matchKey, 0, len(m.queues))
+	for key := range m.queues {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].gameType != keys[j].gameType {
+			return keys[i].gameType < keys[j].gameType
+		}
+		return keys[i].groupSize < keys[j].groupSize
+	})
+
+	var out []match
+	for _, key := range keys {
+		queue := m.queues[key]
+		for _, v := range open {
+			if len(queue) == 0 {
+				break
+			}
+			if v.GameType != key.gameType || free[v.Code] == 0 {
+				continue
+			}
+			taken, n, rest := takeTickets(queue, free[v.Code])
+			if len(taken) == 0 {
+				continue
+			}
+			free[v.Code] -= n
+			out = append(out, match{lobbyCode: v.Code, key: key, tickets: taken})
+			queue = rest
+		}
+		for {
+			taken, n, rest := takeTickets(queue, key.groupSize)
+			if n < key.groupSize {
+				break
+			}
+			out = append(out, match{key: key, tickets: taken})
+			queue = rest
+		}
+		if len(queue) > 0 && now.Sub(queue[0].queuedAt) >= m.timeout {
+			if taken, n, rest := takeTickets(queue, key.groupSize); n >= m.minGroupSize {
+				out = append(out, match{key: key, tickets: taken})
+				queue = rest
+			}
+		}
+		if len(queue) == 0 {
+			delete(m.queues, key)
+		} else {
+			m.queues[key] = queue
+		}
+	}
+
+	for _, mt := range out {
+		for _, t := range mt.tickets {
+			delete(m.byClient, t.client.ID)
+			m.recordWait(t.key.gameType, now.Sub(t.queuedAt))
+		}
+	}
+	return out
+}
+
+func (m *matchmaker) recordWait(gameType string, wait time.Duration) {
+	avg, ok := m.avgWait[gameType]
+	if !ok {
+		m.avgWait[gameType] = wait
+		return
+	}
+	// exponential moving average weighted towards recent matches
+	m.avgWait[gameType] = (avg*3 + wait) / 4
+}
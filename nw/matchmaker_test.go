@@ -0,0 +1,136 @@
+package nw
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestTicket(id, gameType string, groupSize int, queuedAt time.Time) *matchTicket {
+	return &matchTicket{
+		client:   &client{ID: id},
+		key:      matchKey{gameType: gameType, groupSize: groupSize},
+		queuedAt: queuedAt,
+	}
+}
+
+// newTestPartyTicket queues a party of size players led by id.
+func newTestPartyTicket(id, gameType string, groupSize, size int, queuedAt time.Time) *matchTicket {
+	t := newTestTicket(id, gameType, groupSize, queuedAt)
+	for i := 1; i < size; i++ {
+		t.party = append(t.party, &client{ID: fmt.Sprintf("%s%d", id, i)})
+	}
+	return t
+}
+
+func TestMatchmakerMatches(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		tickets []*matchTicket
+		open    []LobbyView
+		at      time.Time
+		want    []int
+		lobbies []string
+	}{
+		{
+			name: "full group forms a new lobby",
+			tickets: []*matchTicket{
+				newTestTicket("a", "snake", 2, now),
+				newTestTicket("b", "snake", 2, now),
+				newTestTicket("c", "snake", 2, now),
+			},
+			at:      now,
+			want:    []int{2},
+			lobbies: []string{""},
+		},
+		{
+			name: "open lobby is filled first",
+			tickets: []*matchTicket{
+				newTestTicket("a", "snake", 2, now),
+				newTestTicket("b", "snake", 2, now),
+			},
+			open:    []LobbyView{{Code: "OPEN", GameType: "snake", MaxClients: 4, NumClients: 3}},
+			at:      now,
+			want:    []int{1},
+			lobbies: []string{"OPEN"},
+		},
+		{
+			name: "other game types are ignored",
+			tickets: []*matchTicket{
+				newTestTicket("a", "snake", 3, now),
+			},
+			open: []LobbyView{{Code: "OPEN", GameType: "knight", MaxClients: 4, NumClients: 1}},
+			at:   now,
+		},
+		{
+			name: "timeout falls back to a smaller match",
+			tickets: []*matchTicket{
+				newTestTicket("a", "snake", 4, now),
+				newTestTicket("b", "snake", 4, now),
+			},
+			at:      now.Add(time.Minute),
+			want:    []int{2},
+			lobbies: []string{""},
+		},
+		{
+			name: "party is not split to fill an open lobby",
+			tickets: []*matchTicket{
+				newTestPartyTicket("a", "snake", 4, 2, now),
+			},
+			open: []LobbyView{{Code: "OPEN", GameType: "snake", MaxClients: 4, NumClients: 3}},
+			at:   now,
+		},
+		{
+			name: "party and a single player make a group",
+			tickets: []*matchTicket{
+				newTestPartyTicket("a", "snake", 4, 3, now),
+				newTestPartyTicket("b", "snake", 4, 2, now),
+				newTestTicket("c", "snake", 4, now),
+			},
+			at:      now,
+			want:    []int{2},
+			lobbies: []string{""},
+		},
+		{
+			name: "timeout respects the minimum group size",
+			tickets: []*matchTicket{
+				newTestTicket("a", "snake", 4, now),
+			},
+			at: now.Add(time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMatchmaker(30*time.Second, 2)
+			for _, ticket := range tt.tickets {
+				m.enqueue(ticket)
+			}
+			got := m.matches(tt.at, tt.open)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d matches, want %d", len(got), len(tt.want))
+			}
+			for i, mt := range got {
+				if len(mt.tickets) != tt.want[i] || mt.lobbyCode != tt.lobbies[i] {
+					t.Errorf("got match of %d in %q, want %d in %q", len(mt.tickets), mt.lobbyCode, tt.want[i], tt.lobbies[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMatchmakerCancel(t *testing.T) {
+	m := newMatchmaker(time.Second, 2)
+	now := time.Now()
+	m.enqueue(newTestTicket("a", "snake", 2, now))
+	if pos := m.enqueue(newTestTicket("b", "snake", 2, now)); pos != 2 {
+		t.Errorf("got position %d, want 2", pos)
+	}
+	if !m.cancel("a") || m.cancel("a") {
+		t.Error("expected a single successful cancel")
+	}
+	if got := m.matches(now, nil); len(got) != 0 {
+		t.Errorf("got %d matches, want none after cancel", len(got))
+	}
+}
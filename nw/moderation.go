@@ -0,0 +1,330 @@
+package nw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	quic "github.com/quic-go/quic-go"
+)
+
+// bannedErrorCode is the application error code connections of banned clients are closed with.
+const bannedErrorCode quic.ApplicationErrorCode = 0x42
+
+// ipBanPrefix marks a ban target as an IP address, the ban then matches every client connecting from it.
+const ipBanPrefix = "ip:"
+
+// KickRequest asks to remove a member from a lobby, it is sent by the lobby owner or a moderator.
+type KickRequest struct {
+	LobbyID  string `json:"lobbyID"`
+	ClientID string `json:"clientID"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Kicked tells a client why it was removed from a lobby and until when it cannot rejoin.
+type Kicked struct {
+	LobbyID string `json:"lobbyID"`
+	Reason  string `json:"reason,omitempty"`
+	// BannedUntil is the zero time when the client may rejoin right away
+	BannedUntil time.Time `json:"bannedUntil"`
+}
+
+type kickRequest struct {
+	kickerID string
+	// moderator kicks are accepted from anyone, not only the owner
+	moderator bool
+	request   KickRequest
+}
+
+// Ban keeps a player off the server.
+type Ban struct {
+	// Target is a client ID, or ipBanPrefix followed by an IP address
+	Target string `json:"target"`
+	Reason string `json:"reason,omitempty"`
+	// Until is when the ban expires, the zero time never does
+	Until time.Time `json:"until"`
+}
+
+func (b Ban) expired(now time.Time) bool {
+	return !b.Until.IsZero() && !now.Before(b.Until)
+}
+
+// banTargets returns the targets a server ban can match a client by: its ID and its IP.
+func banTargets(clientID string) []string {
+	host, _, err := net.SplitHostPort(clientID)
+	if err != nil {
+		return []string{clientID}
+	}
+	return []string{clientID, ipBanPrefix + host}
+}
+
+// accessFile is the on disk format of an accessList.
+type accessFile struct {
+	Bans       []Ban    `json:"bans"`
+	Moderators []string `json:"moderators"`
+}
+
+// accessList holds the server wide bans and moderators and saves every change to path.
+// It is shared by the server loop, the client readers and the admin interface.
+type accessList struct {
+	mu         sync.Mutex
+	path       string
+	bans       map[string]Ban
+	moderators map[string]bool
+}
+
+func newAccessList() *accessList {
+	return &accessList{bans: make(map[string]Ban), moderators: make(map[string]bool)}
+}
+
+// loadAccessList reads the access list saved at path, a missing file is an empty list.
+// A file that cannot be read is left alone, the returned list is then kept in memory only.
+func loadAccessList(path string) (*accessList, error) {
+	a := newAccessList()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		a.path = path
+		return a, nil
+	}
+	if err != nil {
+		return a, err
+	}
+	var f accessFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return a, fmt.Errorf("reading %s: %w", path, err)
+	}
+	a.path = path
+	for _, b := range f.Bans {
+		a.bans[b.Target] = b
+	}
+	for _, m := range f.Moderators {
+		a.moderators[m] = true
+	}
+	return a, nil
+}
+
+// save writes the list to its file, it must be called with mu held.
+func (a *accessList) save() error {
+	if a.path == "" {
+		return nil
+	}
+	f := accessFile{Bans: a.sortedBans(), Moderators: a.sortedModerators()}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write next to the file and rename so a crash never leaves half a list behind
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), filepath.Base(a.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), a.path)
+}
+
+func (a *accessList) sortedBans() []Ban {
+	bans := make([]Ban, 0, len(a.bans))
+	for _, b := range a.bans {
+		bans = append(bans, b)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Target < bans[j].Target
+	})
+	return bans
+}
+
+func (a *accessList) sortedModerators() []string {
+	moderators := make([]string, 0, len(a.moderators))
+	for m := range a.moderators {
+		moderators = append(moderators, m)
+	}
+	sort.Strings(moderators)
+	return moderators
+}
+
+func (a *accessList) ban(b Ban) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.bans[b.Target] = b
+	return a.save()
+}
+
+// unban lifts the ban on target and reports whether there was one.
+func (a *accessList) unban(target string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.bans[target]; !ok {
+		return false, nil
+	}
+	delete(a.bans, target)
+	return true, a.save()
+}
+
+// banned returns the ban keeping clientID off the server, expired bans are dropped on the way.
+func (a *accessList) banned(clientID string, now time.Time) (Ban, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, target := range banTargets(clientID) {
+		b, ok := a.bans[target]
+		if !ok {
+			continue
+		}
+		if b.expired(now) {
+			// the file catches up with the next change
+			delete(a.bans, target)
+			continue
+		}
+		return b, true
+	}
+	return Ban{}, false
+}
+
+// list returns the bans that have not expired by now, ordered by target.
+func (a *accessList) list(now time.Time) []Ban {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	bans := a.sortedBans()
+	active := bans[:0]
+	for _, b := range bans {
+		if !b.expired(now) {
+			active = append(active, b)
+		}
+	}
+	return active
+}
+
+func (a *accessList) setModerator(target string, moderator bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.moderators[target] == moderator {
+		return nil
+	}
+	if moderator {
+		a.moderators[target] = true
+	} else {
+		delete(a.moderators, target)
+	}
+	return a.save()
+}
+
+func (a *accessList) isModerator(clientID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.moderators[clientID]
+}
+
+func (a *accessList) listModerators() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sortedModerators()
+}
+
+// lobbyBans are the temporary bans of a lobby, keyed by client ID.
+// They are owned by the lobby's handleLobbyActions goroutine.
+type lobbyBans map[string]time.Time
+
+func (b lobbyBans) add(clientID string, until time.Time) {
+	b[clientID] = until
+}
+
+// until returns when the ban on clientID ends, or the zero time if it is not banned.
+func (b lobbyBans) until(clientID string, now time.Time) time.Time {
+	end, ok := b[clientID]
+	if !ok {
+		return time.Time{}
+	}
+	if !now.Before(end) {
+		delete(b, clientID)
+		return time.Time{}
+	}
+	return end
+}
+
+func NewKickRequestMessage(f MessageFmt, kr KickRequest) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(kr)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgLobbyKick, f, data), nil
+}
+
+func KickRequestFromMessage(m Message) (KickRequest, error) {
+	var kr KickRequest
+	if m.header != MsgLobbyKick {
+		return KickRequest{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &kr); err != nil {
+			return KickRequest{}, err
+		}
+	default:
+		return KickRequest{}, fmt.Errorf("unsupported message format")
+	}
+	return kr, nil
+}
+
+func NewKickedMessage(f MessageFmt, k Kicked) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(k)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgLobbyKicked, f, data), nil
+}
+
+func KickedFromMessage(m Message) (Kicked, error) {
+	var k Kicked
+	if m.header != MsgLobbyKicked {
+		return Kicked{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &k); err != nil {
+			return Kicked{}, err
+		}
+	default:
+		return Kicked{}, fmt.Errorf("unsupported message format")
+	}
+	return k, nil
+}
+
+// banMessage is the reason a banned client's connection is closed with.
+func banMessage(b Ban) string {
+	msg := "banned"
+	if b.Reason != "" {
+		msg += ": " + b.Reason
+	}
+	if !b.Until.IsZero() {
+		msg += fmt.Sprintf(" (until %s)", b.Until.Format(time.RFC3339))
+	}
+	return msg
+}
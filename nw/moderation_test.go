@@ -0,0 +1,101 @@
+package nw
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAccessListPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	now := time.Now()
+	a, err := loadAccessList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ban(Ban{Target: "ip:10.0.0.7", Reason: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ban(Ban{Target: "10.0.0.8:5000", Until: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.setModerator("10.0.0.9:4242", true); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadAccessList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(loaded.list(now)); got != 2 {
+		t.Fatalf("got %d bans after reload, want 2", got)
+	}
+	if b, ok := loaded.banned("10.0.0.7:1234", now); !ok || b.Reason != "spam" {
+		t.Errorf("IP ban did not match a client from that IP: %v %v", b, ok)
+	}
+	if _, ok := loaded.banned("10.0.0.8:5001", now); ok {
+		t.Error("client ID ban matched another client from the same IP")
+	}
+	if _, ok := loaded.banned("10.0.0.8:5000", now.Add(2*time.Hour)); ok {
+		t.Error("expired ban still matched")
+	}
+	if !loaded.isModerator("10.0.0.9:4242") {
+		t.Error("moderator lost after reload")
+	}
+	if loaded.isModerator("10.0.0.9:4243") {
+		t.Error("moderator role granted to another client from the same IP")
+	}
+	if ok, err := loaded.unban("ip:10.0.0.7"); !ok || err != nil {
+		t.Fatalf("unban: %v %v", ok, err)
+	}
+	if _, ok := loaded.banned("10.0.0.7:1234", now); ok {
+		t.Error("unbanned client still banned")
+	}
+}
+
+func TestAccessListLeavesUnreadableFileAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := loadAccessList(path)
+	if err == nil {
+		t.Fatal("loaded a malformed file without an error")
+	}
+	if err := a.ban(Ban{Target: "10.0.0.7:1234"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.banned("10.0.0.7:1234", time.Now()); !ok {
+		t.Error("ban not kept in memory")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "{not json" {
+		t.Errorf("got file %q %v, want it left alone", data, err)
+	}
+}
+
+func TestLobbyBans(t *testing.T) {
+	now := time.Now()
+	bans := make(lobbyBans)
+	bans.add("10.0.0.7:1234", now.Add(time.Minute))
+
+	tests := []struct {
+		name     string
+		clientID string
+		at       time.Time
+		banned   bool
+	}{
+		{name: "same client", clientID: "10.0.0.7:1234", at: now, banned: true},
+		{name: "other client from the same IP", clientID: "10.0.0.7:999", at: now},
+		{name: "other IP", clientID: "10.0.0.8:1234", at: now},
+		{name: "expired", clientID: "10.0.0.7:1234", at: now.Add(time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := !bans.until(tt.clientID, tt.at).IsZero(); got != tt.banned {
+				t.Errorf("got banned %v, want %v", got, tt.banned)
+			}
+		})
+	}
+}
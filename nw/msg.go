@@ -8,7 +8,10 @@ import (
 )
 
 const (
-	MaxMessageSize = 1024
+	// MaxMessageSize is the largest payload a message can carry, its size is sent as a uint16
+	MaxMessageSize = 1<<16 - 1
+	// headerSize is the size of the header, format and payload size that precede the payload
+	headerSize = 4
 )
 
 const (
@@ -36,17 +39,17 @@ func (m Message) HexString() string {
 }
 
 func (m *Message) Pack() []byte {
-	buf := make([]byte, 5+len(m.data.Data))
+	buf := make([]byte, headerSize+len(m.data.Data))
 	buf[0] = byte(m.header)
 	buf[1] = byte(m.data.Fmt)
 	buf[2] = byte(m.data.Size >> 8)
 	buf[3] = byte(m.data.Size)
-	copy(buf[4:], m.data.Data)
+	copy(buf[headerSize:], m.data.Data)
 	return append(buf, MsgEnd)
 }
 
 func (m *Message) Unpack(buf []byte) error {
-	if len(buf) < 4 {
+	if len(buf) < headerSize {
 		return fmt.Errorf("invalid message buffer")
 	}
 
@@ -54,7 +57,7 @@ func (m *Message) Unpack(buf []byte) error {
 	m.data.Fmt = MessageFmt(buf[1])
 	m.data.Size = uint16(buf[2])<<8 | uint16(buf[3])
 	m.data.Data = make([]byte, m.data.Size)
-	copy(m.data.Data, buf[4:])
+	copy(m.data.Data, buf[headerSize:])
 
 	return nil
 }
@@ -70,19 +73,32 @@ func (f MessageHandlerFunc) Handle(m Message) error {
 }
 
 func (m Message) EncodeTo(w io.Writer) error {
+	if len(m.data.Data) > MaxMessageSize {
+		return fmt.Errorf("message payload of %d bytes exceeds %d", len(m.data.Data), MaxMessageSize)
+	}
 	if _, err := w.Write(m.Pack()); err != nil {
 		return err
 	}
 	return nil
 }
+
+// DecodeFrom reads exactly one message from r.
+// Streams deliver bytes without message boundaries, so the payload size in the header is used to frame it.
 func (m *Message) DecodeFrom(r io.Reader) error {
-	buf := make([]byte, MaxMessageSize)
-	n, err := r.Read(buf)
-	if err != nil {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
 		return err
 	}
-	m.Unpack(buf[:n])
-	return nil
+	size := int(header[2])<<8 | int(header[3])
+	buf := make([]byte, headerSize+size+1)
+	copy(buf, header)
+	if _, err := io.ReadFull(r, buf[headerSize:]); err != nil {
+		return err
+	}
+	if buf[len(buf)-1] != MsgEnd {
+		return fmt.Errorf("message is missing its end marker")
+	}
+	return m.Unpack(buf[:len(buf)-1])
 }
 
 func NewMessage(header MessageHeader, fmt MessageFmt, data []byte) Message {
@@ -182,12 +198,20 @@ func NewGameStateMessage(f MessageFmt, state any) (Message, error) {
 	return NewMessage(MsgServerState, f, data), nil
 }
 
-func NewLobbiesSyncMessage(f MessageFmt, lobbies []string) (Message, error) {
+func NewLobbiesSyncMessage(f MessageFmt, q LobbyQuery) (Message, error) {
+	return newLobbyQueryMessage(MsgLobbiesSync, f, q)
+}
+
+func NewLobbiesSubscribeMessage(f MessageFmt, q LobbyQuery) (Message, error) {
+	return newLobbyQueryMessage(MsgLobbiesSubscribe, f, q)
+}
+
+func newLobbyQueryMessage(header MessageHeader, f MessageFmt, q LobbyQuery) (Message, error) {
 	var data []byte
 	switch f {
 	case FmtJSON:
 		var err error
-		data, err = json.Marshal(lobbies)
+		data, err = json.Marshal(q)
 		if err != nil {
 			return Message{}, err
 		}
@@ -195,7 +219,39 @@ func NewLobbiesSyncMessage(f MessageFmt, lobbies []string) (Message, error) {
 		return Message{}, fmt.Errorf("unsupported message format")
 	}
 
-	return NewMessage(MsgLobbiesSync, f, data), nil
+	return NewMessage(header, f, data), nil
+}
+
+func NewLobbyEventMessage(f MessageFmt, ev LobbyEvent) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(ev)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgLobbyEvent, f, data), nil
+}
+
+func LobbyEventFromMessage(m Message) (LobbyEvent, error) {
+	var ev LobbyEvent
+	if m.header != MsgLobbyEvent {
+		return LobbyEvent{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &ev); err != nil {
+			return LobbyEvent{}, err
+		}
+	default:
+		return LobbyEvent{}, fmt.Errorf("unsupported message format")
+	}
+	return ev, nil
 }
 
 func ServerStateMessageFromMessage[T any](m Message) (ServerStateMessage[T], error) {
@@ -215,12 +271,13 @@ func ServerStateMessageFromMessage[T any](m Message) (ServerStateMessage[T], err
 	return ssm, nil
 }
 
-func NewClientInputMessage(f MessageFmt, ci ClientInput) (Message, error) {
+// NewClientInputMessage makes an input message, it carries the inputs of a client oldest first.
+func NewClientInputMessage[I any](f MessageFmt, inputs []ClientInput[I]) (Message, error) {
 	var data []byte
 	switch f {
 	case FmtJSON:
 		var err error
-		data, err = json.Marshal(ci)
+		data, err = json.Marshal(inputs)
 		if err != nil {
 			return Message{}, err
 		}
@@ -231,3 +288,83 @@ func NewClientInputMessage(f MessageFmt, ci ClientInput) (Message, error) {
 	return NewMessage(MsgClientInput, f, data), nil
 
 }
+
+func NewChatMessage(f MessageFmt, cm ChatMessage) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(cm)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgChat, f, data), nil
+}
+
+func ChatMessageFromMessage(m Message) (ChatMessage, error) {
+	var cm ChatMessage
+	if m.header != MsgChat {
+		return ChatMessage{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &cm); err != nil {
+			return ChatMessage{}, err
+		}
+	default:
+		return ChatMessage{}, fmt.Errorf("unsupported message format")
+	}
+	return cm, nil
+}
+
+func NewMatchmakeMessage(f MessageFmt, req MatchmakeRequest) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(req)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgMatchmake, f, data), nil
+}
+
+func NewMatchmakeStatusMessage(f MessageFmt, status MatchmakeStatus) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(status)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgMatchmakeStatus, f, data), nil
+}
+
+func ClientInputsFromMessage[I any](m Message) ([]ClientInput[I], error) {
+	var inputs []ClientInput[I]
+	if m.header != MsgClientInput {
+		return nil, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &inputs); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported message format")
+	}
+	return inputs, nil
+}
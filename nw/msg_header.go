@@ -24,6 +24,33 @@ MsgLobbyKick
 MsgLobbyKicked
 MsgClientInput
 MsgServerState
+MsgChat
+MsgLobbiesSubscribe
+MsgLobbiesUnsubscribe
+MsgLobbyEvent
+MsgMatchmake
+MsgMatchmakeCancel
+MsgMatchmakeStatus
+MsgLobbySpectate
+MsgLobbySettings
+MsgLobbyJoinRejected
+MsgGameOver
+MsgProfile
+MsgProfileRejected
+MsgLobbyTeam
+MsgGamePause
+MsgGameResume
+MsgLobbyCountdownCancelled
+MsgVoteCall
+MsgVoteCast
+MsgVoteStatus
+MsgPartyCreate
+MsgPartyInvite
+MsgPartyJoin
+MsgPartyLeave
+MsgPartySync
+MsgPartyRejected
+MsgGameEvent
 )
 */
 type MessageHeader uint8
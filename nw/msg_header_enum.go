@@ -54,32 +54,113 @@ const (
 	MsgClientInput
 	// MsgServerState is a MessageHeader of type MsgServerState.
 	MsgServerState
+	// MsgChat is a MessageHeader of type MsgChat.
+	MsgChat
+	// MsgLobbiesSubscribe is a MessageHeader of type MsgLobbiesSubscribe.
+	MsgLobbiesSubscribe
+	// MsgLobbiesUnsubscribe is a MessageHeader of type MsgLobbiesUnsubscribe.
+	MsgLobbiesUnsubscribe
+	// MsgLobbyEvent is a MessageHeader of type MsgLobbyEvent.
+	MsgLobbyEvent
+	// MsgMatchmake is a MessageHeader of type MsgMatchmake.
+	MsgMatchmake
+	// MsgMatchmakeCancel is a MessageHeader of type MsgMatchmakeCancel.
+	MsgMatchmakeCancel
+	// MsgMatchmakeStatus is a MessageHeader of type MsgMatchmakeStatus.
+	MsgMatchmakeStatus
+	// MsgLobbySpectate is a MessageHeader of type MsgLobbySpectate.
+	MsgLobbySpectate
+	// MsgLobbySettings is a MessageHeader of type MsgLobbySettings.
+	MsgLobbySettings
+	// MsgLobbyJoinRejected is a MessageHeader of type MsgLobbyJoinRejected.
+	MsgLobbyJoinRejected
+	// MsgGameOver is a MessageHeader of type MsgGameOver.
+	MsgGameOver
+	// MsgProfile is a MessageHeader of type MsgProfile.
+	MsgProfile
+	// MsgProfileRejected is a MessageHeader of type MsgProfileRejected.
+	MsgProfileRejected
+	// MsgLobbyTeam is a MessageHeader of type MsgLobbyTeam.
+	MsgLobbyTeam
+	// MsgGamePause is a MessageHeader of type MsgGamePause.
+	MsgGamePause
+	// MsgGameResume is a MessageHeader of type MsgGameResume.
+	MsgGameResume
+	// MsgLobbyCountdownCancelled is a MessageHeader of type MsgLobbyCountdownCancelled.
+	MsgLobbyCountdownCancelled
+	// MsgVoteCall is a MessageHeader of type MsgVoteCall.
+	MsgVoteCall
+	// MsgVoteCast is a MessageHeader of type MsgVoteCast.
+	MsgVoteCast
+	// MsgVoteStatus is a MessageHeader of type MsgVoteStatus.
+	MsgVoteStatus
+	// MsgPartyCreate is a MessageHeader of type MsgPartyCreate.
+	MsgPartyCreate
+	// MsgPartyInvite is a MessageHeader of type MsgPartyInvite.
+	MsgPartyInvite
+	// MsgPartyJoin is a MessageHeader of type MsgPartyJoin.
+	MsgPartyJoin
+	// MsgPartyLeave is a MessageHeader of type MsgPartyLeave.
+	MsgPartyLeave
+	// MsgPartySync is a MessageHeader of type MsgPartySync.
+	MsgPartySync
+	// MsgPartyRejected is a MessageHeader of type MsgPartyRejected.
+	MsgPartyRejected
+	// MsgGameEvent is a MessageHeader of type MsgGameEvent.
+	MsgGameEvent
 )
 
-const _MessageHeaderName = "MsgAuthMsgAuthAckMsgConnectMsgDisconnectMsgLobbyCreateMsgLobbyCreatedMsgLobbyDeletedMsgLobbyGameStartMsgLobbyGameStartedMsgLobbyClientsNotReadyMsgLobbyClientReadyMsgLobbyClientJoinMsgLobbyClientLeaveMsgLobbiesSyncMsgLobbiesSyncedMsgLobbyPromoteMsgLobbyPromotedMsgLobbyKickMsgLobbyKickedMsgClientInputMsgServerState"
+const _MessageHeaderName = "MsgAuthMsgAuthAckMsgConnectMsgDisconnectMsgLobbyCreateMsgLobbyCreatedMsgLobbyDeletedMsgLobbyGameStartMsgLobbyGameStartedMsgLobbyClientsNotReadyMsgLobbyClientReadyMsgLobbyClientJoinMsgLobbyClientLeaveMsgLobbiesSyncMsgLobbiesSyncedMsgLobbyPromoteMsgLobbyPromotedMsgLobbyKickMsgLobbyKickedMsgClientInputMsgServerStateMsgChatMsgLobbiesSubscribeMsgLobbiesUnsubscribeMsgLobbyEventMsgMatchmakeMsgMatchmakeCancelMsgMatchmakeStatusMsgLobbySpectateMsgLobbySettingsMsgLobbyJoinRejectedMsgGameOverMsgProfileMsgProfileRejectedMsgLobbyTeamMsgGamePauseMsgGameResumeMsgLobbyCountdownCancelledMsgVoteCallMsgVoteCastMsgVoteStatusMsgPartyCreateMsgPartyInviteMsgPartyJoinMsgPartyLeaveMsgPartySyncMsgPartyRejectedMsgGameEvent"
 
 var _MessageHeaderMap = map[MessageHeader]string{
-	MsgAuth:                 _MessageHeaderName[0:7],
-	MsgAuthAck:              _MessageHeaderName[7:17],
-	MsgConnect:              _MessageHeaderName[17:27],
-	MsgDisconnect:           _MessageHeaderName[27:40],
-	MsgLobbyCreate:          _MessageHeaderName[40:54],
-	MsgLobbyCreated:         _MessageHeaderName[54:69],
-	MsgLobbyDeleted:         _MessageHeaderName[69:84],
-	MsgLobbyGameStart:       _MessageHeaderName[84:101],
-	MsgLobbyGameStarted:     _MessageHeaderName[101:120],
-	MsgLobbyClientsNotReady: _MessageHeaderName[120:143],
-	MsgLobbyClientReady:     _MessageHeaderName[143:162],
-	MsgLobbyClientJoin:      _MessageHeaderName[162:180],
-	MsgLobbyClientLeave:     _MessageHeaderName[180:199],
-	MsgLobbiesSync:          _MessageHeaderName[199:213],
-	MsgLobbiesSynced:        _MessageHeaderName[213:229],
-	MsgLobbyPromote:         _MessageHeaderName[229:244],
-	MsgLobbyPromoted:        _MessageHeaderName[244:260],
-	MsgLobbyKick:            _MessageHeaderName[260:272],
-	MsgLobbyKicked:          _MessageHeaderName[272:286],
-	MsgClientInput:          _MessageHeaderName[286:300],
-	MsgServerState:          _MessageHeaderName[300:314],
+	MsgAuth:                    _MessageHeaderName[0:7],
+	MsgAuthAck:                 _MessageHeaderName[7:17],
+	MsgConnect:                 _MessageHeaderName[17:27],
+	MsgDisconnect:              _MessageHeaderName[27:40],
+	MsgLobbyCreate:             _MessageHeaderName[40:54],
+	MsgLobbyCreated:            _MessageHeaderName[54:69],
+	MsgLobbyDeleted:            _MessageHeaderName[69:84],
+	MsgLobbyGameStart:          _MessageHeaderName[84:101],
+	MsgLobbyGameStarted:        _MessageHeaderName[101:120],
+	MsgLobbyClientsNotReady:    _MessageHeaderName[120:143],
+	MsgLobbyClientReady:        _MessageHeaderName[143:162],
+	MsgLobbyClientJoin:         _MessageHeaderName[162:180],
+	MsgLobbyClientLeave:        _MessageHeaderName[180:199],
+	MsgLobbiesSync:             _MessageHeaderName[199:213],
+	MsgLobbiesSynced:           _MessageHeaderName[213:229],
+	MsgLobbyPromote:            _MessageHeaderName[229:244],
+	MsgLobbyPromoted:           _MessageHeaderName[244:260],
+	MsgLobbyKick:               _MessageHeaderName[260:272],
+	MsgLobbyKicked:             _MessageHeaderName[272:286],
+	MsgClientInput:             _MessageHeaderName[286:300],
+	MsgServerState:             _MessageHeaderName[300:314],
+	MsgChat:                    _MessageHeaderName[314:321],
+	MsgLobbiesSubscribe:        _MessageHeaderName[321:340],
+	MsgLobbiesUnsubscribe:      _MessageHeaderName[340:361],
+	MsgLobbyEvent:              _MessageHeaderName[361:374],
+	MsgMatchmake:               _MessageHeaderName[374:386],
+	MsgMatchmakeCancel:         _MessageHeaderName[386:404],
+	MsgMatchmakeStatus:         _MessageHeaderName[404:422],
+	MsgLobbySpectate:           _MessageHeaderName[422:438],
+	MsgLobbySettings:           _MessageHeaderName[438:454],
+	MsgLobbyJoinRejected:       _MessageHeaderName[454:474],
+	MsgGameOver:                _MessageHeaderName[474:485],
+	MsgProfile:                 _MessageHeaderName[485:495],
+	MsgProfileRejected:         _MessageHeaderName[495:513],
+	MsgLobbyTeam:               _MessageHeaderName[513:525],
+	MsgGamePause:               _MessageHeaderName[525:537],
+	MsgGameResume:              _MessageHeaderName[537:550],
+	MsgLobbyCountdownCancelled: _MessageHeaderName[550:576],
+	MsgVoteCall:                _MessageHeaderName[576:587],
+	MsgVoteCast:                _MessageHeaderName[587:598],
+	MsgVoteStatus:              _MessageHeaderName[598:611],
+	MsgPartyCreate:             _MessageHeaderName[611:625],
+	MsgPartyInvite:             _MessageHeaderName[625:639],
+	MsgPartyJoin:               _MessageHeaderName[639:651],
+	MsgPartyLeave:              _MessageHeaderName[651:664],
+	MsgPartySync:               _MessageHeaderName[664:676],
+	MsgPartyRejected:           _MessageHeaderName[676:692],
+	MsgGameEvent:               _MessageHeaderName[692:704],
 }
 
 // String implements the Stringer interface.
@@ -133,6 +214,60 @@ var _MessageHeaderValue = map[string]MessageHeader{
 	strings.ToLower(_MessageHeaderName[286:300]): MsgClientInput,
 	_MessageHeaderName[300:314]:                  MsgServerState,
 	strings.ToLower(_MessageHeaderName[300:314]): MsgServerState,
+	_MessageHeaderName[314:321]:                  MsgChat,
+	strings.ToLower(_MessageHeaderName[314:321]): MsgChat,
+	_MessageHeaderName[321:340]:                  MsgLobbiesSubscribe,
+	strings.ToLower(_MessageHeaderName[321:340]): MsgLobbiesSubscribe,
+	_MessageHeaderName[340:361]:                  MsgLobbiesUnsubscribe,
+	strings.ToLower(_MessageHeaderName[340:361]): MsgLobbiesUnsubscribe,
+	_MessageHeaderName[361:374]:                  MsgLobbyEvent,
+	strings.ToLower(_MessageHeaderName[361:374]): MsgLobbyEvent,
+	_MessageHeaderName[374:386]:                  MsgMatchmake,
+	strings.ToLower(_MessageHeaderName[374:386]): MsgMatchmake,
+	_MessageHeaderName[386:404]:                  MsgMatchmakeCancel,
+	strings.ToLower(_MessageHeaderName[386:404]): MsgMatchmakeCancel,
+	_MessageHeaderName[404:422]:                  MsgMatchmakeStatus,
+	strings.ToLower(_MessageHeaderName[404:422]): MsgMatchmakeStatus,
+	_MessageHeaderName[422:438]:                  MsgLobbySpectate,
+	strings.ToLower(_MessageHeaderName[422:438]): MsgLobbySpectate,
+	_MessageHeaderName[438:454]:                  MsgLobbySettings,
+	strings.ToLower(_MessageHeaderName[438:454]): MsgLobbySettings,
+	_MessageHeaderName[454:474]:                  MsgLobbyJoinRejected,
+	strings.ToLower(_MessageHeaderName[454:474]): MsgLobbyJoinRejected,
+	_MessageHeaderName[474:485]:                  MsgGameOver,
+	strings.ToLower(_MessageHeaderName[474:485]): MsgGameOver,
+	_MessageHeaderName[485:495]:                  MsgProfile,
+	strings.ToLower(_MessageHeaderName[485:495]): MsgProfile,
+	_MessageHeaderName[495:513]:                  MsgProfileRejected,
+	strings.ToLower(_MessageHeaderName[495:513]): MsgProfileRejected,
+	_MessageHeaderName[513:525]:                  MsgLobbyTeam,
+	strings.ToLower(_MessageHeaderName[513:525]): MsgLobbyTeam,
+	_MessageHeaderName[525:537]:                  MsgGamePause,
+	strings.ToLower(_MessageHeaderName[525:537]): MsgGamePause,
+	_MessageHeaderName[537:550]:                  MsgGameResume,
+	strings.ToLower(_MessageHeaderName[537:550]): MsgGameResume,
+	_MessageHeaderName[550:576]:                  MsgLobbyCountdownCancelled,
+	strings.ToLower(_MessageHeaderName[550:576]): MsgLobbyCountdownCancelled,
+	_MessageHeaderName[576:587]:                  MsgVoteCall,
+	strings.ToLower(_MessageHeaderName[576:587]): MsgVoteCall,
+	_MessageHeaderName[587:598]:                  MsgVoteCast,
+	strings.ToLower(_MessageHeaderName[587:598]): MsgVoteCast,
+	_MessageHeaderName[598:611]:                  MsgVoteStatus,
+	strings.ToLower(_MessageHeaderName[598:611]): MsgVoteStatus,
+	_MessageHeaderName[611:625]:                  MsgPartyCreate,
+	strings.ToLower(_MessageHeaderName[611:625]): MsgPartyCreate,
+	_MessageHeaderName[625:639]:                  MsgPartyInvite,
+	strings.ToLower(_MessageHeaderName[625:639]): MsgPartyInvite,
+	_MessageHeaderName[639:651]:                  MsgPartyJoin,
+	strings.ToLower(_MessageHeaderName[639:651]): MsgPartyJoin,
+	_MessageHeaderName[651:664]:                  MsgPartyLeave,
+	strings.ToLower(_MessageHeaderName[651:664]): MsgPartyLeave,
+	_MessageHeaderName[664:676]:                  MsgPartySync,
+	strings.ToLower(_MessageHeaderName[664:676]): MsgPartySync,
+	_MessageHeaderName[676:692]:                  MsgPartyRejected,
+	strings.ToLower(_MessageHeaderName[676:692]): MsgPartyRejected,
+	_MessageHeaderName[692:704]:                  MsgGameEvent,
+	strings.ToLower(_MessageHeaderName[692:704]): MsgGameEvent,
 }
 
 // ParseMessageHeader attempts to convert a string to a MessageHeader.
@@ -1,6 +1,8 @@
 package nw
 
 import (
+	"bytes"
+	"slices"
 	"testing"
 )
 
@@ -141,3 +143,59 @@ func TestMsgUnpack(t *testing.T) {
 		})
 	}
 }
+
+func TestMsgDecodeFromStream(t *testing.T) {
+	var stream bytes.Buffer
+	want := []Message{
+		NewConnectMessage(FmtText, "client1"),
+		NewLobbyJoinMessage(FmtText, "lobby1", "client1"),
+		NewMessage(MsgServerState, FmtJSON, bytes.Repeat([]byte("x"), 4096)),
+	}
+	for _, msg := range want {
+		if err := msg.EncodeTo(&stream); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, w := range want {
+		var got Message
+		if err := got.DecodeFrom(&stream); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != w.String() {
+			t.Errorf("got %s, want %s", got, w)
+		}
+	}
+	if stream.Len() != 0 {
+		t.Errorf("got %d unread bytes, want 0", stream.Len())
+	}
+}
+
+// stickInput is a structured input like the ones games with analog controls send.
+type stickInput struct {
+	Axes [2]float64
+	Fire bool
+}
+
+func TestClientInputMessage(t *testing.T) {
+	want := []ClientInput[stickInput]{
+		{ClientID: "client1", Sequence: 7, Input: stickInput{Axes: [2]float64{0.5, -1}}},
+		{ClientID: "client1", Sequence: 8, Input: stickInput{Fire: true}},
+	}
+	msg, err := NewClientInputMessage(FmtJSON, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ClientInputsFromMessage[stickInput](msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// an input of another type does not decode
+	if _, err := ClientInputsFromMessage[int](msg); err == nil {
+		t.Error("got a stick input decoded as an int")
+	}
+}
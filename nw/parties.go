@@ -0,0 +1,242 @@
+package nw
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// defaultMaxPartySize is the number of players a party can hold, its leader included.
+const defaultMaxPartySize = 4
+
+// Party is a group of players that join lobbies and queue for matchmaking together.
+// It is sent to every member with MsgPartySync whenever it changes, a zero Party means the client is in none.
+type Party struct {
+	ID       string `json:"id"`
+	LeaderID string `json:"leaderID"`
+	// Members are in join order and include the leader
+	Members []string `json:"members"`
+	// Invited are the players that were invited and have not joined yet
+	Invited []string `json:"invited,omitempty"`
+}
+
+// PartyRequest is sent by clients to manage parties.
+// ClientID is the player to invite with MsgPartyInvite and PartyID the party to join with MsgPartyJoin.
+type PartyRequest struct {
+	PartyID  string `json:"partyID,omitempty"`
+	ClientID string `json:"clientID,omitempty"`
+}
+
+// PartyInvite tells a player it was invited to a party, it is sent with MsgPartyInvite.
+type PartyInvite struct {
+	PartyID  string `json:"partyID"`
+	FromID   string `json:"fromID"`
+	FromName string `json:"fromName"`
+}
+
+type partyRequest struct {
+	client  *client
+	header  MessageHeader
+	request PartyRequest
+}
+
+// lobbyJoin asks the server loop to move client, and its party if it leads one, into a lobby.
+type lobbyJoin struct {
+	client  *client
+	lobbyID string
+	// spectate joins the lobby as a spectator, the client's party stays where it is
+	spectate bool
+}
+
+// partyRegistry holds the parties of the server. It is owned by the Server loop goroutine.
+type partyRegistry struct {
+	parties  map[string]*Party
+	byMember map[string]string
+	maxSize  int
+}
+
+func newPartyRegistry(maxSize int) *partyRegistry {
+	return &partyRegistry{
+		parties:  make(map[string]*Party),
+		byMember: make(map[string]string),
+		maxSize:  maxSize,
+	}
+}
+
+// of returns the party clientID is a member of, or nil.
+func (r *partyRegistry) of(clientID string) *Party {
+	return r.parties[r.byMember[clientID]]
+}
+
+// followers returns the members of the party led by clientID other than the leader.
+// It returns nil if clientID does not lead a party.
+func (r *partyRegistry) followers(clientID string) []string {
+	p := r.of(clientID)
+	if p == nil || p.LeaderID != clientID {
+		return nil
+	}
+	return slices.DeleteFunc(slices.Clone(p.Members), func(id string) bool { return id == clientID })
+}
+
+func (r *partyRegistry) create(id, leaderID string) (*Party, error) {
+	if r.of(leaderID) != nil {
+		return nil, fmt.Errorf("already in a party")
+	}
+	p := &Party{ID: id, LeaderID: leaderID, Members: []string{leaderID}}
+	r.parties[id] = p
+	r.byMember[leaderID] = id
+	return p, nil
+}
+
+// invite lets targetID join the party led by leaderID.
+func (r *partyRegistry) invite(leaderID, targetID string) (*Party, error) {
+	p := r.of(leaderID)
+	if p == nil || p.LeaderID != leaderID {
+		return nil, fmt.Errorf("only the party leader can invite")
+	}
+	if slices.Contains(p.Members, targetID) {
+		return nil, fmt.Errorf("already in the party")
+	}
+	if len(p.Members) >= r.maxSize {
+		return nil, fmt.Errorf("party is full")
+	}
+	if !slices.Contains(p.Invited, targetID) {
+		p.Invited = append(p.Invited, targetID)
+	}
+	return p, nil
+}
+
+// join adds clientID to a party it was invited to.
+func (r *partyRegistry) join(clientID, partyID string) (*Party, error) {
+	p, ok := r.parties[partyID]
+	if !ok || !slices.Contains(p.Invited, clientID) {
+		return nil, fmt.Errorf("not invited to that party")
+	}
+	if r.of(clientID) != nil {
+		return nil, fmt.Errorf("already in a party")
+	}
+	if len(p.Members) >= r.maxSize {
+		return nil, fmt.Errorf("party is full")
+	}
+	p.Invited = slices.DeleteFunc(p.Invited, func(id string) bool { return id == clientID })
+	p.Members = append(p.Members, clientID)
+	r.byMember[clientID] = partyID
+	return p, nil
+}
+
+// leave takes clientID out of its party and returns what is left of it, the longest standing member takes over as leader.
+// It returns nil if clientID was in no party or the party disbanded.
+func (r *partyRegistry) leave(clientID string) *Party {
+	p := r.of(clientID)
+	if p == nil {
+		return nil
+	}
+	delete(r.byMember, clientID)
+	p.Members = slices.DeleteFunc(p.Members, func(id string) bool { return id == clientID })
+	if len(p.Members) == 0 {
+		delete(r.parties, p.ID)
+		return nil
+	}
+	if p.LeaderID == clientID {
+		p.LeaderID = p.Members[0]
+	}
+	return p
+}
+
+func NewPartyRequestMessage(f MessageFmt, h MessageHeader, pr PartyRequest) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(pr)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(h, f, data), nil
+}
+
+func PartyRequestFromMessage(m Message) (PartyRequest, error) {
+	var pr PartyRequest
+	switch m.header {
+	case MsgPartyCreate, MsgPartyInvite, MsgPartyJoin, MsgPartyLeave:
+	default:
+		return PartyRequest{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &pr); err != nil {
+			return PartyRequest{}, err
+		}
+	default:
+		return PartyRequest{}, fmt.Errorf("unsupported message format")
+	}
+	return pr, nil
+}
+
+func NewPartySyncMessage(f MessageFmt, p Party) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(p)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgPartySync, f, data), nil
+}
+
+func PartySyncFromMessage(m Message) (Party, error) {
+	var p Party
+	if m.header != MsgPartySync {
+		return Party{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &p); err != nil {
+			return Party{}, err
+		}
+	default:
+		return Party{}, fmt.Errorf("unsupported message format")
+	}
+	return p, nil
+}
+
+func NewPartyInviteMessage(f MessageFmt, pi PartyInvite) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(pi)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgPartyInvite, f, data), nil
+}
+
+func PartyInviteFromMessage(m Message) (PartyInvite, error) {
+	var pi PartyInvite
+	if m.header != MsgPartyInvite {
+		return PartyInvite{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &pi); err != nil {
+			return PartyInvite{}, err
+		}
+	default:
+		return PartyInvite{}, fmt.Errorf("unsupported message format")
+	}
+	return pi, nil
+}
@@ -0,0 +1,53 @@
+package nw
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPartyRegistry(t *testing.T) {
+	r := newPartyRegistry(3)
+	if _, err := r.create("p1", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.create("p2", "a"); err == nil {
+		t.Error("created a second party for a member")
+	}
+	if _, err := r.join("b", "p1"); err == nil {
+		t.Error("joined without an invite")
+	}
+	if _, err := r.invite("b", "c"); err == nil {
+		t.Error("non member invited")
+	}
+	for _, id := range []string{"b", "c", "d"} {
+		if _, err := r.invite("a", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"b", "c"} {
+		if _, err := r.join(id, "p1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.join("d", "p1"); err == nil {
+		t.Error("joined a full party")
+	}
+	if got := r.followers("a"); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("got followers %v, want [b c]", got)
+	}
+	if got := r.followers("b"); got != nil {
+		t.Errorf("non leader has followers %v", got)
+	}
+
+	p := r.leave("a")
+	if p == nil || p.LeaderID != "b" {
+		t.Fatalf("got %+v after the leader left, want b to lead", p)
+	}
+	r.leave("b")
+	if p := r.leave("c"); p != nil {
+		t.Errorf("got %+v after everyone left, want the party disbanded", p)
+	}
+	if _, ok := r.parties["p1"]; ok {
+		t.Error("empty party still registered")
+	}
+}
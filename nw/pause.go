@@ -0,0 +1,65 @@
+package nw
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+type pauseRequest struct {
+	clientID string
+	paused   bool
+}
+
+// pauseState tracks whether a running match is paused.
+type pauseState struct {
+	paused bool
+	// resumeAt is set while the resume countdown runs
+	resumeAt time.Time
+	// countdown is the last countdown second broadcast
+	countdown int
+}
+
+// requestPause asks the lobby to pause or resume the match on behalf of clientID.
+func (s *GameServer[T, I]) requestPause(clientID string, paused bool) {
+	sendTo(s.done, s.pauseRequests, pauseRequest{clientID: clientID, paused: paused})
+}
+
+// handlePause pauses the match right away or starts the resume countdown.
+// Pausing during the countdown cancels it.
+func (s *GameServer[T, I]) handlePause(ps *pauseState, pause bool, now time.Time) {
+	if pause {
+		if ps.paused && ps.resumeAt.IsZero() {
+			return
+		}
+		*ps = pauseState{paused: true}
+		s.log.Println("Pausing game in lobby", s.ID)
+		s.broadcastDelayed(NewMessage(MsgGamePause, FmtText, []byte(s.ID)))
+		return
+	}
+	if !ps.paused || !ps.resumeAt.IsZero() {
+		return
+	}
+	ps.resumeAt = now.Add(time.Duration(s.resumeCountdown) * time.Second)
+	s.resumeDue(ps, now)
+}
+
+// resumeDue broadcasts the resume countdown and reports whether the match has resumed.
+func (s *GameServer[T, I]) resumeDue(ps *pauseState, now time.Time) bool {
+	if ps.resumeAt.IsZero() {
+		return false
+	}
+	remaining := int(math.Ceil(ps.resumeAt.Sub(now).Seconds()))
+	if remaining <= 0 {
+		*ps = pauseState{}
+		s.log.Println("Resuming game in lobby", s.ID)
+		s.broadcastDelayed(NewMessage(MsgGameResume, FmtText, []byte(s.ID)))
+		return true
+	}
+	if remaining != ps.countdown {
+		ps.countdown = remaining
+		countDownMsg := fmt.Sprintf(`{"countdown": %d}`, remaining)
+		s.broadcastDelayed(NewMessage(MsgGameResume, FmtJSON, []byte(countDownMsg)))
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package nw
+
+import "reflect"
+
+// Predictor runs client side prediction for a game with state T and inputs I.
+// Inputs are applied to the local state as soon as they are made and replayed on top of every
+// authoritative state from the server until the server acknowledges them.
+// It is not safe for concurrent use, it is meant to be driven by the game loop.
+type Predictor[T any, I any] struct {
+	step  func(state T, input I) T
+	clone func(state T) T
+	equal func(predicted, actual T) bool
+	// seq is the sequence number of the last input applied
+	seq uint32
+	// state is the last server state with the pending inputs applied on top
+	state T
+	// pending are the inputs the server has not acknowledged yet, oldest first
+	pending []predictedInput[T, I]
+	stats   PredictionStats
+}
+
+type predictedInput[T any, I any] struct {
+	seq   uint32
+	input I
+	// after is the state predicted right after the input was applied
+	after T
+}
+
+// PredictionStats tells how often the client predicted the server right.
+type PredictionStats struct {
+	// Acknowledged is the number of inputs the server acknowledged
+	Acknowledged uint64
+	// Mispredictions is the number of server states that differed from the prediction for the last input they acknowledged
+	Mispredictions uint64
+	// Replayed is the number of times an unacknowledged input was re-simulated on top of a server state
+	Replayed uint64
+	// Pending is the number of inputs waiting to be acknowledged
+	Pending int
+}
+
+type PredictorOption[T any, I any] func(*Predictor[T, I])
+
+// WithPredictionCheck sets how a prediction is compared with the server state to count mispredictions.
+// It defaults to reflect.DeepEqual, games whose state keeps changing without input usually want to compare less.
+func WithPredictionCheck[T any, I any](equal func(predicted, actual T) bool) PredictorOption[T, I] {
+	return func(p *Predictor[T, I]) {
+		p.equal = equal
+	}
+}
+
+// NewPredictor creates a predictor starting from initial.
+// step applies an input to a state and returns the result, it is always handed a copy made by clone
+// so it may change the state in place, but it must not depend on anything else that changes.
+func NewPredictor[T any, I any](initial T, step func(state T, input I) T, clone func(state T) T, opts ...PredictorOption[T, I]) *Predictor[T, I] {
+	p := &Predictor[T, I]{
+		step:  step,
+		clone: clone,
+		equal: func(predicted, actual T) bool { return reflect.DeepEqual(predicted, actual) },
+		state: initial,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Apply predicts the outcome of input and returns its sequence number, the one to send to the server with it.
+func (p *Predictor[T, I]) Apply(input I) uint32 {
+	p.seq++
+	p.state = p.step(p.clone(p.state), input)
+	p.pending = append(p.pending, predictedInput[T, I]{seq: p.seq, input: input, after: p.state})
+	return p.seq
+}
+
+// Reconcile takes the server state, which has every input up to acknowledged applied,
+// drops the inputs it acknowledges and replays the rest on top of it. It returns the new predicted state.
+func (p *Predictor[T, I]) Reconcile(server T, acknowledged uint32) T {
+	acked := 0
+	for acked < len(p.pending) && p.pending[acked].seq <= acknowledged {
+		acked++
+	}
+	if acked > 0 {
+		p.stats.Acknowledged += uint64(acked)
+		if !p.equal(p.pending[acked-1].after, server) {
+			p.stats.Mispredictions++
+		}
+		p.pending = append(p.pending[:0], p.pending[acked:]...)
+	}
+
+	p.state = server
+	for i := range p.pending {
+		p.state = p.step(p.clone(p.state), p.pending[i].input)
+		p.pending[i].after = p.state
+	}
+	p.stats.Replayed += uint64(len(p.pending))
+	return p.state
+}
+
+// State returns the predicted state, it must not be changed, clone it first.
+func (p *Predictor[T, I]) State() T {
+	return p.state
+}
+
+// Seq returns the sequence number of the last input applied.
+func (p *Predictor[T, I]) Seq() uint32 {
+	return p.seq
+}
+
+// Stats returns the prediction metrics so far.
+func (p *Predictor[T, I]) Stats() PredictionStats {
+	stats := p.stats
+	stats.Pending = len(p.pending)
+	return stats
+}
@@ -0,0 +1,75 @@
+package nw
+
+import (
+	"slices"
+	"testing"
+)
+
+// counter is a game where every input adds to a total and is remembered.
+type counter struct {
+	Total  int
+	Inputs []int
+}
+
+func stepCounter(c counter, input int) counter {
+	c.Total += input
+	c.Inputs = append(c.Inputs, input)
+	return c
+}
+
+func cloneCounter(c counter) counter {
+	c.Inputs = slices.Clone(c.Inputs)
+	return c
+}
+
+func TestPredictorReconcile(t *testing.T) {
+	p := NewPredictor(counter{}, stepCounter, cloneCounter)
+	for _, input := range []int{1, 2, 3} {
+		p.Apply(input)
+	}
+	if got := p.State().Total; got != 6 {
+		t.Fatalf("got predicted total %d, want 6", got)
+	}
+
+	// the server applied the first input as predicted
+	got := p.Reconcile(counter{Total: 1, Inputs: []int{1}}, 1)
+	if got.Total != 6 || !slices.Equal(got.Inputs, []int{1, 2, 3}) {
+		t.Errorf("got %+v after replaying inputs 2 and 3, want a total of 6", got)
+	}
+	// the server disagrees on the second input, something else added 10
+	got = p.Reconcile(counter{Total: 13, Inputs: []int{1, 2, 10}}, 2)
+	if got.Total != 16 || !slices.Equal(got.Inputs, []int{1, 2, 10, 3}) {
+		t.Errorf("got %+v after replaying input 3, want a total of 16", got)
+	}
+	// an old state arriving late acknowledges nothing new
+	p.Reconcile(counter{Total: 1, Inputs: []int{1}}, 1)
+
+	want := PredictionStats{Acknowledged: 2, Mispredictions: 1, Replayed: 4, Pending: 1}
+	if stats := p.Stats(); stats != want {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+	if seq := p.Apply(4); seq != 4 {
+		t.Errorf("got sequence %d, want 4", seq)
+	}
+}
+
+func TestPredictorStepGetsACopy(t *testing.T) {
+	server := counter{Total: 1, Inputs: []int{1}}
+	p := NewPredictor(counter{}, stepCounter, cloneCounter)
+	p.Apply(2)
+	p.Reconcile(server, 0)
+	p.Apply(3)
+	if !slices.Equal(server.Inputs, []int{1}) {
+		t.Errorf("server state changed to %+v by prediction", server)
+	}
+}
+
+func TestPredictorCheck(t *testing.T) {
+	sameTotal := func(predicted, actual counter) bool { return predicted.Total == actual.Total }
+	p := NewPredictor(counter{}, stepCounter, cloneCounter, WithPredictionCheck[counter, int](sameTotal))
+	p.Apply(5)
+	p.Reconcile(counter{Total: 5, Inputs: []int{2, 3}}, 1)
+	if stats := p.Stats(); stats.Mispredictions != 0 {
+		t.Errorf("got %d mispredictions with an equal total", stats.Mispredictions)
+	}
+}
@@ -0,0 +1,88 @@
+package nw
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const maxNameLength = 16
+
+// Profile is how a player presents themselves to others.
+type Profile struct {
+	// Name is the display name, clients without one are shown by their ID
+	Name string `json:"name"`
+	// Color is an 0xRRGGBBAA color the player's entities are drawn with, 0 leaves it to the game
+	Color  uint32 `json:"color"`
+	Avatar int    `json:"avatar"`
+}
+
+// ProfileMessage announces the profile of a client, it is sent to change a profile and broadcast once changed.
+type ProfileMessage struct {
+	ClientID string  `json:"clientID"`
+	Profile  Profile `json:"profile"`
+}
+
+type profileChange struct {
+	client  *client
+	profile Profile
+}
+
+// validateProfile trims the name and checks it can be shown to other players.
+func validateProfile(p Profile) (Profile, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	if len([]rune(p.Name)) > maxNameLength {
+		return Profile{}, fmt.Errorf("name is longer than %d characters", maxNameLength)
+	}
+	for _, r := range p.Name {
+		// | separates fields in text payloads
+		if r == '|' || !unicode.IsPrint(r) {
+			return Profile{}, fmt.Errorf("name contains invalid character %q", r)
+		}
+	}
+	if p.Avatar < 0 {
+		return Profile{}, fmt.Errorf("invalid avatar %d", p.Avatar)
+	}
+	return p, nil
+}
+
+// displayName is the name a client is shown as.
+func displayName(clientID string, p Profile) string {
+	if p.Name == "" {
+		return clientID
+	}
+	return p.Name
+}
+
+func NewProfileMessage(f MessageFmt, pm ProfileMessage) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(pm)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgProfile, f, data), nil
+}
+
+func ProfileMessageFromMessage(m Message) (ProfileMessage, error) {
+	var pm ProfileMessage
+	if m.header != MsgProfile {
+		return ProfileMessage{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &pm); err != nil {
+			return ProfileMessage{}, err
+		}
+	default:
+		return ProfileMessage{}, fmt.Errorf("unsupported message format")
+	}
+	return pm, nil
+}
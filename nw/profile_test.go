@@ -0,0 +1,32 @@
+package nw
+
+import "testing"
+
+func TestValidateProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		want    string
+		wantErr bool
+	}{
+		{name: "empty name", profile: Profile{}, want: ""},
+		{name: "trimmed", profile: Profile{Name: "  snek "}, want: "snek"},
+		{name: "unicode", profile: Profile{Name: "Zoë"}, want: "Zoë"},
+		{name: "too long", profile: Profile{Name: "abcdefghijklmnopq"}, wantErr: true},
+		{name: "separator", profile: Profile{Name: "a|b"}, wantErr: true},
+		{name: "control character", profile: Profile{Name: "a\nb"}, wantErr: true},
+		{name: "negative avatar", profile: Profile{Avatar: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateProfile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && got.Name != tt.want {
+				t.Errorf("got %q, want %q", got.Name, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package nw
+
+import (
+	"fmt"
+	"time"
+)
+
+// readyCheckInterval is how often the lobby looks for members that did not ready up in time.
+const readyCheckInterval = time.Second
+
+// countdownC fires every second of the start countdown, it is nil while no countdown runs.
+func (s *GameServer[T, I]) countdownC() <-chan time.Time {
+	if s.countdownTicker == nil {
+		return nil
+	}
+	return s.countdownTicker.C
+}
+
+// beginCountdown starts counting down to the game, the lobby keeps handling actions meanwhile.
+func (s *GameServer[T, I]) beginCountdown() {
+	if s.countdown <= 0 {
+		s.start()
+		return
+	}
+	s.countdownLeft = s.countdown
+	s.countdownTicker = time.NewTicker(time.Second)
+	s.broadcastCountdown()
+}
+
+// tickCountdown counts one second down and starts the game once it reaches zero.
+func (s *GameServer[T, I]) tickCountdown() {
+	s.countdownLeft--
+	if s.countdownLeft > 0 {
+		s.broadcastCountdown()
+		return
+	}
+	s.stopCountdown()
+	s.start()
+}
+
+func (s *GameServer[T, I]) broadcastCountdown() {
+	s.log.Println("Starting in", s.countdownLeft)
+	countDownMsg := fmt.Sprintf(`{"countdown": %d}`, s.countdownLeft)
+	s.broadcast(NewMessage(MsgLobbyGameStarted, FmtJSON, []byte(countDownMsg)))
+}
+
+func (s *GameServer[T, I]) stopCountdown() {
+	if s.countdownTicker != nil {
+		s.countdownTicker.Stop()
+		s.countdownTicker = nil
+	}
+}
+
+// cancelCountdown stops a running countdown and tells the lobby why.
+func (s *GameServer[T, I]) cancelCountdown(reason string) {
+	if s.countdownTicker == nil {
+		return
+	}
+	s.stopCountdown()
+	s.log.Printf("Countdown in lobby %s cancelled: %s\n", s.ID, reason)
+	s.broadcast(NewMessage(MsgLobbyCountdownCancelled, FmtText, []byte(reason)))
+}
+
+// idleMembers returns the members that have not readied up within the ready timeout, in join order.
+func (s *GameServer[T, I]) idleMembers(now time.Time) []*client {
+	if s.readyTimeout <= 0 || s.started {
+		return nil
+	}
+	var idle []*client
+	for _, id := range s.members {
+		since, ok := s.unreadySince[id]
+		if ok && !s.readyClients[id] && now.Sub(since) >= s.readyTimeout {
+			idle = append(idle, s.clients[id])
+		}
+	}
+	return idle
+}
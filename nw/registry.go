@@ -0,0 +1,51 @@
+package nw
+
+import "sync"
+
+// lobbyRegistry maps lobby codes to lobbies.
+// Only the server loop adds and removes lobbies while every client reader goroutine looks them up,
+// so all access goes through mu.
+type lobbyRegistry[T any, I any] struct {
+	mu      sync.RWMutex
+	lobbies map[string]*GameServer[T, I]
+}
+
+func newLobbyRegistry[T any, I any]() *lobbyRegistry[T, I] {
+	return &lobbyRegistry[T, I]{lobbies: make(map[string]*GameServer[T, I])}
+}
+
+func (r *lobbyRegistry[T, I]) get(code string) (*GameServer[T, I], bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	lobby, ok := r.lobbies[code]
+	return lobby, ok
+}
+
+func (r *lobbyRegistry[T, I]) add(lobby *GameServer[T, I]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lobbies[lobby.ID] = lobby
+}
+
+func (r *lobbyRegistry[T, I]) remove(code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.lobbies, code)
+}
+
+func (r *lobbyRegistry[T, I]) len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.lobbies)
+}
+
+// all returns the lobbies in no particular order.
+func (r *lobbyRegistry[T, I]) all() []*GameServer[T, I] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	lobbies := make([]*GameServer[T, I], 0, len(r.lobbies))
+	for _, lobby := range r.lobbies {
+		lobbies = append(lobbies, lobby)
+	}
+	return lobbies
+}
@@ -7,26 +7,30 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	quic "github.com/quic-go/quic-go"
 	"golang.org/x/exp/rand"
 )
 
-type Server[T any] struct {
+type Server[T any, I any] struct {
 	address string
 
 	tlsConfig  *tls.Config
 	quicConfig *quic.Config
 
-	lobbies map[string]*GameServer[T]
-	state   StateManager[T]
+	// lobbies is looked up by every client reader goroutine and changed by loop
+	lobbies *lobbyRegistry[T, I]
+	state   StateManager[T, I]
+	// newState creates the state of each new lobby, without it every lobby shares state
+	newState func() StateManager[T, I]
 	// defines the Tick of the server
 	tickRate time.Duration
 	log      *log.Logger
-	// map of <remote_address:quic.StreamID> to Client
+	// map of <remote_address:quic.StreamID> to Client, owned by loop
 	clients map[string]*client
 
 	// channel for handling joining clients
@@ -35,44 +39,170 @@ type Server[T any] struct {
 	removeClients chan *client
 	// channel for new lobbies being created on the server
 	newLobbies chan string
-	// channel for removing empty lobbies
-	closeLobbies chan string
+	// channel for server wide chat messages
+	chatMessages chan ChatMessage
+	// latest views and closed lobbies published by the lobbies
+	lobbyChanges *lobbyChanges
+	// channel for lobby list queries and subscriptions
+	lobbyRequests chan lobbyRequest
+	// directory of lobby views and subscribers, owned by loop
+	directory *lobbyDirectory
+	// gameType is advertised by every lobby created on the server
+	gameType string
+	// channel for quick play queue requests, a nil request cancels
+	matchmakeRequests chan matchmakeRequest
+	// quick play queues, owned by loop
+	matchmaker *matchmaker
+	// lobbyOptions are applied to every lobby created on the server
+	lobbyOptions []GameServerOption[T, I]
+	// maxLobbySize is the number of players a lobby created on the server takes,
+	// matchmade lobbies take their group size
+	maxLobbySize int
+
+	// chat limits applied to every client
+	chatMaxLength int
+	chatRate      int
+	chatWindow    time.Duration
+	chatFilter    ChatFilter
+
+	// access holds the server wide bans and moderators, it is safe to use from any goroutine
+	access *accessList
+	// banFile is where access is saved, empty keeps it in memory
+	banFile string
+	// moderators are added to access on start up
+	moderators []string
+	// channel asking the loop to disconnect clients that have been banned
+	banChecks chan struct{}
+	// channel for party management requests
+	partyRequests chan partyRequest
+	// parties of the server, owned by loop
+	parties *partyRegistry
+	// channel for lobby joins, they go through loop so parties can follow their leader
+	lobbyJoins chan lobbyJoin
 }
 
-type ClientInput struct {
+// ClientInput is an input of type I a client made, I is encoded with the message format it is sent in.
+type ClientInput[I any] struct {
 	ClientID string
-	Input    string
+	Input    I
 	Sequence uint32
+	// ViewTick is the tick of the last state the client got when it made the input
+	ViewTick uint64
+	// RenderDelay is how far behind that state the client rendered the world
+	RenderDelay time.Duration
+}
+
+type lobbyRequest struct {
+	client *client
+	header MessageHeader
+	query  LobbyQuery
+}
+
+type matchmakeRequest struct {
+	client  *client
+	request *MatchmakeRequest
 }
 
 type ServerStateMessage[T any] struct {
+	// Tick is the number of the game tick the state is from
+	Tick uint64
+	// ServerTime is when the server sent the state, clients render remote entities a delay behind it
+	ServerTime      time.Time
 	GameState       T
 	AcknowledgedSeq map[string]uint32
 }
 
 // represents a client connected to the server
 type client struct {
-	ID           string
-	nick         string
-	conn         quic.Connection
-	stream       quic.Stream
-	sendChan     chan Message
-	quitChan     chan struct{}
-	lastSequence uint32
+	ID     string
+	conn   quic.Connection
+	stream quic.Stream
+	// sendChan is drained by the writer, it is never closed, senders stop once done is closed
+	sendChan chan Message
+	// done is closed once the client is gone
+	done      chan struct{}
+	closeOnce sync.Once
+	// chatLimiter is only touched by the client's reader goroutine
+	chatLimiter *rateLimiter
+	// lobbyID is the lobby the client is a member of, set by the lobby and read by the reader goroutine
+	lobbyID atomic.Value
+	// profileValue holds the client's Profile, set by its lobby or, outside of one, by the reader goroutine
+	profileValue atomic.Value
+}
+
+func (c *client) setProfile(p Profile) {
+	c.profileValue.Store(p)
+}
+
+func (c *client) profile() Profile {
+	p, _ := c.profileValue.Load().(Profile)
+	return p
+}
+
+func (c *client) displayName() string {
+	return displayName(c.ID, c.profile())
+}
+
+func (c *client) setLobby(lobbyID string) {
+	c.lobbyID.Store(lobbyID)
+}
+
+// leaveLobby clears the client's lobby unless it has already moved on to another one.
+func (c *client) leaveLobby(lobbyID string) {
+	c.lobbyID.CompareAndSwap(lobbyID, "")
+}
+
+// lobby returns the ID of the lobby the client is playing in or watching, or an empty string.
+func (c *client) lobby() string {
+	id, _ := c.lobbyID.Load().(string)
+	return id
+}
+
+func newClient(id string, conn quic.Connection, stream quic.Stream, chatLimiter *rateLimiter) *client {
+	return &client{
+		ID:          id,
+		conn:        conn,
+		stream:      stream,
+		sendChan:    make(chan Message, clientSendBuffer),
+		done:        make(chan struct{}),
+		chatLimiter: chatLimiter,
+	}
+}
+
+// slowClientErrorCode is the application error code connections of clients that fall behind are closed with.
+const slowClientErrorCode quic.ApplicationErrorCode = 0x43
+
+// send queues msg for the writer, it is dropped once the client is gone.
+// A client whose buffer is full is disconnected, it would otherwise hold up the lobby or the server loop.
+func (c *client) send(msg Message) {
+	select {
+	case c.sendChan <- msg:
+	case <-c.done:
+	default:
+		log.Printf("Disconnecting client %s, it is not keeping up with its messages\n", c.ID)
+		if c.conn != nil {
+			// the reader notices the closed connection and removes the client
+			c.conn.CloseWithError(slowClientErrorCode, "too slow")
+		}
+		c.close()
+	}
+}
+
+// close stops the writer, messages sent afterwards are dropped. It is safe to call more than once.
+func (c *client) close() {
+	c.closeOnce.Do(func() { close(c.done) })
 }
 
 func (c *client) writer() {
 	for {
 		select {
-		case msg, ok := <-c.sendChan:
-			if !ok {
-				return
-			}
+		case msg := <-c.sendChan:
 			if err := msg.EncodeTo(c.stream); err != nil {
 				log.Println("Error sending message to client:", err)
+				c.close()
 				return
 			}
-		case <-c.quitChan:
+		case <-c.done:
 			return
 		}
 	}
@@ -80,7 +210,7 @@ func (c *client) writer() {
 
 func (c *client) reader(removedClients chan *client, mh MessageHandler) {
 	defer func() {
-		c.quitChan <- struct{}{}
+		c.close()
 		removedClients <- c
 	}()
 
@@ -94,44 +224,80 @@ func (c *client) reader(removedClients chan *client, mh MessageHandler) {
 	}
 }
 
-func NewServer[T any](sm StateManager[T], opts ...ServerOption[T]) *Server[T] {
+func NewServer[T any, I any](sm StateManager[T, I], opts ...ServerOption[T, I]) *Server[T, I] {
 	log := log.New(os.Stdout, "server: ", log.Lshortfile)
 
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{GenerateSelfSignedTLSCertificate()},
 		NextProtos:   []string{"snake-game"},
 	}
-	s := &Server[T]{
+	s := &Server[T, I]{
 		address:       address,
 		tlsConfig:     tlsConfig,
 		quicConfig:    &quic.Config{},
 		state:         sm,
 		tickRate:      gameInterval,
 		log:           log,
-		lobbies:       make(map[string]*GameServer[T]),
+		lobbies:       newLobbyRegistry[T, I](),
 		clients:       make(map[string]*client),
 		newClients:    make(chan *client),
 		removeClients: make(chan *client),
 		newLobbies:    make(chan string),
+		chatMessages:  make(chan ChatMessage),
+		lobbyChanges:  newLobbyChanges(),
+		lobbyRequests: make(chan lobbyRequest),
+		directory:     newLobbyDirectory(),
+		chatMaxLength: defaultChatMaxLength,
+		chatRate:      defaultChatRate,
+		chatWindow:    defaultChatWindow,
+
+		matchmakeRequests: make(chan matchmakeRequest),
+		matchmaker:        newMatchmaker(defaultMatchmakeTimeout, defaultMatchmakeMinGroupSize),
+
+		banChecks:     make(chan struct{}, 1),
+		partyRequests: make(chan partyRequest),
+		parties:       newPartyRegistry(defaultMaxPartySize),
+		lobbyJoins:    make(chan lobbyJoin),
+		maxLobbySize:  defaultMaxClients,
 	}
 
 	for _, opt := range opts {
 		opt(s)
 	}
+	access, err := loadAccessList(s.banFile)
+	if err != nil {
+		s.log.Println("Error loading ban file, bans are kept in memory and the file is left alone:", err)
+	}
+	s.access = access
+	for _, target := range s.moderators {
+		if err := s.access.setModerator(target, true); err != nil {
+			s.log.Println("Error saving moderator:", err)
+		}
+	}
 
 	return s
 }
 
-// StartServer starts a QUIC server and listens for client connections.
-func (s *Server[T]) Listen() error {
+// Listen starts a QUIC server and serves client connections until accepting fails.
+func (s *Server[T, I]) Listen() error {
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	return s.serve(listener)
+}
 
+func (s *Server[T, I]) listen() (*quic.Listener, error) {
 	// Listen on a QUIC address
-	listener, err := quic.ListenAddr(s.address, s.tlsConfig, nil)
+	listener, err := quic.ListenAddr(s.address, s.tlsConfig, s.quicConfig)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	s.log.Println("Server is listening on", listener.Addr())
+	return listener, nil
+}
 
-	s.log.Println("Server is listening on", address)
+func (s *Server[T, I]) serve(listener *quic.Listener) error {
 	// Start the broadcaster goroutine
 	go s.loop()
 	// Accept client connections
@@ -153,37 +319,8 @@ func randomString(length int) string {
 	return string(b)
 }
 
-type LobbyView struct {
-	Code       string `json:"code"`
-	OwnerID    string `json:"ownerID"`
-	MaxClients int    `json:"maxClients"`
-	NumClients int    `json:"numClients"`
-	Started    bool   `json:"started"`
-}
-
-type LobbiesSync struct {
-	Lobbies []LobbyView `json:"lobbies"`
-}
-
-func (s *Server[T]) makeLobbiesSync() LobbiesSync {
-	lobbies := make([]LobbyView, 0, len(s.lobbies))
-	for id, lobby := range s.lobbies {
-		lobbies = append(lobbies, LobbyView{
-			Code:       id,
-			OwnerID:    lobby.OwnerID,
-			MaxClients: lobby.maxClients,
-			NumClients: len(lobby.clients),
-			Started:    lobby.started,
-		})
-		sort.Slice(lobbies, func(i, j int) bool {
-			return lobbies[i].Code < lobbies[j].Code
-		})
-	}
-	return LobbiesSync{Lobbies: lobbies}
-}
-
 // handleClient handles individual client connections
-func (s *Server[T]) handleClient(conn quic.Connection) {
+func (s *Server[T, I]) handleClient(conn quic.Connection) {
 	clientID := conn.RemoteAddr().String()
 	fmt.Println("New client connected:", clientID)
 
@@ -192,113 +329,252 @@ func (s *Server[T]) handleClient(conn quic.Connection) {
 		log.Println("Error accepting stream:", err)
 		return
 	}
-
-	client := &client{
-		ID:           clientID,
-		conn:         conn,
-		stream:       stream,
-		sendChan:     make(chan Message, 10),
-		quitChan:     make(chan struct{}),
-		lastSequence: 0,
+	if ban, ok := s.access.banned(clientID, time.Now()); ok {
+		s.log.Printf("Refusing banned client %s: %s\n", clientID, ban.Reason)
+		conn.CloseWithError(bannedErrorCode, banMessage(ban))
+		return
 	}
 
+	client := newClient(clientID, conn, stream, newRateLimiter(s.chatRate, s.chatWindow))
+
 	// Add the client to the server
 	go client.writer()
 	mh := MessageHandlerFunc(func(msg Message) error {
-		switch msg.header {
-		case MsgAuth:
-			// TODO handle auth message
-			client.sendChan <- NewMessage(MsgAuthAck, FmtText, []byte(client.ID))
-		case MsgConnect:
-			s.log.Println("Client connected:", client.ID)
-			s.newClients <- client
-			client.sendChan <- NewMessage(MsgConnect, FmtText, []byte(client.ID))
-		case MsgDisconnect:
-			s.log.Fatal("Client disconnected:", client.ID)
-			s.removeClients <- client
-			// TODO handle disconnect message
-		case MsgLobbyClientReady:
-			parts := strings.Split(string(msg.data.Data), "|")
-			if len(parts) != 2 {
-				return fmt.Errorf("invalid lobby join message")
-			}
-			lobbyID := parts[0]
-			lobby, ok := s.lobbies[lobbyID]
-			if !ok {
-				return fmt.Errorf("lobby not found")
-			}
-			lobby.readyChan <- client
-		case MsgLobbyPromote: // Promote a client to host
-			parts := strings.Split(string(msg.data.Data), "|")
-			if len(parts) != 2 {
-				return fmt.Errorf("invalid lobby promote message")
-			}
-			lobbyID := parts[0]
-			lobby, ok := s.lobbies[lobbyID]
-			if !ok {
-				return fmt.Errorf("lobby not found")
-			}
-			lobby.promote(parts[1])
-		case MsgLobbyKick:
-			parts := strings.Split(string(msg.data.Data), "|")
-			if len(parts) != 2 {
-				return fmt.Errorf("invalid lobby promote message")
+		return s.handleMessage(client, msg)
+	})
+
+	go client.reader(s.removeClients, mh)
+	s.newClients <- client
+}
+
+// handleMessage acts on a message from client, it runs on the client's reader goroutine.
+func (s *Server[T, I]) handleMessage(client *client, msg Message) error {
+	switch msg.header {
+	case MsgAuth:
+		// TODO handle auth message
+		client.send(NewMessage(MsgAuthAck, FmtText, []byte(client.ID)))
+	case MsgConnect:
+		s.log.Println("Client connected:", client.ID)
+		s.newClients <- client
+		client.send(NewMessage(MsgConnect, FmtText, []byte(client.ID)))
+	case MsgDisconnect:
+		s.log.Println("Client disconnected:", client.ID)
+		s.removeClients <- client
+	case MsgLobbyGameStart:
+		lobby, ok := s.lobbies.get(client.lobby())
+		if !ok {
+			return fmt.Errorf("client %s is not in a lobby", client.ID)
+		}
+		lobby.requestStart(client.ID)
+	case MsgClientInput:
+		inputs, err := ClientInputsFromMessage[I](msg)
+		if err != nil {
+			return err
+		}
+		for i := range inputs {
+			if v, ok := any(inputs[i].Input).(InputValidator); ok {
+				if err := v.Validate(); err != nil {
+					return fmt.Errorf("invalid input from client %s: %w", client.ID, err)
+				}
 			}
-			lobbyID := parts[0]
-			lobby, ok := s.lobbies[lobbyID]
+			// never trust the client to say who it is
+			inputs[i].ClientID = client.ID
+		}
+		lobby, ok := s.lobbies.get(client.lobby())
+		if !ok {
+			return fmt.Errorf("client %s is not in a lobby", client.ID)
+		}
+		lobby.queueInput(inputs)
+	case MsgLobbyClientReady:
+		parts := strings.Split(string(msg.data.Data), "|")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid lobby join message")
+		}
+		lobbyID := parts[0]
+		lobby, ok := s.lobbies.get(lobbyID)
+		if !ok {
+			return fmt.Errorf("lobby not found")
+		}
+		lobby.ready(client)
+	case MsgLobbyPromote: // Promote a client to host
+		parts := strings.Split(string(msg.data.Data), "|")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid lobby promote message")
+		}
+		lobbyID := parts[0]
+		lobby, ok := s.lobbies.get(lobbyID)
+		if !ok {
+			return fmt.Errorf("lobby not found")
+		}
+		lobby.promote(client.ID, parts[1])
+	case MsgLobbyKick:
+		kr, err := KickRequestFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		lobby, ok := s.lobbies.get(kr.LobbyID)
+		if !ok {
+			return fmt.Errorf("lobby not found")
+		}
+		lobby.kick(client.ID, s.access.isModerator(client.ID), kr)
+	case MsgLobbiesSync, MsgLobbiesSubscribe, MsgLobbiesUnsubscribe:
+		q, err := lobbyQueryFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		s.lobbyRequests <- lobbyRequest{client: client, header: msg.header, query: q}
+	case MsgLobbyCreate:
+		nlobby := fmt.Sprintf("%s|%s", randomString(6), client.ID)
+		s.newLobbies <- nlobby
+	case MsgLobbyClientJoin:
+		parts := strings.Split(string(msg.data.Data), "|")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid lobby join message")
+		}
+		s.lobbyJoins <- lobbyJoin{client: client, lobbyID: parts[0]}
+	case MsgPartyCreate, MsgPartyInvite, MsgPartyJoin, MsgPartyLeave:
+		pr, err := PartyRequestFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		s.partyRequests <- partyRequest{client: client, header: msg.header, request: pr}
+	case MsgLobbySettings:
+		lsm, err := LobbySettingsMessageFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		lobby, ok := s.lobbies.get(lsm.LobbyID)
+		if !ok {
+			return fmt.Errorf("lobby not found")
+		}
+		lobby.updateSettings(client.ID, lsm.Settings)
+	case MsgGamePause, MsgGameResume:
+		lobby, ok := s.lobbies.get(client.lobby())
+		if !ok {
+			return fmt.Errorf("client %s is not in a lobby", client.ID)
+		}
+		lobby.requestPause(client.ID, msg.header == MsgGamePause)
+	case MsgLobbyTeam:
+		ta, err := TeamAssignmentFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		lobby, ok := s.lobbies.get(ta.LobbyID)
+		if !ok {
+			return fmt.Errorf("lobby not found")
+		}
+		lobby.assignTeam(client.ID, ta)
+	case MsgVoteCall:
+		call, err := VoteCallFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		lobby, ok := s.lobbies.get(call.LobbyID)
+		if !ok {
+			return fmt.Errorf("lobby not found")
+		}
+		lobby.callVote(client.ID, call)
+	case MsgVoteCast:
+		ballot, err := VoteBallotFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		lobby, ok := s.lobbies.get(ballot.LobbyID)
+		if !ok {
+			return fmt.Errorf("lobby not found")
+		}
+		lobby.castVote(client.ID, ballot)
+	case MsgLobbySpectate:
+		parts := strings.Split(string(msg.data.Data), "|")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid lobby spectate message")
+		}
+		s.lobbyJoins <- lobbyJoin{client: client, lobbyID: parts[0], spectate: true}
+	case MsgLobbyClientLeave:
+		parts := strings.Split(string(msg.data.Data), "|")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid lobby leave message")
+		}
+		lobbyID := parts[0]
+		lobby, ok := s.lobbies.get(lobbyID)
+		if !ok {
+			return fmt.Errorf("lobby not found")
+		}
+		lobby.removeClient(client)
+	case MsgMatchmake:
+		var req MatchmakeRequest
+		if err := json.Unmarshal(msg.data.Data, &req); err != nil {
+			return err
+		}
+		if req.GameType == "" {
+			req.GameType = s.gameType
+		}
+		if req.GameType != s.gameType {
+			return fmt.Errorf("game type %q is not hosted on this server", req.GameType)
+		}
+		if req.GroupSize < s.matchmaker.minGroupSize || req.GroupSize > s.maxLobbySize {
+			return fmt.Errorf("group size %d is not between %d and %d", req.GroupSize, s.matchmaker.minGroupSize, s.maxLobbySize)
+		}
+		s.matchmakeRequests <- matchmakeRequest{client: client, request: &req}
+	case MsgMatchmakeCancel:
+		s.matchmakeRequests <- matchmakeRequest{client: client}
+	case MsgProfile:
+		pm, err := ProfileMessageFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		p, err := validateProfile(pm.Profile)
+		if err != nil {
+			client.send(NewMessage(MsgProfileRejected, FmtText, []byte(err.Error())))
+			return nil
+		}
+		// names only have to be unique within a lobby, so the lobby gets the final say
+		if lobby, ok := s.lobbies.get(client.lobby()); ok && lobby.changeProfile(client, p) {
+			return nil
+		}
+		client.setProfile(p)
+		reply, err := NewProfileMessage(FmtJSON, ProfileMessage{ClientID: client.ID, Profile: p})
+		if err != nil {
+			return err
+		}
+		client.send(reply)
+	case MsgChat:
+		cm, err := ChatMessageFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		if !client.chatLimiter.allow(time.Now()) {
+			return fmt.Errorf("chat rate limit exceeded for client %s", client.ID)
+		}
+		text, ok := sanitizeChat(cm.Text, s.chatMaxLength, s.chatFilter)
+		if !ok {
+			return nil
+		}
+		cm.Text = text
+		cm.From = client.ID
+		cm.FromName = client.displayName()
+		cm.SentAt = time.Now()
+		switch cm.Scope {
+		case ChatLobby:
+			lobby, ok := s.lobbies.get(cm.LobbyID)
 			if !ok {
 				return fmt.Errorf("lobby not found")
 			}
-			if client.ID != lobby.OwnerID {
-				return fmt.Errorf("only the lobby owner can kick clients")
-			}
-			lobby.kick(parts[1])
-		case MsgLobbiesSync:
-			lobbiesSync := s.makeLobbiesSync()
-			data, err := json.Marshal(lobbiesSync)
-			if err != nil {
-				return err
-			}
-			s.log.Printf("syncing lobbies for client %s\n", client.ID)
-			client.sendChan <- NewMessage(MsgLobbiesSynced, FmtJSON, data)
-		case MsgLobbyCreate:
-			nlobby := fmt.Sprintf("%s|%s", randomString(6), client.ID)
-			s.newLobbies <- nlobby
-		case MsgLobbyClientJoin:
-			parts := strings.Split(string(msg.data.Data), "|")
-			if len(parts) != 2 {
-				return fmt.Errorf("invalid lobby join message")
-			}
-			lobbyID := parts[0]
-			lobby := s.lobbies[lobbyID]
-			if lobby == nil {
-				return fmt.Errorf("lobby not found")
-			}
-			lobby.addClient(client)
-		case MsgLobbyClientLeave:
-			parts := strings.Split(string(msg.data.Data), "|")
-			if len(parts) != 2 {
-				return fmt.Errorf("invalid lobby leave message")
-			}
-			lobbyID := parts[0]
-			lobby := s.lobbies[lobbyID]
-			if lobby == nil {
-				return fmt.Errorf("lobby not found")
-			}
-			lobby.removeClient(client)
-			if len(lobby.clients) == 0 {
-				s.closeLobbies <- lobbyID
-			}
+			lobby.chat(cm)
+		case ChatServer:
+			cm.LobbyID = ""
+			s.chatMessages <- cm
+		default:
+			return fmt.Errorf("invalid chat scope")
 		}
+	}
 
-		return nil
-	})
-
-	go client.reader(s.removeClients, mh)
-	s.newClients <- client
+	return nil
 }
 
-func (s *Server[T]) loop() {
+func (s *Server[T, I]) loop() {
+	matchmakeTicker := time.NewTicker(matchmakeInterval)
+	defer matchmakeTicker.Stop()
 	for {
 		select {
 		case msg := <-s.newLobbies:
@@ -308,35 +584,218 @@ func (s *Server[T]) loop() {
 				s.log.Println("Invalid lobby create message")
 				continue
 			}
-			newLobbyCode := parts[0]
-			clientID := parts[1]
-
-			for _, ok := s.lobbies[newLobbyCode]; ok == true; {
-				newLobbyCode = randomString(6)
-			}
-			newLobby := NewGameServer(newLobbyCode, clientID, s.state)
-			client, ok := s.clients[clientID]
+			client, ok := s.clients[parts[1]]
 			if !ok {
-				s.log.Println("Client not found:", clientID)
+				s.log.Println("Client not found:", parts[1])
 				continue
 			}
-			newLobby.addClient(client)
-			s.lobbies[newLobbyCode] = newLobby
-			s.log.Println("New lobby created:", newLobbyCode)
-			// Send the client the lobby code
-			message := NewMessage(MsgLobbyCreated, FmtText, []byte(newLobbyCode))
-			client.sendChan <- message
-
-		case lobbyCode := <-s.closeLobbies:
-			delete(s.lobbies, lobbyCode)
+			if old, ok := s.lobbies.get(client.lobby()); ok {
+				old.removeClient(client)
+			}
+			lobby := s.createLobby(parts[0], client)
+			for _, follower := range s.partyFollowers(client, lobby.ID) {
+				s.moveToLobby(follower, lobby)
+			}
+		case join := <-s.lobbyJoins:
+			if join.spectate {
+				s.spectateLobby(join.client, join.lobbyID)
+				continue
+			}
+			s.joinLobby(join.client, join.lobbyID)
+		case req := <-s.partyRequests:
+			s.handlePartyRequest(req)
+		case req := <-s.matchmakeRequests:
+			leader := req.client
+			if p := s.parties.of(req.client.ID); p != nil {
+				if c, ok := s.clients[p.LeaderID]; ok {
+					leader = c
+				}
+			}
+			if req.request == nil {
+				// any member can take the party out of the queue
+				if s.matchmaker.cancel(leader.ID) {
+					s.sendPartyMatchmakeStatus(leader, MatchmakeStatus{State: MatchmakeCancelled})
+				}
+				continue
+			}
+			if leader != req.client {
+				s.rejectParty(req.client, "only the party leader can queue for matchmaking")
+				continue
+			}
+			party := s.partyFollowers(leader, "")
+			for _, follower := range party {
+				s.matchmaker.cancel(follower.ID)
+			}
+			position := s.matchmaker.enqueue(&matchTicket{
+				client:   leader,
+				party:    party,
+				key:      matchKey{gameType: req.request.GameType, groupSize: req.request.GroupSize},
+				queuedAt: time.Now(),
+			})
+			s.sendPartyMatchmakeStatus(leader, MatchmakeStatus{
+				State:         MatchmakeQueued,
+				Position:      position,
+				EstimatedWait: s.matchmaker.estimate(req.request.GameType),
+			})
+		case now := <-matchmakeTicker.C:
+			s.runMatchmaker(now)
+		case cm := <-s.chatMessages:
+			msg, err := NewChatMessage(FmtJSON, cm)
+			if err != nil {
+				s.log.Println("Error making chat message:", err)
+				continue
+			}
+			for _, client := range s.clients {
+				client.send(msg)
+			}
+		case req := <-s.lobbyRequests:
+			switch req.header {
+			case MsgLobbiesSync:
+				s.log.Printf("syncing lobbies for client %s\n", req.client.ID)
+				s.sendLobbiesSynced(req.client, s.directory.query(req.query))
+			case MsgLobbiesSubscribe:
+				s.log.Printf("client %s subscribed to lobbies\n", req.client.ID)
+				s.sendLobbiesSynced(req.client, s.directory.subscribe(req.client.ID, req.query))
+			case MsgLobbiesUnsubscribe:
+				s.directory.unsubscribe(req.client.ID)
+			}
+		case <-s.lobbyChanges.ready:
+			closed, views := s.lobbyChanges.take()
+			for _, lobbyCode := range closed {
+				s.lobbies.remove(lobbyCode)
+				s.sendLobbyEvents(s.directory.remove(lobbyCode))
+			}
+			for _, view := range views {
+				if _, ok := s.lobbies.get(view.Code); !ok {
+					// late update from a lobby that has already closed
+					continue
+				}
+				s.sendLobbyEvents(s.directory.update(view))
+			}
 		case client := <-s.newClients:
 			fmt.Printf("Adding client %s to server\n", client.ID)
 			s.clients[client.ID] = client
 			message := NewMessage(MsgConnect, FmtText, []byte(client.ID))
-			client.sendChan <- message
+			client.send(message)
+		case <-s.banChecks:
+			now := time.Now()
+			for _, client := range s.clients {
+				if ban, ok := s.access.banned(client.ID, now); ok {
+					s.log.Printf("Disconnecting banned client %s: %s\n", client.ID, ban.Reason)
+					// the reader notices the closed connection and removes the client
+					client.conn.CloseWithError(bannedErrorCode, banMessage(ban))
+				}
+			}
 		case client := <-s.removeClients:
-			close(client.sendChan)
+			if _, ok := s.clients[client.ID]; !ok {
+				continue
+			}
+			s.directory.unsubscribe(client.ID)
+			s.matchmaker.cancel(client.ID)
+			s.leaveParty(client, false)
+			if lobby, ok := s.lobbies.get(client.lobby()); ok {
+				// the lobby migrates or closes on its own goroutine, whatever it still sends the client is dropped
+				lobby.removeClient(client)
+			}
+			delete(s.clients, client.ID)
+			client.close()
 			s.log.Println("Client removed, clients count:", len(s.clients))
 		}
 	}
 }
+
+func (s *Server[T, I]) sendLobbiesSynced(client *client, sync LobbiesSync) {
+	data, err := json.Marshal(sync)
+	if err != nil {
+		s.log.Println("Error encoding lobbies sync:", err)
+		return
+	}
+	client.send(NewMessage(MsgLobbiesSynced, FmtJSON, data))
+}
+
+// sendLobbyEvents delivers directory events and pages to the subscribed clients they are keyed by.
+func (s *Server[T, I]) sendLobbyEvents(events map[string]LobbyEvent, pages map[string]LobbiesSync) {
+	for clientID, page := range pages {
+		if client, ok := s.clients[clientID]; ok {
+			s.sendLobbiesSynced(client, page)
+		}
+	}
+	for clientID, ev := range events {
+		client, ok := s.clients[clientID]
+		if !ok {
+			continue
+		}
+		msg, err := NewLobbyEventMessage(FmtJSON, ev)
+		if err != nil {
+			s.log.Println("Error making lobby event message:", err)
+			continue
+		}
+		client.send(msg)
+	}
+}
+
+// createLobby registers a new lobby owned by owner and adds the owner to it.
+// A new code is generated if the requested one is already taken.
+func (s *Server[T, I]) createLobby(code string, owner *client, opts ...GameServerOption[T, I]) *GameServer[T, I] {
+	for _, ok := s.lobbies.get(code); ok || code == ""; _, ok = s.lobbies.get(code) {
+		code = randomString(6)
+	}
+	opts = append(append([]GameServerOption[T, I]{
+		withLobbyChanges[T, I](s.lobbyChanges),
+		WithLobbyGameType[T, I](s.gameType),
+		WithLobbyTickRate[T, I](s.tickRate),
+		WithLobbyMaxClients[T, I](s.maxLobbySize),
+	}, s.lobbyOptions...), opts...)
+	state := s.state
+	if s.newState != nil {
+		state = s.newState()
+	}
+	lobby := NewGameServer(code, owner.ID, state, opts...)
+	lobby.addClient(owner)
+	s.lobbies.add(lobby)
+	s.log.Println("New lobby created:", code)
+	// Send the client the lobby code
+	owner.send(NewMessage(MsgLobbyCreated, FmtText, []byte(code)))
+	return lobby
+}
+
+// runMatchmaker places every queued client that can be matched into a lobby.
+func (s *Server[T, I]) runMatchmaker(now time.Time) {
+	open := make([]LobbyView, 0, len(s.directory.views))
+	for _, v := range s.directory.views {
+		open = append(open, v)
+	}
+	for _, m := range s.matchmaker.matches(now, open) {
+		tickets := m.tickets
+		var clients []*client
+		for _, t := range tickets {
+			clients = append(clients, t.clients()...)
+		}
+		lobby, ok := s.lobbies.get(m.lobbyCode)
+		if !ok {
+			if old, ok := s.lobbies.get(clients[0].lobby()); ok {
+				old.removeClient(clients[0])
+			}
+			lobby = s.createLobby(randomString(6), clients[0],
+				WithLobbyGameType[T, I](m.key.gameType),
+				WithLobbyMaxClients[T, I](m.key.groupSize),
+			)
+			s.sendMatchmakeStatus(clients[0], MatchmakeStatus{State: MatchmakeMatched, LobbyID: lobby.ID})
+			clients = clients[1:]
+		}
+		for _, c := range clients {
+			s.moveToLobby(c, lobby)
+			s.sendMatchmakeStatus(c, MatchmakeStatus{State: MatchmakeMatched, LobbyID: lobby.ID})
+		}
+		s.log.Printf("Matched %d clients into lobby %s\n", len(m.tickets), lobby.ID)
+	}
+}
+
+func (s *Server[T, I]) sendMatchmakeStatus(client *client, status MatchmakeStatus) {
+	msg, err := NewMatchmakeStatusMessage(FmtJSON, status)
+	if err != nil {
+		s.log.Println("Error making matchmake status message:", err)
+		return
+	}
+	client.send(msg)
+}
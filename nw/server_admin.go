@@ -0,0 +1,67 @@
+package nw
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ban keeps target off the server for d, a non positive d bans it for good.
+// The target is a client ID, or "ip:" followed by an IP address to ban everyone connecting from it.
+// Matching clients are disconnected and the ban is saved to the ban file.
+func (s *Server[T, I]) Ban(target, reason string, d time.Duration) error {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return fmt.Errorf("missing ban target")
+	}
+	b := Ban{Target: target, Reason: reason}
+	if d > 0 {
+		b.Until = time.Now().Add(d)
+	}
+	if err := s.access.ban(b); err != nil {
+		return err
+	}
+	select {
+	case s.banChecks <- struct{}{}:
+	default:
+		// a check is already pending and will see this ban too
+	}
+	return nil
+}
+
+// Unban lifts the ban on target and reports whether there was one.
+func (s *Server[T, I]) Unban(target string) (bool, error) {
+	return s.access.unban(target)
+}
+
+// Bans returns the bans in effect, ordered by target.
+func (s *Server[T, I]) Bans() []Ban {
+	return s.access.list(time.Now())
+}
+
+// SetModerator grants or revokes the moderator role of target, a client ID.
+// Moderators can kick players from any lobby.
+func (s *Server[T, I]) SetModerator(target string, moderator bool) error {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return fmt.Errorf("missing moderator target")
+	}
+	if strings.HasPrefix(target, ipBanPrefix) {
+		return fmt.Errorf("moderators are client IDs, not IP addresses")
+	}
+	return s.access.setModerator(target, moderator)
+}
+
+// Moderators returns the client IDs with the moderator role.
+func (s *Server[T, I]) Moderators() []string {
+	return s.access.listModerators()
+}
+
+// TickStats returns how well every lobby keeps up with the tick rate, keyed by lobby code.
+func (s *Server[T, I]) TickStats() map[string]TickStats {
+	stats := make(map[string]TickStats)
+	for _, lobby := range s.lobbies.all() {
+		stats[lobby.ID] = lobby.TickStats()
+	}
+	return stats
+}
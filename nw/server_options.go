@@ -8,31 +8,125 @@ import (
 	quic "github.com/quic-go/quic-go"
 )
 
-type ServerOption[T any] func(*Server[T])
+type ServerOption[T any, I any] func(*Server[T, I])
 
-func WithLogger[T any](log *log.Logger) ServerOption[T] {
-	return func(s *Server[T]) {
+func WithAddress[T any, I any](address string) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.address = address
+	}
+}
+
+func WithLogger[T any, I any](log *log.Logger) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
 		s.log = log
 	}
 }
-func WithTickRate[T any](rate time.Duration) ServerOption[T] {
-	return func(s *Server[T]) {
+func WithTickRate[T any, I any](rate time.Duration) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
 		s.tickRate = rate
 	}
 }
-func WithStateManager[T any](sm StateManager[T]) ServerOption[T] {
-	return func(s *Server[T]) {
+func WithStateManager[T any, I any](sm StateManager[T, I]) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
 		s.state = sm
 	}
 }
-func WithTLSConfig[T any](tlsConfig *tls.Config) ServerOption[T] {
-	return func(s *Server[T]) {
+
+// WithStateFactory gives every lobby its own state, created by newState when the lobby is created.
+func WithStateFactory[T any, I any](newState func() StateManager[T, I]) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.newState = newState
+	}
+}
+func WithTLSConfig[T any, I any](tlsConfig *tls.Config) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
 		s.tlsConfig = tlsConfig
 	}
 }
 
-func WithQuicConfig[T any](quicConfig *quic.Config) ServerOption[T] {
-	return func(s *Server[T]) {
+func WithQuicConfig[T any, I any](quicConfig *quic.Config) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
 		s.quicConfig = quicConfig
 	}
 }
+
+// WithChatFilter sets the filter every chat message passes through before delivery.
+func WithChatFilter[T any, I any](filter ChatFilter) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.chatFilter = filter
+	}
+}
+
+// WithChatMaxLength sets the maximum length of a chat message, longer messages are truncated.
+func WithChatMaxLength[T any, I any](maxLength int) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.chatMaxLength = maxLength
+	}
+}
+
+// WithChatRateLimit allows each client to send at most n chat messages per window.
+// A non positive n disables rate limiting.
+func WithChatRateLimit[T any, I any](n int, window time.Duration) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.chatRate = n
+		s.chatWindow = window
+	}
+}
+
+// WithGameType sets the game type advertised by every lobby on the server.
+func WithGameType[T any, I any](gameType string) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.gameType = gameType
+	}
+}
+
+// WithMatchmakeTimeout sets how long the oldest player in a quick play queue waits
+// before a match smaller than the requested group size is formed.
+func WithMatchmakeTimeout[T any, I any](timeout time.Duration) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.matchmaker.timeout = timeout
+	}
+}
+
+// WithMatchmakeMinGroupSize sets the smallest match formed once the matchmaking timeout passes.
+func WithMatchmakeMinGroupSize[T any, I any](n int) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.matchmaker.minGroupSize = n
+	}
+}
+
+// WithMaxLobbySize sets the number of players a lobby created on the server takes,
+// it is also the largest group matchmaking accepts.
+func WithMaxLobbySize[T any, I any](n int) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.maxLobbySize = n
+	}
+}
+
+// WithLobbyOptions applies opts to every lobby created on the server.
+func WithLobbyOptions[T any, I any](opts ...GameServerOption[T, I]) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.lobbyOptions = append(s.lobbyOptions, opts...)
+	}
+}
+
+// WithBanFile keeps the server wide bans and moderators in the file at path so they survive restarts.
+func WithBanFile[T any, I any](path string) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.banFile = path
+	}
+}
+
+// WithModerators lets the given client IDs kick players from any lobby.
+func WithModerators[T any, I any](targets ...string) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.moderators = append(s.moderators, targets...)
+	}
+}
+
+// WithMaxPartySize sets the number of players a party can hold, its leader included.
+func WithMaxPartySize[T any, I any](n int) ServerOption[T, I] {
+	return func(s *Server[T, I]) {
+		s.parties.maxSize = n
+	}
+}
@@ -0,0 +1,164 @@
+package nw
+
+import "fmt"
+
+// joinLobby moves client into a lobby, the party it leads follows if the lobby has room for everyone.
+func (s *Server[T, I]) joinLobby(c *client, lobbyID string) {
+	lobby, ok := s.lobbies.get(lobbyID)
+	if !ok {
+		c.send(NewMessage(MsgLobbyJoinRejected, FmtText, []byte(fmt.Sprintf("%s|%s", lobbyID, "lobby not found"))))
+		return
+	}
+	followers := s.partyFollowers(c, lobbyID)
+	needed := len(followers)
+	if c.lobby() != lobbyID {
+		needed++
+	}
+	if v, ok := s.directory.views[lobbyID]; ok && len(followers) > 0 && v.MaxClients-v.NumClients < needed {
+		c.send(NewMessage(MsgLobbyJoinRejected, FmtText, []byte(fmt.Sprintf("%s|%s", lobbyID, "not enough room for your party"))))
+		return
+	}
+	s.moveToLobby(c, lobby)
+	for _, follower := range followers {
+		s.moveToLobby(follower, lobby)
+	}
+}
+
+// spectateLobby takes c out of the lobby it is in, if any, and has it watch lobbyID instead.
+func (s *Server[T, I]) spectateLobby(c *client, lobbyID string) {
+	lobby, ok := s.lobbies.get(lobbyID)
+	if !ok {
+		c.send(NewMessage(MsgLobbyJoinRejected, FmtText, []byte(fmt.Sprintf("%s|%s", lobbyID, "lobby not found"))))
+		return
+	}
+	if c.lobby() == lobbyID {
+		c.send(NewMessage(MsgLobbyJoinRejected, FmtText, []byte(fmt.Sprintf("%s|%s", lobbyID, "already in lobby"))))
+		return
+	}
+	if old, ok := s.lobbies.get(c.lobby()); ok {
+		old.removeClient(c)
+	}
+	lobby.addSpectator(c)
+}
+
+// moveToLobby takes c out of the lobby it is in, if any, and adds it to lobby.
+func (s *Server[T, I]) moveToLobby(c *client, lobby *GameServer[T, I]) {
+	if old, ok := s.lobbies.get(c.lobby()); ok && old != lobby {
+		old.removeClient(c)
+	}
+	lobby.addClient(c)
+}
+
+// partyFollowers returns the connected members of the party c leads that are not in lobbyID yet.
+// It returns nil if c leads no party.
+func (s *Server[T, I]) partyFollowers(c *client, lobbyID string) []*client {
+	var followers []*client
+	for _, id := range s.parties.followers(c.ID) {
+		follower, ok := s.clients[id]
+		if ok && (lobbyID == "" || follower.lobby() != lobbyID) {
+			followers = append(followers, follower)
+		}
+	}
+	return followers
+}
+
+func (s *Server[T, I]) handlePartyRequest(req partyRequest) {
+	var (
+		p   *Party
+		err error
+	)
+	switch req.header {
+	case MsgPartyCreate:
+		id := randomString(6)
+		for _, taken := s.parties.parties[id]; taken; _, taken = s.parties.parties[id] {
+			id = randomString(6)
+		}
+		p, err = s.parties.create(id, req.client.ID)
+	case MsgPartyInvite:
+		target, ok := s.clients[req.request.ClientID]
+		if !ok {
+			s.rejectParty(req.client, "player not found")
+			return
+		}
+		p, err = s.parties.invite(req.client.ID, target.ID)
+		if err == nil {
+			s.sendPartyInvite(target, PartyInvite{PartyID: p.ID, FromID: req.client.ID, FromName: req.client.displayName()})
+		}
+	case MsgPartyJoin:
+		p, err = s.parties.join(req.client.ID, req.request.PartyID)
+		if err == nil {
+			// the party's ticket was queued without the newcomer
+			s.cancelPartyMatchmake(p)
+		}
+	case MsgPartyLeave:
+		s.leaveParty(req.client, true)
+		return
+	}
+	if err != nil {
+		s.rejectParty(req.client, err.Error())
+		return
+	}
+	s.syncParty(p)
+}
+
+// leaveParty takes c out of its party, notify tells c it is in none anymore.
+func (s *Server[T, I]) leaveParty(c *client, notify bool) {
+	p := s.parties.of(c.ID)
+	if p == nil {
+		return
+	}
+	// the party's ticket was queued with c in it
+	s.cancelPartyMatchmake(p)
+	if rest := s.parties.leave(c.ID); rest != nil {
+		s.syncParty(rest)
+	}
+	if notify {
+		s.sendParty(c, Party{})
+	}
+}
+
+// cancelPartyMatchmake takes the ticket of p's leader out of the matchmaking queue.
+func (s *Server[T, I]) cancelPartyMatchmake(p *Party) {
+	if leader, ok := s.clients[p.LeaderID]; ok && s.matchmaker.cancel(leader.ID) {
+		s.sendPartyMatchmakeStatus(leader, MatchmakeStatus{State: MatchmakeCancelled})
+	}
+}
+
+// syncParty sends p to all of its members.
+func (s *Server[T, I]) syncParty(p *Party) {
+	for _, id := range p.Members {
+		if member, ok := s.clients[id]; ok {
+			s.sendParty(member, *p)
+		}
+	}
+}
+
+func (s *Server[T, I]) sendParty(c *client, p Party) {
+	msg, err := NewPartySyncMessage(FmtJSON, p)
+	if err != nil {
+		s.log.Println("Error making party sync message:", err)
+		return
+	}
+	c.send(msg)
+}
+
+func (s *Server[T, I]) sendPartyInvite(c *client, pi PartyInvite) {
+	msg, err := NewPartyInviteMessage(FmtJSON, pi)
+	if err != nil {
+		s.log.Println("Error making party invite message:", err)
+		return
+	}
+	c.send(msg)
+}
+
+func (s *Server[T, I]) rejectParty(c *client, reason string) {
+	c.send(NewMessage(MsgPartyRejected, FmtText, []byte(reason)))
+}
+
+// sendPartyMatchmakeStatus sends status to leader and the members of the party it leads.
+func (s *Server[T, I]) sendPartyMatchmakeStatus(leader *client, status MatchmakeStatus) {
+	s.sendMatchmakeStatus(leader, status)
+	for _, follower := range s.partyFollowers(leader, "") {
+		s.sendMatchmakeStatus(follower, status)
+	}
+}
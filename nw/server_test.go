@@ -0,0 +1,839 @@
+package nw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countState is a StateManager that counts the inputs applied to each entity.
+type countState struct {
+	entities map[string]int
+	// goal ends the match once an entity got that many inputs, 0 never ends it
+	goal int
+}
+
+func newCountState() StateManager[map[string]int, string] {
+	return &countState{entities: make(map[string]int)}
+}
+
+// countStateUntil creates count states whose matches end once a player made goal inputs.
+func countStateUntil(goal int) func() StateManager[map[string]int, string] {
+	return func() StateManager[map[string]int, string] {
+		return &countState{entities: make(map[string]int), goal: goal}
+	}
+}
+
+func (s *countState) Update(dt float64) {}
+
+func (s *countState) ApplyInputToState(ci ClientInput[string]) {
+	if _, ok := s.entities[ci.ClientID]; ok {
+		s.entities[ci.ClientID]++
+	}
+}
+
+func (s *countState) InitClientEntity(clientID string, team int) {
+	s.entities[clientID] = 0
+}
+
+func (s *countState) RemoveClientEntity(clientID string) {
+	delete(s.entities, clientID)
+}
+
+func (s *countState) Get() map[string]int {
+	return s.entities
+}
+
+func (s *countState) GameOver() (GameOver, bool) {
+	for id, n := range s.entities {
+		if s.goal > 0 && n >= s.goal {
+			return GameOver{Reason: id + " reached the goal"}, true
+		}
+	}
+	return GameOver{}, false
+}
+
+func (s *countState) Reset() {
+	s.entities = make(map[string]int)
+}
+
+// testTimeout is how long the tests wait for the server, it covers a ready check interval
+const testTimeout = 3 * time.Second
+
+// testClient is a client without a connection, it records the messages sent to it by header.
+type testClient struct {
+	*client
+	mu   sync.Mutex
+	seen map[MessageHeader][]string
+	// headers holds the header of every message in the order they came
+	headers []MessageHeader
+	// seq numbers the inputs the client sends
+	seq uint32
+}
+
+func newTestClient(id string) *testClient {
+	c := &testClient{
+		client: newClient(id, nil, nil, newRateLimiter(defaultChatRate, defaultChatWindow)),
+		seen:   make(map[MessageHeader][]string),
+	}
+	go func() {
+		for msg := range c.sendChan {
+			c.mu.Lock()
+			c.seen[msg.header] = append(c.seen[msg.header], string(msg.data.Data))
+			c.headers = append(c.headers, msg.header)
+			c.mu.Unlock()
+		}
+	}()
+	return c
+}
+
+// messages returns the data of the messages with header the client got so far, oldest first.
+func (c *testClient) messages(header MessageHeader) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.seen[header])
+}
+
+// count returns how many messages with header and data the client got so far.
+func (c *testClient) count(header MessageHeader, data string) int {
+	n := 0
+	for _, got := range c.messages(header) {
+		if got == data {
+			n++
+		}
+	}
+	return n
+}
+
+// wait returns the data of the first message with header the client got, it fails the test after testTimeout.
+func (c *testClient) wait(t *testing.T, header MessageHeader) string {
+	t.Helper()
+	var seen []string
+	eventually(t, fmt.Sprintf("client %s to get message %d", c.ID, header), func() bool {
+		seen = c.messages(header)
+		return len(seen) > 0
+	})
+	return seen[0]
+}
+
+// expect waits until the client got n messages with header and data.
+func (c *testClient) expect(t *testing.T, header MessageHeader, data string, n int) {
+	t.Helper()
+	eventually(t, fmt.Sprintf("client %s to get message %d %q %d times", c.ID, header, data, n), func() bool {
+		return c.count(header, data) >= n
+	})
+}
+
+func (c *testClient) send(t *testing.T, s *Server[map[string]int, string], header MessageHeader, data string) {
+	t.Helper()
+	msg := NewMessage(header, FmtText, []byte(data))
+	if header == MsgClientInput {
+		c.seq++
+		var err error
+		if msg, err = NewClientInputMessage(FmtJSON, []ClientInput[string]{{Input: data, Sequence: c.seq}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.sendMessage(t, s, msg)
+}
+
+func (c *testClient) sendMessage(t *testing.T, s *Server[map[string]int, string], msg Message) {
+	t.Helper()
+	// handler errors are expected, the lobby may have closed in between
+	s.handleMessage(c.client, msg)
+}
+
+// decode unmarshals the data of a JSON message.
+func decode[V any](t *testing.T, data string) V {
+	t.Helper()
+	var v V
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("decoding %q: %v", data, err)
+	}
+	return v
+}
+
+// newTestServer starts the loop of a server whose lobbies count inputs and start right away.
+func newTestServer(opts ...ServerOption[map[string]int, string]) *Server[map[string]int, string] {
+	s := NewServer[map[string]int, string](nil, append([]ServerOption[map[string]int, string]{
+		WithLogger[map[string]int, string](log.New(io.Discard, "", 0)),
+		WithStateFactory[map[string]int, string](newCountState),
+		WithLobbyOptions(WithCountdown[map[string]int, string](0)),
+	}, opts...)...)
+	go s.loop()
+	return s
+}
+
+// connect creates a connected client, it creates a lobby if create is set and returns the client and the lobby code.
+func connect(t *testing.T, s *Server[map[string]int, string], id string, create bool) (*testClient, string) {
+	t.Helper()
+	c := newTestClient(id)
+	c.send(t, s, MsgConnect, "")
+	if !create {
+		return c, ""
+	}
+	c.send(t, s, MsgLobbyCreate, "")
+	return c, c.wait(t, MsgLobbyCreated)
+}
+
+// join adds c to the lobby and waits until it is in.
+func (c *testClient) join(t *testing.T, s *Server[map[string]int, string], code string) {
+	t.Helper()
+	n := c.count(MsgLobbyClientJoin, code+"|"+c.ID)
+	c.send(t, s, MsgLobbyClientJoin, code+"|"+c.ID)
+	c.expect(t, MsgLobbyClientJoin, code+"|"+c.ID, n+1)
+}
+
+// lobbyClosed reports whether the lobby is gone from the server.
+func lobbyClosed(s *Server[map[string]int, string], code string) func() bool {
+	return func() bool {
+		_, ok := s.lobbies.get(code)
+		return !ok
+	}
+}
+
+// eventually fails the test if cond does not hold within testTimeout.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestServerConcurrentLobbyAccess joins, leaves and plays from many clients at once while the match ticks,
+// it is meant to be run with -race.
+func TestServerConcurrentLobbyAccess(t *testing.T) {
+	s := newTestServer(WithMaxLobbySize[map[string]int, string](16))
+	owner, code := connect(t, s, "owner", true)
+	owner.send(t, s, MsgLobbyClientReady, code+"|"+owner.ID)
+	owner.send(t, s, MsgLobbyGameStart, "")
+	owner.wait(t, MsgLobbyGameStarted)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		c := newTestClient(fmt.Sprintf("player-%d", i))
+		c.send(t, s, MsgConnect, "")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				c.send(t, s, MsgLobbyClientJoin, code+"|"+c.ID)
+				c.send(t, s, MsgLobbyClientReady, code+"|"+c.ID)
+				c.send(t, s, MsgClientInput, "up")
+				c.send(t, s, MsgLobbiesSync, "")
+				c.send(t, s, MsgLobbyClientLeave, code+"|"+c.ID)
+			}
+			// disconnecting while in the lobby must not leave the lobby sending to a closed client
+			c.send(t, s, MsgLobbyClientJoin, code+"|"+c.ID)
+			c.send(t, s, MsgDisconnect, "")
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 50; j++ {
+			owner.send(t, s, MsgClientInput, "up")
+			s.TickStats()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	wg.Wait()
+
+	owner.wait(t, MsgServerState)
+	if stats := s.TickStats()[code]; stats.Tick == 0 {
+		t.Errorf("got no ticks in %+v", stats)
+	}
+	if _, ok := s.lobbies.get(code); !ok {
+		t.Errorf("lobby %s closed while its owner is still in it", code)
+	}
+
+	owner.send(t, s, MsgDisconnect, "")
+	eventually(t, "the lobby to close after everyone disconnected", lobbyClosed(s, code))
+}
+
+func TestClientSendDisconnectsSlowClient(t *testing.T) {
+	// nothing drains the client, its buffer fills up
+	c := newClient("slow", nil, nil, newRateLimiter(defaultChatRate, defaultChatWindow))
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i := 0; i <= clientSendBuffer; i++ {
+			c.send(NewMessage(MsgServerState, FmtText, nil))
+		}
+	}()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("send blocked on a client that does not keep up")
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Error("client that does not keep up is still connected")
+	}
+}
+
+func TestServerSpectate(t *testing.T) {
+	s := newTestServer()
+	a, codeA := connect(t, s, "a", true)
+	b, codeB := connect(t, s, "b", true)
+
+	a.send(t, s, MsgLobbySpectate, codeA+"|"+a.ID)
+	if got := a.wait(t, MsgLobbyJoinRejected); got != codeA+"|already in lobby" {
+		t.Errorf("got rejection %q for spectating the own lobby", got)
+	}
+
+	// spectating another lobby leaves the current one, a's lobby is empty then
+	a.send(t, s, MsgLobbySpectate, codeB+"|"+a.ID)
+	a.wait(t, MsgLobbySpectate)
+	if got := a.wait(t, MsgLobbyClientLeave); got != codeA+"|"+a.ID {
+		t.Errorf("got leave %q, want a to leave %s", got, codeA)
+	}
+	eventually(t, "the empty lobby to close", lobbyClosed(s, codeA))
+	if a.lobby() != codeB {
+		t.Errorf("got lobby %q, want %s", a.lobby(), codeB)
+	}
+
+	b.send(t, s, MsgLobbySpectate, codeB+"|"+b.ID)
+	if got := b.wait(t, MsgLobbyJoinRejected); got != codeB+"|already in lobby" {
+		t.Errorf("got rejection %q for spectating the own lobby", got)
+	}
+
+	// the lobby rejects a member whose join has not reached the client yet
+	c, _ := connect(t, s, "c", false)
+	c.send(t, s, MsgLobbyClientJoin, codeB+"|"+c.ID)
+	c.send(t, s, MsgLobbySpectate, codeB+"|"+c.ID)
+	if got := c.wait(t, MsgLobbyJoinRejected); got != codeB+"|already in lobby" {
+		t.Errorf("got rejection %q for spectating a lobby just joined", got)
+	}
+}
+
+func TestServerSpectatorDelay(t *testing.T) {
+	s := newTestServer(WithLobbyOptions(
+		WithGameModes("race", map[string]func() StateManager[map[string]int, string]{"race": countStateUntil(1)}),
+		WithSpectatorDelay[map[string]int, string](300*time.Millisecond),
+	))
+	a, code := connect(t, s, "a", true)
+	spectator, _ := connect(t, s, "spectator", false)
+	spectator.send(t, s, MsgLobbySpectate, code+"|spectator")
+	spectator.wait(t, MsgLobbySpectate)
+	a.send(t, s, MsgLobbyClientReady, code+"|a")
+	a.send(t, s, MsgLobbyGameStart, "")
+	a.wait(t, MsgLobbyGameStarted)
+
+	a.send(t, s, MsgClientInput, "up")
+	a.wait(t, MsgGameOver)
+	if n := len(spectator.messages(MsgGameOver)); n != 0 {
+		t.Errorf("spectator got %d game overs as the match ended, want them delayed", n)
+	}
+	// nothing is broadcast after the match, the delayed states and the game over are released on their own
+	spectator.wait(t, MsgGameOver)
+	if got := spectator.lastState(t)["a"]; got != 1 {
+		t.Errorf("spectator got %d inputs in the last state before the game over, want 1", got)
+	}
+}
+
+func TestServerLateJoin(t *testing.T) {
+	for _, lateJoin := range []bool{true, false} {
+		t.Run(fmt.Sprintf("late join %v", lateJoin), func(t *testing.T) {
+			s := newTestServer(WithLobbyOptions(WithLobbySettings[map[string]int, string](LobbySettings{LateJoin: lateJoin})))
+			a, code := connect(t, s, "a", true)
+			a.send(t, s, MsgLobbyClientReady, code+"|a")
+			a.send(t, s, MsgLobbyGameStart, "")
+			a.wait(t, MsgLobbyGameStarted)
+
+			late, _ := connect(t, s, "late", false)
+			late.send(t, s, MsgLobbyClientJoin, code+"|late")
+			if !lateJoin {
+				if got := late.wait(t, MsgLobbyJoinRejected); got != code+"|game already started" {
+					t.Errorf("got rejection %q, want the game already started", got)
+				}
+				return
+			}
+			late.wait(t, MsgLobbyGameStarted)
+			late.wait(t, MsgServerState)
+			late.mu.Lock()
+			started := slices.Index(late.headers, MsgLobbyGameStarted)
+			state := slices.Index(late.headers, MsgServerState)
+			late.mu.Unlock()
+			if state < started {
+				t.Error("got a state before the game started message")
+			}
+			// the first state is the snapshot with the late joiner's entity in it
+			if _, ok := decode[ServerStateMessage[map[string]int]](t, late.wait(t, MsgServerState)).GameState["late"]; !ok {
+				t.Error("got a first state without the late joiner's entity")
+			}
+		})
+	}
+}
+
+func TestServerMatchmakeGroupSize(t *testing.T) {
+	s := newTestServer(WithMaxLobbySize[map[string]int, string](4))
+	c, _ := connect(t, s, "c", false)
+	tests := []struct {
+		size    int
+		wantErr bool
+	}{
+		{size: 0, wantErr: true},
+		{size: defaultMatchmakeMinGroupSize - 1, wantErr: true},
+		{size: defaultMatchmakeMinGroupSize},
+		{size: 4},
+		{size: 5, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.size), func(t *testing.T) {
+			msg, err := NewMatchmakeMessage(FmtJSON, MatchmakeRequest{GroupSize: tt.size})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.handleMessage(c.client, msg); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServerHostMigration(t *testing.T) {
+	s := newTestServer()
+	a, code := connect(t, s, "a", true)
+	b, _ := connect(t, s, "b", false)
+	c, _ := connect(t, s, "c", false)
+	b.join(t, s, code)
+	c.join(t, s, code)
+
+	// the longest connected member takes over from an owner that disconnects
+	a.send(t, s, MsgDisconnect, "")
+	b.expect(t, MsgLobbyPromoted, code+"|b", 1)
+	c.expect(t, MsgLobbyPromoted, code+"|b", 1)
+
+	// and from one that leaves
+	b.send(t, s, MsgLobbyClientLeave, code+"|b")
+	c.expect(t, MsgLobbyPromoted, code+"|c", 1)
+	c.send(t, s, MsgLobbyClientReady, code+"|c")
+	c.send(t, s, MsgLobbyGameStart, "")
+	c.wait(t, MsgLobbyGameStarted)
+
+	c.send(t, s, MsgDisconnect, "")
+	eventually(t, "the lobby to close after its last member disconnected", lobbyClosed(s, code))
+}
+
+func TestServerMatchEnd(t *testing.T) {
+	s := newTestServer(WithLobbyOptions(WithGameModes("race", map[string]func() StateManager[map[string]int, string]{
+		"race": countStateUntil(3),
+	})))
+	a, code := connect(t, s, "a", true)
+	b, _ := connect(t, s, "b", false)
+	spectator, _ := connect(t, s, "spectator", false)
+	b.join(t, s, code)
+	spectator.send(t, s, MsgLobbySpectate, code+"|spectator")
+	spectator.wait(t, MsgLobbySpectate)
+
+	a.send(t, s, MsgLobbyClientReady, code+"|a")
+	b.send(t, s, MsgLobbyClientReady, code+"|b")
+	a.send(t, s, MsgLobbyGameStart, "")
+	a.wait(t, MsgLobbyGameStarted)
+	for i := 0; i < 3; i++ {
+		a.send(t, s, MsgClientInput, "up")
+	}
+
+	for _, c := range []*testClient{a, b, spectator} {
+		over := decode[GameOver](t, c.wait(t, MsgGameOver))
+		if over.LobbyID != code || over.Reason != "a reached the goal" {
+			t.Errorf("client %s got %+v, want a to win in %s", c.ID, over, code)
+		}
+	}
+
+	// the lobby is back in the ready check, nobody is ready for the rematch
+	a.send(t, s, MsgLobbyGameStart, "")
+	a.wait(t, MsgLobbyClientsNotReady)
+
+	// a player leaving between matches does not hold up the rematch
+	b.send(t, s, MsgDisconnect, "")
+	a.expect(t, MsgLobbyClientLeave, code+"|b", 1)
+	a.send(t, s, MsgLobbyClientReady, code+"|a")
+	a.send(t, s, MsgLobbyGameStart, "")
+	a.expect(t, MsgLobbyGameStarted, "", 2)
+}
+
+// setProfile asks to change the profile of c.
+func (c *testClient) setProfile(t *testing.T, s *Server[map[string]int, string], p Profile) {
+	t.Helper()
+	msg, err := NewProfileMessage(FmtJSON, ProfileMessage{ClientID: c.ID, Profile: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendMessage(t, s, msg)
+}
+
+func TestServerProfiles(t *testing.T) {
+	s := newTestServer()
+	a, code := connect(t, s, "a", true)
+	b, _ := connect(t, s, "b", false)
+	b.join(t, s, code)
+
+	a.setProfile(t, s, Profile{Name: "Snek", Color: 0xFF0000FF})
+	eventually(t, "b to see a's name", func() bool {
+		for _, data := range b.messages(MsgProfile) {
+			if pm := decode[ProfileMessage](t, data); pm.ClientID == "a" && pm.Profile.Name == "Snek" {
+				return true
+			}
+		}
+		return false
+	})
+	eventually(t, "the lobby list to show the owner's name", func() bool {
+		b.send(t, s, MsgLobbiesSync, "")
+		msgs := b.messages(MsgLobbiesSynced)
+		if len(msgs) == 0 {
+			return false
+		}
+		for _, v := range decode[LobbiesSync](t, msgs[len(msgs)-1]).Lobbies {
+			if v.Code == code {
+				return v.OwnerName == "Snek"
+			}
+		}
+		return false
+	})
+
+	// names are unique within the lobby regardless of case
+	b.setProfile(t, s, Profile{Name: "snek"})
+	b.expect(t, MsgProfileRejected, "name already taken in lobby", 1)
+
+	// joining with a name that is taken in the lobby is rejected too
+	c, _ := connect(t, s, "c", false)
+	c.setProfile(t, s, Profile{Name: "SNEK"})
+	c.wait(t, MsgProfile)
+	c.send(t, s, MsgLobbyClientJoin, code+"|c")
+	c.expect(t, MsgLobbyJoinRejected, code+"|name already taken in lobby", 1)
+}
+
+// lastState returns the latest state c got, nil if none.
+func (c *testClient) lastState(t *testing.T) map[string]int {
+	t.Helper()
+	msgs := c.messages(MsgServerState)
+	if len(msgs) == 0 {
+		return nil
+	}
+	return decode[ServerStateMessage[map[string]int]](t, msgs[len(msgs)-1]).GameState
+}
+
+func TestServerPause(t *testing.T) {
+	s := newTestServer(WithLobbyOptions(WithResumeCountdown[map[string]int, string](0)))
+	a, code := connect(t, s, "a", true)
+	b, _ := connect(t, s, "b", false)
+	spectator, _ := connect(t, s, "spectator", false)
+	b.join(t, s, code)
+	spectator.send(t, s, MsgLobbySpectate, code+"|spectator")
+	spectator.wait(t, MsgLobbySpectate)
+	a.send(t, s, MsgLobbyClientReady, code+"|a")
+	b.send(t, s, MsgLobbyClientReady, code+"|b")
+	a.send(t, s, MsgLobbyGameStart, "")
+	a.wait(t, MsgLobbyGameStarted)
+
+	// only the owner pauses
+	b.send(t, s, MsgGamePause, "")
+	a.send(t, s, MsgGamePause, "")
+	a.expect(t, MsgGamePause, code, 1)
+
+	// the frozen state keeps flowing, inputs made meanwhile are dropped
+	a.send(t, s, MsgClientInput, "up")
+	sent := len(a.messages(MsgServerState))
+	eventually(t, "states while paused", func() bool {
+		return len(a.messages(MsgServerState)) > sent+2
+	})
+	if got := a.lastState(t)["a"]; got != 0 {
+		t.Errorf("got %d inputs applied while paused, want 0", got)
+	}
+
+	a.send(t, s, MsgGameResume, "")
+	for _, c := range []*testClient{a, b, spectator} {
+		c.expect(t, MsgGameResume, code, 1)
+		if n := c.count(MsgGamePause, code); n != 1 {
+			t.Errorf("client %s got %d pauses, want 1", c.ID, n)
+		}
+	}
+	a.send(t, s, MsgClientInput, "up")
+	eventually(t, "the input after resuming to be applied", func() bool {
+		return a.lastState(t)["a"] == 1
+	})
+
+	// the new owner resumes a match the old one paused before disconnecting
+	a.send(t, s, MsgGamePause, "")
+	b.expect(t, MsgGamePause, code, 2)
+	a.send(t, s, MsgDisconnect, "")
+	b.expect(t, MsgLobbyPromoted, code+"|b", 1)
+	b.send(t, s, MsgGameResume, "")
+	b.expect(t, MsgGameResume, code, 2)
+	spectator.expect(t, MsgGameResume, code, 2)
+}
+
+func TestServerReadyCheck(t *testing.T) {
+	s := newTestServer(WithLobbyOptions(
+		WithCountdown[map[string]int, string](3),
+		WithReadyTimeout[map[string]int, string](100*time.Millisecond),
+	))
+	a, code := connect(t, s, "a", true)
+	b, _ := connect(t, s, "b", false)
+	a.send(t, s, MsgLobbyClientReady, code+"|a")
+	b.join(t, s, code)
+	b.send(t, s, MsgLobbyClientReady, code+"|b")
+
+	a.send(t, s, MsgLobbyGameStart, "")
+	a.expect(t, MsgLobbyGameStarted, `{"countdown": 3}`, 1)
+	// unreadying cancels the countdown
+	b.send(t, s, MsgLobbyClientReady, code+"|b")
+	a.expect(t, MsgLobbyCountdownCancelled, "b is no longer ready", 1)
+
+	// b does not ready up again in time and is removed, without a ban
+	kicked := decode[Kicked](t, b.wait(t, MsgLobbyKicked))
+	if kicked.Reason != "not ready in time" || !kicked.BannedUntil.IsZero() {
+		t.Errorf("got %+v, want an unbanned kick for not being ready", kicked)
+	}
+	a.expect(t, MsgLobbyClientLeave, code+"|b", 1)
+	if msgs := a.messages(MsgLobbyKicked); len(msgs) != 0 {
+		t.Errorf("the ready owner was kicked: %v", msgs)
+	}
+	b.join(t, s, code)
+}
+
+// kick asks to remove target from the lobby on behalf of c.
+func (c *testClient) kick(t *testing.T, s *Server[map[string]int, string], code, target, reason string) {
+	t.Helper()
+	msg, err := NewKickRequestMessage(FmtJSON, KickRequest{LobbyID: code, ClientID: target, Reason: reason})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendMessage(t, s, msg)
+}
+
+func TestServerKickBans(t *testing.T) {
+	s := newTestServer()
+	a, code := connect(t, s, "a", true)
+	b, _ := connect(t, s, "b", false)
+	c, _ := connect(t, s, "c", false)
+	moderator, _ := connect(t, s, "moderator", false)
+	if err := s.SetModerator("moderator", true); err != nil {
+		t.Fatal(err)
+	}
+	b.join(t, s, code)
+	c.join(t, s, code)
+
+	// only the owner and moderators kick
+	b.kick(t, s, code, "c", "no reason")
+	a.kick(t, s, code, "b", "spamming")
+	kicked := decode[Kicked](t, b.wait(t, MsgLobbyKicked))
+	if kicked.LobbyID != code || kicked.Reason != "spamming" || !kicked.BannedUntil.After(time.Now()) {
+		t.Errorf("got %+v, want a ban from %s for spamming", kicked, code)
+	}
+	b.expect(t, MsgLobbyClientLeave, code+"|b", 1)
+	if msgs := c.messages(MsgLobbyKicked); len(msgs) != 0 {
+		t.Errorf("c was kicked by a member: %v", msgs)
+	}
+
+	// the ban holds for joining, spectating and after reconnecting
+	banned := code + "|banned from lobby"
+	b.send(t, s, MsgLobbyClientJoin, code+"|b")
+	b.expect(t, MsgLobbyJoinRejected, banned, 1)
+	b.send(t, s, MsgLobbySpectate, code+"|b")
+	b.expect(t, MsgLobbyJoinRejected, banned, 2)
+	b.send(t, s, MsgDisconnect, "")
+	b, _ = connect(t, s, "b", false)
+	b.send(t, s, MsgLobbyClientJoin, code+"|b")
+	b.expect(t, MsgLobbyJoinRejected, banned, 1)
+
+	moderator.kick(t, s, code, "c", "cheating")
+	if kicked := decode[Kicked](t, c.wait(t, MsgLobbyKicked)); kicked.Reason != "cheating" {
+		t.Errorf("got %+v, want c kicked for cheating", kicked)
+	}
+}
+
+// voteStatus returns the latest status of vote id c got, the zero status if none.
+func (c *testClient) voteStatus(t *testing.T, id int) VoteStatus {
+	t.Helper()
+	var latest VoteStatus
+	for _, data := range c.messages(MsgVoteStatus) {
+		if vs := decode[VoteStatus](t, data); vs.ID == id {
+			latest = vs
+		}
+	}
+	return latest
+}
+
+// callVote opens a vote in the lobby on behalf of c.
+func (c *testClient) callVote(t *testing.T, s *Server[map[string]int, string], code string, vt VoteType, target string) {
+	t.Helper()
+	msg, err := NewVoteCallMessage(FmtJSON, VoteCall{LobbyID: code, Type: vt, Target: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendMessage(t, s, msg)
+}
+
+// castVote answers vote id on behalf of c.
+func (c *testClient) castVote(t *testing.T, s *Server[map[string]int, string], code string, id int, yes bool) {
+	t.Helper()
+	msg, err := NewVoteBallotMessage(FmtJSON, VoteBallot{LobbyID: code, VoteID: id, Yes: yes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendMessage(t, s, msg)
+}
+
+func TestServerVoteKick(t *testing.T) {
+	s := newTestServer()
+	a, code := connect(t, s, "a", true)
+	b, _ := connect(t, s, "b", false)
+	c, _ := connect(t, s, "c", false)
+	b.join(t, s, code)
+	c.join(t, s, code)
+
+	// the target disconnecting makes the vote moot
+	a.callVote(t, s, code, VoteKick, "c")
+	first := decode[VoteStatus](t, b.wait(t, MsgVoteStatus))
+	if first.State != VoteOpen || first.Target != "c" || first.Yes != 1 || first.Needed != 2 {
+		t.Fatalf("got %+v, want an open vote on c with a's yes", first)
+	}
+	c.send(t, s, MsgDisconnect, "")
+	eventually(t, "the vote to be cancelled", func() bool {
+		return b.voteStatus(t, first.ID).State == VoteCancelled
+	})
+
+	d, _ := connect(t, s, "d", false)
+	d.join(t, s, code)
+	a.callVote(t, s, code, VoteKick, "d")
+	second := first.ID + 1
+	eventually(t, "the second vote to open", func() bool {
+		return b.voteStatus(t, second).State == VoteOpen
+	})
+	b.castVote(t, s, code, second, true)
+	if kicked := decode[Kicked](t, d.wait(t, MsgLobbyKicked)); kicked.Reason != "kicked by vote" {
+		t.Errorf("got %+v, want d kicked by vote", kicked)
+	}
+	if vs := a.voteStatus(t, second); vs.State != VotePassed {
+		t.Errorf("got %+v, want the vote passed", vs)
+	}
+	d.send(t, s, MsgLobbyClientJoin, code+"|d")
+	d.expect(t, MsgLobbyJoinRejected, code+"|banned from lobby", 1)
+
+	// with the target out of the count a lone caller would kick on their own
+	a.callVote(t, s, code, VoteKick, "b")
+	eventually(t, "the kick vote of a two player lobby to be rejected", func() bool {
+		return a.voteStatus(t, 0).Reason == "not enough players to vote a kick"
+	})
+}
+
+// testModes are the game modes of lobbies that vote on them.
+var testModes = map[string]func() StateManager[map[string]int, string]{
+	"classic": newCountState,
+	"race":    countStateUntil(3),
+}
+
+func TestServerModeVote(t *testing.T) {
+	s := newTestServer(WithLobbyOptions(WithGameModes("classic", testModes)))
+	a, code := connect(t, s, "a", true)
+	b, _ := connect(t, s, "b", false)
+	b.join(t, s, code)
+
+	b.callVote(t, s, code, VoteMode, "race")
+	vs := decode[VoteStatus](t, a.wait(t, MsgVoteStatus))
+	if vs.State != VoteOpen || vs.Yes != 1 || vs.Needed != 2 {
+		t.Fatalf("got %+v, want an open vote with 1 of 2 yes votes", vs)
+	}
+	a.castVote(t, s, code, vs.ID, true)
+	eventually(t, "the mode to change", func() bool {
+		msgs := b.messages(MsgLobbySettings)
+		return len(msgs) > 0 && decode[LobbySettingsMessage](t, msgs[len(msgs)-1]).Settings.Mode == "race"
+	})
+	if got := b.voteStatus(t, vs.ID); got.State != VotePassed {
+		t.Errorf("got %+v, want the vote passed", got)
+	}
+
+	// starting the match cancels a vote about the time between matches
+	b.callVote(t, s, code, VoteMode, "classic")
+	second := vs.ID + 1
+	eventually(t, "the second vote to open", func() bool {
+		return a.voteStatus(t, second).State == VoteOpen
+	})
+	a.send(t, s, MsgLobbyClientReady, code+"|a")
+	b.send(t, s, MsgLobbyClientReady, code+"|b")
+	a.send(t, s, MsgLobbyGameStart, "")
+	a.wait(t, MsgLobbyGameStarted)
+	eventually(t, "the vote to be cancelled", func() bool {
+		return a.voteStatus(t, second).State == VoteCancelled
+	})
+	a.castVote(t, s, code, second, true)
+	if msgs := b.messages(MsgLobbySettings); decode[LobbySettingsMessage](t, msgs[len(msgs)-1]).Settings.Mode != "race" {
+		t.Error("got the mode changed by a vote cancelled at the start of the match")
+	}
+}
+
+// party sends a party request on behalf of c.
+func (c *testClient) party(t *testing.T, s *Server[map[string]int, string], header MessageHeader, pr PartyRequest) {
+	t.Helper()
+	msg, err := NewPartyRequestMessage(FmtJSON, header, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendMessage(t, s, msg)
+}
+
+// lastParty returns the party c was synced to last.
+func (c *testClient) lastParty(t *testing.T) Party {
+	t.Helper()
+	msgs := c.messages(MsgPartySync)
+	if len(msgs) == 0 {
+		return Party{}
+	}
+	return decode[Party](t, msgs[len(msgs)-1])
+}
+
+func TestServerParties(t *testing.T) {
+	s := newTestServer()
+	leader, _ := connect(t, s, "leader", false)
+	friend, _ := connect(t, s, "friend", false)
+	_, code := connect(t, s, "host", true)
+	_, watched := connect(t, s, "other-host", true)
+
+	leader.party(t, s, MsgPartyCreate, PartyRequest{})
+	leader.wait(t, MsgPartySync)
+	leader.party(t, s, MsgPartyInvite, PartyRequest{ClientID: "friend"})
+	invite := decode[PartyInvite](t, friend.wait(t, MsgPartyInvite))
+	friend.party(t, s, MsgPartyJoin, PartyRequest{PartyID: invite.PartyID})
+	eventually(t, "the friend to join the party", func() bool {
+		return slices.Equal(leader.lastParty(t).Members, []string{"leader", "friend"})
+	})
+
+	// the party follows its leader into a lobby it creates and one it joins
+	leader.send(t, s, MsgLobbyCreate, "")
+	created := leader.wait(t, MsgLobbyCreated)
+	friend.expect(t, MsgLobbyClientJoin, created+"|friend", 1)
+	leader.join(t, s, code)
+	friend.expect(t, MsgLobbyClientJoin, code+"|friend", 1)
+
+	// a leader spectating another lobby watches alone
+	leader.send(t, s, MsgLobbySpectate, watched+"|leader")
+	leader.expect(t, MsgLobbySpectate, watched+"|leader", 1)
+	leader.expect(t, MsgLobbyClientLeave, code+"|leader", 1)
+	if friend.lobby() != code {
+		t.Errorf("friend is in %q, want it to stay in %s", friend.lobby(), code)
+	}
+
+	// the party is handed over when its leader disconnects
+	leader.send(t, s, MsgDisconnect, "")
+	eventually(t, "the friend to lead the party", func() bool {
+		p := friend.lastParty(t)
+		return p.LeaderID == "friend" && slices.Equal(p.Members, []string{"friend"})
+	})
+	friend.party(t, s, MsgPartyLeave, PartyRequest{})
+	eventually(t, "the friend to leave the party", func() bool {
+		return friend.lastParty(t).ID == ""
+	})
+}
@@ -0,0 +1,161 @@
+package nw
+
+import "time"
+
+const (
+	defaultSnapshotBufferSize = 32
+	// defaultMinRenderDelay and defaultMaxRenderDelay bound how far behind the server remote entities are rendered
+	defaultMinRenderDelay = 50 * time.Millisecond
+	defaultMaxRenderDelay = 500 * time.Millisecond
+	// defaultMaxExtrapolation is how long the last snapshots are extrapolated when newer ones are late
+	defaultMaxExtrapolation = 250 * time.Millisecond
+	// renderDelayJitters is how many times the measured jitter the render delay allows for on top of the snapshot interval
+	renderDelayJitters = 3
+)
+
+type snapshot[T any] struct {
+	serverTime time.Time
+	arrival    time.Time
+	state      T
+}
+
+// SnapshotBuffer holds the latest server states and renders them a delay behind the server,
+// so that there usually is a newer state to interpolate towards.
+// The delay follows the measured jitter: the more irregular the snapshots arrive, the further behind it renders.
+// It is not safe for concurrent use, it is meant to be driven by the game loop.
+type SnapshotBuffer[T any] struct {
+	// interpolate blends from into to, t is 0 at from and 1 at to and above 1 when extrapolating
+	interpolate func(from, to T, t float64) T
+	snapshots   []snapshot[T]
+	size        int
+	// offset is the server clock minus the local clock, taken from the least delayed snapshot in the buffer
+	offset time.Duration
+	// interval is a moving average of the time between snapshots, jitter of how much their arrival varies
+	interval         time.Duration
+	jitter           time.Duration
+	minDelay         time.Duration
+	maxDelay         time.Duration
+	maxExtrapolation time.Duration
+}
+
+type SnapshotBufferOption[T any] func(*SnapshotBuffer[T])
+
+// WithRenderDelay bounds the render delay, the delay derived from the jitter is kept within min and max.
+func WithRenderDelay[T any](min, max time.Duration) SnapshotBufferOption[T] {
+	return func(b *SnapshotBuffer[T]) {
+		b.minDelay = min
+		b.maxDelay = max
+	}
+}
+
+// WithMaxExtrapolation sets how long the buffer keeps extrapolating once it runs out of snapshots,
+// after that the state freezes until the next snapshot arrives.
+func WithMaxExtrapolation[T any](d time.Duration) SnapshotBufferOption[T] {
+	return func(b *SnapshotBuffer[T]) {
+		b.maxExtrapolation = d
+	}
+}
+
+// WithSnapshotBufferSize sets how many snapshots the buffer keeps.
+func WithSnapshotBufferSize[T any](n int) SnapshotBufferOption[T] {
+	return func(b *SnapshotBuffer[T]) {
+		b.size = n
+	}
+}
+
+// NewSnapshotBuffer creates a buffer that blends snapshots with interpolate.
+// interpolate must return a new state and leave from and to alone, it is also called with t = 0 to copy a snapshot.
+func NewSnapshotBuffer[T any](interpolate func(from, to T, t float64) T, opts ...SnapshotBufferOption[T]) *SnapshotBuffer[T] {
+	b := &SnapshotBuffer[T]{
+		interpolate:      interpolate,
+		size:             defaultSnapshotBufferSize,
+		minDelay:         defaultMinRenderDelay,
+		maxDelay:         defaultMaxRenderDelay,
+		maxExtrapolation: defaultMaxExtrapolation,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.size < 2 {
+		b.size = 2
+	}
+	return b
+}
+
+// Push adds the state the server sent at serverTime, it arrived at now.
+// Snapshots older than the newest one in the buffer arrived out of order and are dropped.
+func (b *SnapshotBuffer[T]) Push(serverTime time.Time, state T, now time.Time) {
+	if n := len(b.snapshots); n > 0 {
+		last := b.snapshots[n-1]
+		if !serverTime.After(last.serverTime) {
+			return
+		}
+		spacing := serverTime.Sub(last.serverTime)
+		// the jitter estimate of RFC 3550, how much the arrival spacing differs from the send spacing
+		d := now.Sub(last.arrival) - spacing
+		if d < 0 {
+			d = -d
+		}
+		if b.interval == 0 {
+			b.interval = spacing
+		}
+		b.interval += (spacing - b.interval) / 8
+		b.jitter += (d - b.jitter) / 16
+	}
+	b.snapshots = append(b.snapshots, snapshot[T]{serverTime: serverTime, arrival: now, state: state})
+	if len(b.snapshots) > b.size {
+		b.snapshots = append(b.snapshots[:0], b.snapshots[len(b.snapshots)-b.size:]...)
+	}
+	b.offset = b.snapshots[0].serverTime.Sub(b.snapshots[0].arrival)
+	for _, s := range b.snapshots[1:] {
+		b.offset = max(b.offset, s.serverTime.Sub(s.arrival))
+	}
+}
+
+// Delay returns how far behind the server the buffer renders.
+func (b *SnapshotBuffer[T]) Delay() time.Duration {
+	return min(max(b.interval+renderDelayJitters*b.jitter, b.minDelay), b.maxDelay)
+}
+
+// Jitter returns how much the arrival of snapshots varies.
+func (b *SnapshotBuffer[T]) Jitter() time.Duration {
+	return b.jitter
+}
+
+// Sample returns the state to render at now, ok is false until the first snapshot arrived.
+// It interpolates between the snapshots around the render time and, when there is no newer snapshot,
+// extrapolates from the last two for at most the maximum extrapolation.
+func (b *SnapshotBuffer[T]) Sample(now time.Time) (state T, ok bool) {
+	n := len(b.snapshots)
+	if n == 0 {
+		return state, false
+	}
+	renderTime := now.Add(b.offset - b.Delay())
+	// the snapshots before the one preceding the render time are not needed anymore,
+	// the last two are kept to extrapolate from
+	i := 0
+	for i+2 < n && !b.snapshots[i+1].serverTime.After(renderTime) {
+		i++
+	}
+	b.snapshots = append(b.snapshots[:0], b.snapshots[i:]...)
+	n = len(b.snapshots)
+
+	from := b.snapshots[0]
+	if n == 1 || renderTime.Before(from.serverTime) {
+		return b.interpolate(from.state, from.state, 0), true
+	}
+	to := b.snapshots[1]
+	if n == 2 && renderTime.After(to.serverTime) {
+		// out of snapshots, keep going the way the last two did for a while
+		renderTime = minTime(renderTime, to.serverTime.Add(b.maxExtrapolation))
+	}
+	t := float64(renderTime.Sub(from.serverTime)) / float64(to.serverTime.Sub(from.serverTime))
+	return b.interpolate(from.state, to.state, t), true
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
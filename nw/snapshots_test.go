@@ -0,0 +1,70 @@
+package nw
+
+import (
+	"testing"
+	"time"
+)
+
+func lerpFloat(from, to float64, t float64) float64 {
+	return from + (to-from)*t
+}
+
+func TestSnapshotBufferSample(t *testing.T) {
+	start := time.Unix(100, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	b := NewSnapshotBuffer(lerpFloat)
+	if _, ok := b.Sample(start); ok {
+		t.Fatal("got a state before any snapshot arrived")
+	}
+	// the server clock runs a second ahead and every snapshot takes 20ms to arrive
+	for i, v := range []float64{0, 10, 20} {
+		ms := i * 100
+		b.Push(at(1000+ms), v, at(ms+20))
+	}
+	if d := b.Delay(); d != 100*time.Millisecond {
+		t.Fatalf("got a delay of %s without jitter, want the snapshot interval", d)
+	}
+
+	tests := []struct {
+		name string
+		ms   int
+		want float64
+	}{
+		{name: "before the first snapshot", ms: 50, want: 0},
+		{name: "between snapshots", ms: 270, want: 15},
+		{name: "extrapolates", ms: 420, want: 30},
+		{name: "stops extrapolating", ms: 900, want: 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := b.Sample(at(tt.ms))
+			if !ok || got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// a late snapshot from before the newest one is dropped
+	b.Push(at(1150), 99, at(950))
+	if got, _ := b.Sample(at(900)); got != 45 {
+		t.Errorf("got %v after an out of order snapshot, want 45", got)
+	}
+}
+
+func TestSnapshotBufferDelayFollowsJitter(t *testing.T) {
+	start := time.Unix(100, 0)
+	b := NewSnapshotBuffer(lerpFloat, WithRenderDelay[float64](10*time.Millisecond, 150*time.Millisecond))
+	// snapshots are sent every 50ms but arrive alternately 0 and 40ms late
+	for i := 0; i < 64; i++ {
+		sent := start.Add(time.Duration(i) * 50 * time.Millisecond)
+		late := time.Duration(i%2) * 40 * time.Millisecond
+		b.Push(sent, float64(i), sent.Add(late))
+	}
+	if j := b.Jitter(); j < 35*time.Millisecond || j > 40*time.Millisecond {
+		t.Errorf("got a jitter of %s, want about 40ms", j)
+	}
+	if d := b.Delay(); d != 150*time.Millisecond {
+		t.Errorf("got a delay of %s, want it capped at 150ms", d)
+	}
+}
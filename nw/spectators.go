@@ -0,0 +1,61 @@
+package nw
+
+import "time"
+
+type delayedMessage struct {
+	at  time.Time
+	msg Message
+}
+
+// delayQueue holds messages until they are older than its delay.
+// Spectators are fed from it so they cannot relay live positions to players.
+type delayQueue struct {
+	delay    time.Duration
+	messages []delayedMessage
+	// timer fires when the oldest message is due, it is nil while the queue is empty
+	timer *time.Timer
+	// timerAt is when the oldest message was pushed as of arming the timer
+	timerAt time.Time
+}
+
+func (q *delayQueue) push(now time.Time, msg Message) {
+	q.messages = append(q.messages, delayedMessage{at: now, msg: msg})
+}
+
+// due removes and returns every message that has been held for at least the delay.
+func (q *delayQueue) due(now time.Time) []Message {
+	n := 0
+	for n < len(q.messages) && now.Sub(q.messages[n].at) >= q.delay {
+		n++
+	}
+	out := make([]Message, n)
+	for i := range out {
+		out[i] = q.messages[i].msg
+	}
+	q.messages = append(q.messages[:0], q.messages[n:]...)
+	q.arm(now)
+	return out
+}
+
+// arm sets the timer to fire when the oldest message is due, it is left alone while that message is the same.
+func (q *delayQueue) arm(now time.Time) {
+	if q.timer != nil && len(q.messages) > 0 && q.timerAt.Equal(q.messages[0].at) {
+		return
+	}
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+	if len(q.messages) > 0 {
+		q.timerAt = q.messages[0].at
+		q.timer = time.NewTimer(q.timerAt.Add(q.delay).Sub(now))
+	}
+}
+
+// C fires when the oldest message is due, it is nil while the queue is empty.
+func (q *delayQueue) C() <-chan time.Time {
+	if q.timer == nil {
+		return nil
+	}
+	return q.timer.C
+}
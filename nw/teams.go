@@ -0,0 +1,171 @@
+package nw
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TeamAssignment puts a lobby member on a team, it is sent by the owner and broadcast by the lobby.
+// Teams are numbered from 1, team 0 means the lobby is free for all.
+type TeamAssignment struct {
+	LobbyID  string `json:"lobbyID"`
+	ClientID string `json:"clientID"`
+	Team     int    `json:"team"`
+}
+
+type teamChange struct {
+	clientID   string
+	assignment TeamAssignment
+}
+
+// teamRoster tracks which team every lobby member is on.
+// It is owned by the lobby's handleLobbyActions goroutine.
+type teamRoster struct {
+	count int
+	teams map[string]int
+}
+
+func newTeamRoster() *teamRoster {
+	return &teamRoster{teams: make(map[string]int)}
+}
+
+func (r *teamRoster) enabled() bool {
+	return r.count > 1
+}
+
+func (r *teamRoster) team(clientID string) int {
+	return r.teams[clientID]
+}
+
+func (r *teamRoster) sizes() []int {
+	if !r.enabled() {
+		return nil
+	}
+	sizes := make([]int, r.count)
+	for _, team := range r.teams {
+		if team > 0 {
+			sizes[team-1]++
+		}
+	}
+	return sizes
+}
+
+// smallest returns the team with the fewest members, the lowest numbered on ties.
+func (r *teamRoster) smallest() int {
+	sizes := r.sizes()
+	best := 1
+	for i, size := range sizes {
+		if size < sizes[best-1] {
+			best = i + 1
+		}
+	}
+	return best
+}
+
+// join puts clientID on the smallest team.
+func (r *teamRoster) join(clientID string) int {
+	if !r.enabled() {
+		return 0
+	}
+	team := r.smallest()
+	r.teams[clientID] = team
+	return team
+}
+
+func (r *teamRoster) leave(clientID string) {
+	delete(r.teams, clientID)
+}
+
+func (r *teamRoster) assign(clientID string, team int) error {
+	if !r.enabled() {
+		return fmt.Errorf("teams are disabled")
+	}
+	if team < 1 || team > r.count {
+		return fmt.Errorf("invalid team %d", team)
+	}
+	r.teams[clientID] = team
+	return nil
+}
+
+// resize changes the number of teams, members whose team no longer exists move to the smallest one.
+// members is in join order and the IDs of everyone who changed team are returned.
+func (r *teamRoster) resize(count int, members []string) []string {
+	r.count = count
+	var moved []string
+	for _, id := range members {
+		team := r.teams[id]
+		switch {
+		case !r.enabled():
+			if team != 0 {
+				delete(r.teams, id)
+				moved = append(moved, id)
+			}
+		case team < 1 || team > r.count:
+			// place after clearing so the member does not count towards its old team
+			delete(r.teams, id)
+			r.teams[id] = r.smallest()
+			moved = append(moved, id)
+		}
+	}
+	return moved
+}
+
+// balance moves the latest joiners of the largest team to the smallest until sizes differ by at most one.
+// members is in join order and the IDs of everyone who changed team are returned.
+func (r *teamRoster) balance(members []string) []string {
+	if !r.enabled() {
+		return nil
+	}
+	var moved []string
+	for {
+		sizes := r.sizes()
+		largest, smallest := 1, r.smallest()
+		for i, size := range sizes {
+			if size > sizes[largest-1] {
+				largest = i + 1
+			}
+		}
+		if sizes[largest-1]-sizes[smallest-1] <= 1 {
+			return moved
+		}
+		for i := len(members) - 1; i >= 0; i-- {
+			if r.teams[members[i]] == largest {
+				r.teams[members[i]] = smallest
+				moved = append(moved, members[i])
+				break
+			}
+		}
+	}
+}
+
+func NewTeamAssignmentMessage(f MessageFmt, ta TeamAssignment) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(ta)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgLobbyTeam, f, data), nil
+}
+
+func TeamAssignmentFromMessage(m Message) (TeamAssignment, error) {
+	var ta TeamAssignment
+	if m.header != MsgLobbyTeam {
+		return TeamAssignment{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &ta); err != nil {
+			return TeamAssignment{}, err
+		}
+	default:
+		return TeamAssignment{}, fmt.Errorf("unsupported message format")
+	}
+	return ta, nil
+}
@@ -0,0 +1,61 @@
+package nw
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTeamRosterJoinBalancesTeams(t *testing.T) {
+	r := newTeamRoster()
+	r.count = 2
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		r.join(id)
+	}
+	if got, want := r.sizes(), []int{3, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got sizes %v, want %v", got, want)
+	}
+}
+
+func TestTeamRosterBalance(t *testing.T) {
+	members := []string{"a", "b", "c", "d"}
+	r := newTeamRoster()
+	r.count = 2
+	for _, id := range members {
+		if err := r.assign(id, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved := r.balance(members)
+	if want := []string{"d", "c"}; !reflect.DeepEqual(moved, want) {
+		t.Errorf("got moved %v, want %v", moved, want)
+	}
+	if got, want := r.sizes(), []int{2, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got sizes %v, want %v", got, want)
+	}
+}
+
+func TestTeamRosterResize(t *testing.T) {
+	members := []string{"a", "b", "c"}
+	r := newTeamRoster()
+	r.resize(3, members)
+	if got, want := r.sizes(), []int{1, 1, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got sizes %v, want %v", got, want)
+	}
+
+	moved := r.resize(2, members)
+	if want := []string{"c"}; !reflect.DeepEqual(moved, want) {
+		t.Errorf("got moved %v, want %v", moved, want)
+	}
+	if got, want := r.sizes(), []int{2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got sizes %v, want %v", got, want)
+	}
+
+	r.resize(0, members)
+	if r.team("a") != 0 || r.sizes() != nil {
+		t.Errorf("teams left over after disabling them: %v", r.teams)
+	}
+	if err := r.assign("a", 1); err == nil {
+		t.Error("assigned a team with teams disabled")
+	}
+}
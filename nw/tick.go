@@ -0,0 +1,135 @@
+package nw
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// tickScheduler paces a fixed timestep: every tick advances the game by exactly interval.
+// When ticks fire late the missed ones run back to back, up to maxCatchUp at once,
+// anything further behind is skipped so a stalled lobby does not spiral.
+type tickScheduler struct {
+	interval   time.Duration
+	maxCatchUp int
+	timer      *time.Timer
+	// next is when the next tick is due
+	next time.Time
+}
+
+func newTickScheduler(interval time.Duration, maxCatchUp int, now time.Time) *tickScheduler {
+	if maxCatchUp < 1 {
+		maxCatchUp = 1
+	}
+	return &tickScheduler{
+		interval:   interval,
+		maxCatchUp: maxCatchUp,
+		timer:      time.NewTimer(interval),
+		next:       now.Add(interval),
+	}
+}
+
+func (t *tickScheduler) C() <-chan time.Time {
+	return t.timer.C
+}
+
+// due returns how many ticks have to run at now and how many were skipped because they were too far behind.
+func (t *tickScheduler) due(now time.Time) (steps, skipped int) {
+	if now.Before(t.next) {
+		return 0, 0
+	}
+	steps = int(now.Sub(t.next)/t.interval) + 1
+	if steps > t.maxCatchUp {
+		skipped = steps - t.maxCatchUp
+		steps = t.maxCatchUp
+		t.next = now.Add(t.interval)
+		return steps, skipped
+	}
+	t.next = t.next.Add(time.Duration(steps) * t.interval)
+	return steps, 0
+}
+
+// schedule arms the timer for the next tick, it must be called once the ticks due were run.
+func (t *tickScheduler) schedule(now time.Time) {
+	t.timer.Reset(max(t.next.Sub(now), 0))
+}
+
+func (t *tickScheduler) stop() {
+	t.timer.Stop()
+}
+
+// TickStats describes how well a lobby keeps up with its tick rate.
+type TickStats struct {
+	// Tick is the number of the last game tick
+	Tick uint64 `json:"tick"`
+	// Overruns counts the ticks that took longer than the tick rate to run
+	Overruns uint64 `json:"overruns"`
+	// CaughtUp counts the ticks that ran late, back to back with the tick before
+	CaughtUp uint64 `json:"caughtUp"`
+	// Skipped counts the ticks dropped because the lobby fell too far behind to catch up
+	Skipped uint64 `json:"skipped"`
+	// P50, P95, P99 and Max are how long the recent ticks took to run
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// tickMetrics collects the tick timings of a lobby.
+// The lobby goroutine records them while monitoring reads them, so all access goes through mu.
+type tickMetrics struct {
+	mu    sync.Mutex
+	stats TickStats
+	// durations is a ring of how long the last ticks took to run
+	durations []time.Duration
+	next      int
+}
+
+func newTickMetrics(window int) *tickMetrics {
+	return &tickMetrics{durations: make([]time.Duration, 0, window)}
+}
+
+// record notes a tick run that took took, caughtUp of its steps were late ones.
+func (m *tickMetrics) record(tick uint64, took, interval time.Duration, caughtUp int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Tick = tick
+	m.stats.CaughtUp += uint64(caughtUp)
+	if took > interval {
+		m.stats.Overruns++
+	}
+	if len(m.durations) < cap(m.durations) {
+		m.durations = append(m.durations, took)
+		return
+	}
+	m.durations[m.next] = took
+	m.next = (m.next + 1) % len(m.durations)
+}
+
+func (m *tickMetrics) skip(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Skipped += uint64(n)
+}
+
+func (m *tickMetrics) snapshot() TickStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.stats
+	sorted := slices.Clone(m.durations)
+	slices.Sort(sorted)
+	stats.P50 = percentile(sorted, 50)
+	stats.P95 = percentile(sorted, 95)
+	stats.P99 = percentile(sorted, 99)
+	stats.Max = percentile(sorted, 100)
+	return stats
+}
+
+// percentile returns the nearest rank p-th percentile of sorted, 0 if it is empty.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,74 @@
+package nw
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTickSchedulerDue(t *testing.T) {
+	start := time.Unix(0, 0)
+	interval := 10 * time.Millisecond
+	tests := []struct {
+		name        string
+		after       time.Duration
+		wantSteps   int
+		wantSkipped int
+		wantNext    time.Duration
+	}{
+		{name: "early", after: 5 * time.Millisecond, wantSteps: 0, wantNext: 10 * time.Millisecond},
+		{name: "on time", after: 10 * time.Millisecond, wantSteps: 1, wantNext: 20 * time.Millisecond},
+		{name: "a little late", after: 14 * time.Millisecond, wantSteps: 1, wantNext: 20 * time.Millisecond},
+		{name: "catches up", after: 32 * time.Millisecond, wantSteps: 3, wantNext: 40 * time.Millisecond},
+		{name: "skips ahead", after: 100 * time.Millisecond, wantSteps: 5, wantSkipped: 5, wantNext: 110 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTickScheduler(interval, 5, start)
+			defer ts.stop()
+			steps, skipped := ts.due(start.Add(tt.after))
+			if steps != tt.wantSteps || skipped != tt.wantSkipped {
+				t.Errorf("got %d steps and %d skipped, want %d and %d", steps, skipped, tt.wantSteps, tt.wantSkipped)
+			}
+			if next := ts.next.Sub(start); next != tt.wantNext {
+				t.Errorf("got next tick at %s, want %s", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestTickMetrics(t *testing.T) {
+	m := newTickMetrics(100)
+	// only the last 100 ticks count towards the percentiles, the first ones are pushed out of the window
+	for i := 1; i <= 200; i++ {
+		m.record(uint64(i), time.Duration(i)*time.Millisecond, 150*time.Millisecond, 0)
+	}
+	m.record(201, 0, 150*time.Millisecond, 2)
+	m.skip(3)
+
+	got := m.snapshot()
+	want := TickStats{
+		Tick:     201,
+		Overruns: 50,
+		CaughtUp: 2,
+		Skipped:  3,
+		P50:      150 * time.Millisecond,
+		P95:      195 * time.Millisecond,
+		P99:      199 * time.Millisecond,
+		Max:      200 * time.Millisecond,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("got %s for no samples, want 0", got)
+	}
+	sorted := []time.Duration{1, 2, 3, 4}
+	for p, want := range map[int]time.Duration{0: 1, 25: 1, 50: 2, 75: 3, 99: 4, 100: 4} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("got p%d %d, want %d", p, got, want)
+		}
+	}
+}
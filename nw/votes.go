@@ -0,0 +1,421 @@
+package nw
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// VoteType is what a lobby vote decides.
+type VoteType string
+
+const (
+	// VoteKick removes Target from the lobby
+	VoteKick VoteType = "kick"
+	// VoteMode switches the lobby to the game mode Target before the next match
+	VoteMode VoteType = "mode"
+	// VoteRematch readies everyone and starts the countdown for another match
+	VoteRematch VoteType = "rematch"
+)
+
+// VoteState is where a vote is in its lifecycle.
+type VoteState string
+
+const (
+	VoteOpen    VoteState = "open"
+	VotePassed  VoteState = "passed"
+	VoteFailed  VoteState = "failed"
+	VoteExpired VoteState = "expired"
+	// VoteCancelled votes became moot, for instance because the player to kick left
+	VoteCancelled VoteState = "cancelled"
+	// VoteRejected is only sent to the caller of a vote that could not be started
+	VoteRejected VoteState = "rejected"
+)
+
+// VoteCall starts a vote in a lobby, the caller votes yes.
+type VoteCall struct {
+	LobbyID string   `json:"lobbyID"`
+	Type    VoteType `json:"type"`
+	// Target is the client to kick or the mode to switch to, rematch votes have none
+	Target string `json:"target,omitempty"`
+}
+
+// VoteBallot is a member's answer to the open vote.
+type VoteBallot struct {
+	LobbyID string `json:"lobbyID"`
+	VoteID  int    `json:"voteID"`
+	Yes     bool   `json:"yes"`
+}
+
+// VoteStatus is broadcast whenever the open vote changes and once more when it ends.
+type VoteStatus struct {
+	LobbyID  string    `json:"lobbyID"`
+	ID       int       `json:"id"`
+	Type     VoteType  `json:"type"`
+	Target   string    `json:"target,omitempty"`
+	CallerID string    `json:"callerID"`
+	State    VoteState `json:"state"`
+	Yes      int       `json:"yes"`
+	No       int       `json:"no"`
+	// Needed is the number of yes votes that pass the vote out of Eligible voters
+	Needed   int       `json:"needed"`
+	Eligible int       `json:"eligible"`
+	EndsAt   time.Time `json:"endsAt"`
+	// Reason explains rejected votes
+	Reason string `json:"reason,omitempty"`
+}
+
+type voteAction struct {
+	clientID string
+	call     *VoteCall
+	ballot   *VoteBallot
+}
+
+// vote is the open vote of a lobby, it is owned by the lobby's handleLobbyActions goroutine.
+type vote struct {
+	status  VoteStatus
+	ballots map[string]bool
+	timer   *time.Timer
+}
+
+// minKickVotes is the fewest yes votes that kick a player, so nobody is kicked on their caller's vote alone.
+const minKickVotes = 2
+
+// votesNeeded is the number of yes votes that make more than threshold of eligible voters.
+func votesNeeded(eligible int, threshold float64) int {
+	needed := int(float64(eligible)*threshold) + 1
+	if needed > eligible {
+		return eligible
+	}
+	return needed
+}
+
+// callVote asks the lobby to start a vote on behalf of clientID.
+func (s *GameServer[T, I]) callVote(clientID string, call VoteCall) {
+	sendTo(s.done, s.voteActions, voteAction{clientID: clientID, call: &call})
+}
+
+// castVote hands clientID's ballot to the lobby.
+func (s *GameServer[T, I]) castVote(clientID string, ballot VoteBallot) {
+	sendTo(s.done, s.voteActions, voteAction{clientID: clientID, ballot: &ballot})
+}
+
+// voteC fires when the open vote times out, it is nil while no vote is open.
+func (s *GameServer[T, I]) voteC() <-chan time.Time {
+	if s.vote == nil {
+		return nil
+	}
+	return s.vote.timer.C
+}
+
+// handleVoteAction starts a vote or records a ballot and reports whether the outcome closed the lobby.
+func (s *GameServer[T, I]) handleVoteAction(action voteAction) bool {
+	if action.call != nil {
+		if reason := s.startVote(action.clientID, *action.call); reason != "" {
+			s.log.Printf("Rejecting vote from %s in lobby %s: %s\n", action.clientID, s.ID, reason)
+			s.sendVoteRejection(action.clientID, *action.call, reason)
+			return false
+		}
+		return s.tallyVote()
+	}
+	v := s.vote
+	if v == nil || action.ballot.VoteID != v.status.ID || !s.canVote(action.clientID) {
+		return false
+	}
+	v.ballots[action.clientID] = action.ballot.Yes
+	return s.tallyVote()
+}
+
+// startVote opens a vote called by clientID, it returns why it cannot be started or an empty string.
+func (s *GameServer[T, I]) startVote(clientID string, call VoteCall) string {
+	if _, ok := s.clients[clientID]; !ok {
+		return "only players can call votes"
+	}
+	if s.vote != nil {
+		return "a vote is already running"
+	}
+	switch call.Type {
+	case VoteKick:
+		if _, ok := s.clients[call.Target]; !ok {
+			return "player not found"
+		}
+		if call.Target == clientID {
+			return "cannot vote to kick yourself"
+		}
+		if len(s.clients)-1 < minKickVotes {
+			return "not enough players to vote a kick"
+		}
+	case VoteMode:
+		if s.started {
+			return "the mode can only change between matches"
+		}
+		if _, ok := s.modes[call.Target]; !ok {
+			return fmt.Sprintf("unknown mode %q", call.Target)
+		}
+		if call.Target == s.settings.Mode {
+			return "already playing that mode"
+		}
+	case VoteRematch:
+		if s.started || s.countdownTicker != nil {
+			return "a match is already starting"
+		}
+		call.Target = ""
+	default:
+		return fmt.Sprintf("unknown vote type %q", call.Type)
+	}
+	s.voteCount++
+	s.vote = &vote{
+		status: VoteStatus{
+			LobbyID:  s.ID,
+			ID:       s.voteCount,
+			Type:     call.Type,
+			Target:   call.Target,
+			CallerID: clientID,
+			State:    VoteOpen,
+			EndsAt:   time.Now().Add(s.voteTimeout),
+		},
+		ballots: map[string]bool{clientID: true},
+		timer:   time.NewTimer(s.voteTimeout),
+	}
+	s.log.Printf("Vote %d in lobby %s: %s %s\n", s.voteCount, s.ID, call.Type, call.Target)
+	return ""
+}
+
+// canVote reports whether clientID has a say in the open vote, the player a kick vote is about has none.
+func (s *GameServer[T, I]) canVote(clientID string) bool {
+	_, ok := s.clients[clientID]
+	return ok && !(s.vote.status.Type == VoteKick && s.vote.status.Target == clientID)
+}
+
+// countVotes counts the ballots of the members who can still vote in the open vote.
+func (s *GameServer[T, I]) countVotes() {
+	v := s.vote
+	v.status.Yes, v.status.No, v.status.Eligible = 0, 0, 0
+	for _, id := range s.members {
+		if !s.canVote(id) {
+			continue
+		}
+		v.status.Eligible++
+		yes, voted := v.ballots[id]
+		switch {
+		case voted && yes:
+			v.status.Yes++
+		case voted:
+			v.status.No++
+		}
+	}
+	v.status.Needed = votesNeeded(v.status.Eligible, s.voteThreshold)
+	if v.status.Type == VoteKick {
+		v.status.Needed = max(v.status.Needed, minKickVotes)
+	}
+}
+
+// tallyVote ends the open vote once its outcome is certain and otherwise broadcasts its progress.
+// It reports whether the outcome closed the lobby.
+func (s *GameServer[T, I]) tallyVote() bool {
+	s.countVotes()
+	vs := s.vote.status
+	switch {
+	case vs.Eligible > 0 && vs.Yes >= vs.Needed:
+		return s.endVote(VotePassed)
+	case vs.No > vs.Eligible-vs.Needed:
+		return s.endVote(VoteFailed)
+	}
+	s.broadcastVote(vs)
+	return false
+}
+
+// endVote closes the open vote in state and carries it out if it passed.
+// A mode or rematch vote passing once a match started is cancelled instead.
+// It reports whether that closed the lobby.
+func (s *GameServer[T, I]) endVote(state VoteState) bool {
+	v := s.vote
+	v.timer.Stop()
+	s.vote = nil
+	if state == VotePassed && v.status.Type != VoteKick && s.started {
+		state = VoteCancelled
+	}
+	v.status.State = state
+	s.log.Printf("Vote %d in lobby %s %s\n", v.status.ID, s.ID, state)
+	s.broadcastVote(v.status)
+	if state != VotePassed {
+		return false
+	}
+	switch v.status.Type {
+	case VoteKick:
+		if target, ok := s.clients[v.status.Target]; ok {
+			return s.kickMember(target, "kicked by vote", s.kickBanDuration)
+		}
+	case VoteMode:
+		s.setMode(v.status.Target)
+		s.broadcastSettings()
+	case VoteRematch:
+		for _, id := range s.members {
+			if !s.readyClients[id] {
+				s.readyClients[id] = true
+				delete(s.unreadySince, id)
+				s.broadcast(NewMessage(MsgLobbyClientReady, FmtText, []byte(id)))
+			}
+		}
+		s.beginCountdown()
+	}
+	return false
+}
+
+// expireVote ends the open vote once its time is up, it passes if enough voted yes in time.
+func (s *GameServer[T, I]) expireVote() bool {
+	s.countVotes()
+	if s.vote.status.Eligible > 0 && s.vote.status.Yes >= s.vote.status.Needed {
+		return s.endVote(VotePassed)
+	}
+	return s.endVote(VoteExpired)
+}
+
+// voterLeft updates the open vote after clientID left the lobby.
+// The vote fails if it can no longer pass but never passes from someone leaving since the lobby is midway through
+// removing them, the next ballot or the timeout decides.
+func (s *GameServer[T, I]) voterLeft(clientID string) {
+	v := s.vote
+	if v == nil {
+		return
+	}
+	if v.status.Type == VoteKick && v.status.Target == clientID {
+		s.endVote(VoteCancelled)
+		return
+	}
+	delete(v.ballots, clientID)
+	s.countVotes()
+	if v.status.Eligible == 0 || v.status.No > v.status.Eligible-v.status.Needed {
+		s.endVote(VoteFailed)
+		return
+	}
+	s.broadcastVote(v.status)
+}
+
+func (s *GameServer[T, I]) broadcastVote(vs VoteStatus) {
+	msg, err := NewVoteStatusMessage(FmtJSON, vs)
+	if err != nil {
+		s.log.Println("Error making vote status message:", err)
+		return
+	}
+	s.broadcastAll(msg)
+}
+
+func (s *GameServer[T, I]) sendVoteRejection(clientID string, call VoteCall, reason string) {
+	client, ok := s.clients[clientID]
+	if !ok {
+		client, ok = s.spectators[clientID]
+	}
+	if !ok {
+		return
+	}
+	msg, err := NewVoteStatusMessage(FmtJSON, VoteStatus{
+		LobbyID:  s.ID,
+		Type:     call.Type,
+		Target:   call.Target,
+		CallerID: clientID,
+		State:    VoteRejected,
+		Reason:   reason,
+	})
+	if err != nil {
+		s.log.Println("Error making vote status message:", err)
+		return
+	}
+	client.send(msg)
+}
+
+func NewVoteCallMessage(f MessageFmt, call VoteCall) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(call)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgVoteCall, f, data), nil
+}
+
+func VoteCallFromMessage(m Message) (VoteCall, error) {
+	var call VoteCall
+	if m.header != MsgVoteCall {
+		return VoteCall{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &call); err != nil {
+			return VoteCall{}, err
+		}
+	default:
+		return VoteCall{}, fmt.Errorf("unsupported message format")
+	}
+	return call, nil
+}
+
+func NewVoteBallotMessage(f MessageFmt, ballot VoteBallot) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(ballot)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgVoteCast, f, data), nil
+}
+
+func VoteBallotFromMessage(m Message) (VoteBallot, error) {
+	var ballot VoteBallot
+	if m.header != MsgVoteCast {
+		return VoteBallot{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &ballot); err != nil {
+			return VoteBallot{}, err
+		}
+	default:
+		return VoteBallot{}, fmt.Errorf("unsupported message format")
+	}
+	return ballot, nil
+}
+
+func NewVoteStatusMessage(f MessageFmt, vs VoteStatus) (Message, error) {
+	var data []byte
+	switch f {
+	case FmtJSON:
+		var err error
+		data, err = json.Marshal(vs)
+		if err != nil {
+			return Message{}, err
+		}
+	default:
+		return Message{}, fmt.Errorf("unsupported message format")
+	}
+
+	return NewMessage(MsgVoteStatus, f, data), nil
+}
+
+func VoteStatusFromMessage(m Message) (VoteStatus, error) {
+	var vs VoteStatus
+	if m.header != MsgVoteStatus {
+		return VoteStatus{}, fmt.Errorf("invalid message header")
+	}
+	switch m.data.Fmt {
+	case FmtJSON:
+		if err := json.Unmarshal(m.data.Data, &vs); err != nil {
+			return VoteStatus{}, err
+		}
+	default:
+		return VoteStatus{}, fmt.Errorf("unsupported message format")
+	}
+	return vs, nil
+}
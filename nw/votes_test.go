@@ -0,0 +1,28 @@
+package nw
+
+import "testing"
+
+func TestVotesNeeded(t *testing.T) {
+	tests := []struct {
+		name      string
+		eligible  int
+		threshold float64
+		want      int
+	}{
+		{name: "alone", eligible: 1, threshold: 0.5, want: 1},
+		{name: "two players need both", eligible: 2, threshold: 0.5, want: 2},
+		{name: "odd majority", eligible: 5, threshold: 0.5, want: 3},
+		{name: "even majority", eligible: 6, threshold: 0.5, want: 4},
+		{name: "two thirds", eligible: 6, threshold: 2.0 / 3, want: 5},
+		{name: "unanimous", eligible: 4, threshold: 1, want: 4},
+		{name: "nobody", eligible: 0, threshold: 0.5, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := votesNeeded(tt.eligible, tt.threshold); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,8 @@ type RaylibRenderer struct {
 	Title        string
 	Camera       rl.Camera2D
 	CameraTarget rl.Vector2
+	// Profiles looks up the profile of a player so snakes are drawn with their name and color
+	Profiles func(clientID string) (nw.Profile, bool)
 }
 
 func NewRaylibRenderer() RaylibRenderer {
@@ -40,17 +42,35 @@ func (r RaylibRenderer) ShouldClose() bool {
 	return rl.WindowShouldClose()
 }
 
-func (r RaylibRenderer) Render(m nw.ClientStateManager[GameState]) {
+func (r RaylibRenderer) Render(m nw.ClientStateManager[GameState, Direction]) {
 	rl.BeginDrawing()
+	r.Draw(m)
+	rl.EndDrawing()
+}
+
+// Draw draws the game world without beginning or ending the frame,
+// so callers can layer their own overlays on top.
+func (r RaylibRenderer) Draw(m nw.ClientStateManager[GameState, Direction]) {
 	rl.BeginMode2D(r.Camera)
 	rl.ClearBackground(rl.RayWhite)
 	s := m.GetCurrent()
 	clientId := m.ClientID()
 	for _, snake := range s.Snakes {
+		if snake.Dead {
+			// dead snakes keep their body in the state for the results, they are out of the match
+			continue
+		}
 		color := rl.Green
 		if snake.ID == clientId {
 			color = rl.Blue
 		}
+		var profile nw.Profile
+		if r.Profiles != nil {
+			profile, _ = r.Profiles(snake.ID)
+		}
+		if profile.Color != 0 {
+			color = rl.GetColor(uint(profile.Color))
+		}
 		for _, segment := range snake.Segments {
 			rl.DrawRectangle(
 				int32(segment.X*10),
@@ -60,6 +80,10 @@ func (r RaylibRenderer) Render(m nw.ClientStateManager[GameState]) {
 				color,
 			)
 		}
+		if profile.Name != "" && len(snake.Segments) > 0 {
+			head := snake.Segments[0]
+			rl.DrawText(profile.Name, int32(head.X*10), int32(head.Y*10-12), 10, rl.Black)
+		}
 	}
 	for _, food := range s.FoodItems {
 		rl.DrawCircle(
@@ -70,5 +94,4 @@ func (r RaylibRenderer) Render(m nw.ClientStateManager[GameState]) {
 		)
 	}
 	rl.EndMode2D()
-	rl.EndDrawing()
 }
@@ -2,24 +2,24 @@ package snake
 
 import (
 	"encoding/json"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/KoduIsGreat/knight-game/nw"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
-const (
-	interpolationTimeMs = 100 // Time in milliseconds for interpolation
-)
-
 type ClientStateManager struct {
-	clientID         string
-	currentState     GameState
-	targetState      *GameState
-	inputHistory     map[uint32]string
-	stateHistory     map[uint32]GameState
-	inputSequence    uint32
-	interpolateUntil time.Time
+	clientID     string
+	currentState GameState
+	targetState  *GameState
+	// predictor replays the inputs the server has not acknowledged yet on top of its states
+	predictor *nw.Predictor[GameState, Direction]
+	// snapshots render the other snakes a little behind the server
+	snapshots *nw.SnapshotBuffer[GameState]
+	// paused is set by the network goroutine while the match is paused
+	paused atomic.Bool
 }
 
 func newGameState() GameState {
@@ -31,12 +31,14 @@ func newGameState() GameState {
 }
 
 func NewClientStateManger[T GameState]() *ClientStateManager {
-	return &ClientStateManager{
+	s := &ClientStateManager{
 		currentState: newGameState(),
 		targetState:  nil,
-		inputHistory: make(map[uint32]string),
-		stateHistory: make(map[uint32]GameState),
+		snapshots:    nw.NewSnapshotBuffer(interpolateGameState),
 	}
+	s.predictor = nw.NewPredictor(newGameState(), s.predictInput, CloneGameState,
+		nw.WithPredictionCheck[GameState, Direction](s.sameDirection))
+	return s
 }
 
 func (s *ClientStateManager) GetCurrent() GameState {
@@ -53,83 +55,64 @@ func (s *ClientStateManager) SetClientID(clientId string) {
 func (s *ClientStateManager) ClientID() string {
 	return s.clientID
 }
+func (s *ClientStateManager) SetPaused(paused bool) {
+	s.paused.Store(paused)
+}
+
 func (s *ClientStateManager) InputSeq() uint32 {
-	return s.inputSequence
+	return s.predictor.Seq()
+}
+
+// RenderDelay is how far behind the server the other snakes are shown, it is sent with inputs for lag compensation.
+func (s *ClientStateManager) RenderDelay() time.Duration {
+	return s.snapshots.Delay()
+}
+
+// PredictionStats tells how often the local snake was predicted right.
+func (s *ClientStateManager) PredictionStats() nw.PredictionStats {
+	return s.predictor.Stats()
 }
 
 // ReconcileGameState reconciles the client's game state with the server's game state.
 // It is called when the client receives a new server state message at the beginning of the frame
 func (s *ClientStateManager) ReconcileState(serverMessage nw.ServerStateMessage[GameState]) {
-	serverGameState := serverMessage.GameState
-	acknowledgedSeq := serverMessage.AcknowledgedSeq[s.clientID]
-	// Remove acknowledged inputs and states
-	for seq := range s.inputHistory {
-		if seq <= acknowledgedSeq {
-			delete(s.inputHistory, seq)
-			delete(s.stateHistory, seq)
-		}
-	}
-	// Set the target state and start interpolation
-	s.targetState = &serverGameState
-	s.interpolateUntil = time.Now().Add(interpolationTimeMs * time.Millisecond)
-
-	// Apply any unacknowledged inputs
-	for seq := acknowledgedSeq + 1; seq <= s.inputSequence; seq++ {
-		if input, ok := s.inputHistory[seq]; ok {
-			s.applyInput(s.targetState, input)
-		}
-	}
+	s.snapshots.Push(serverMessage.ServerTime, CloneGameState(serverMessage.GameState), time.Now())
+	s.predictor.Reconcile(serverMessage.GameState, serverMessage.AcknowledgedSeq[s.clientID])
+	s.setTarget()
 }
 
-func (s *ClientStateManager) applyInput(state *GameState, input string) {
+// setTarget makes the predicted state the target, a copy so the predictor's history stays untouched.
+func (s *ClientStateManager) setTarget() {
+	target := CloneGameState(s.predictor.State())
+	s.targetState = &target
+}
+
+// predictInput applies input to the client's snake the way the server will and moves it a step.
+func (s *ClientStateManager) predictInput(state GameState, input Direction) GameState {
 	snake, exists := state.Snakes[s.clientID]
 	if !exists {
-		return
-	}
-
-	opposite := map[string]string{
-		"UP":    "DOWN",
-		"DOWN":  "UP",
-		"LEFT":  "RIGHT",
-		"RIGHT": "LEFT",
+		return state
 	}
+	turnSnake(snake, input)
+	stepSnake(snake, state, false, nil)
+	return state
+}
 
-	if input == "UP" || input == "DOWN" || input == "LEFT" || input == "RIGHT" {
-		if snake.Direction != opposite[input] {
-			snake.Direction = input
-		}
+// sameDirection reports whether the client's snake heads the same way in both states,
+// the rest of the world keeps moving on the server so only the direction can be predicted.
+func (s *ClientStateManager) sameDirection(predicted, actual GameState) bool {
+	p, ok := predicted.Snakes[s.clientID]
+	a, ok2 := actual.Snakes[s.clientID]
+	if !ok || !ok2 {
+		return ok == ok2
 	}
-	moveSnake(snake, int(state.World.ToInt32().Width), int(state.World.ToInt32().Height), state.FoodItems, state.Snakes)
+	return p.Direction == a.Direction
 }
 
 // updateLocalGameState updates the client's local game state.
-func (s *ClientStateManager) UpdateLocal(input string) {
-	s.inputSequence++
-	snake, exists := s.currentState.Snakes[s.clientID]
-	if !exists {
-		// Initialize snake if not exists
-		snake = &Snake{
-			ID:        s.clientID,
-			Segments:  []Position{{X: 10, Y: 10}},
-			Direction: "RIGHT",
-		}
-		s.currentState.Snakes[s.clientID] = snake
-	}
-
-	opposite := map[string]string{
-		"UP":    "DOWN",
-		"DOWN":  "UP",
-		"LEFT":  "RIGHT",
-		"RIGHT": "LEFT",
-	}
-
-	if input == "UP" || input == "DOWN" || input == "LEFT" || input == "RIGHT" {
-		if snake.Direction != opposite[input] {
-			snake.Direction = input
-		}
-	}
-	s.inputHistory[s.inputSequence] = input
-	s.stateHistory[s.inputSequence] = s.currentState
+func (s *ClientStateManager) UpdateLocal(input Direction) {
+	s.predictor.Apply(input)
+	s.setTarget()
 }
 
 func jsonPrettyState(gs any) []byte {
@@ -137,85 +120,55 @@ func jsonPrettyState(gs any) []byte {
 	return b
 }
 
+// Update shows the other snakes where the snapshot buffer has them and the client's own snake where it is predicted.
 func (s *ClientStateManager) Update(dt float64) {
-	isInterpolating := false
-	// Continuous interpolation
-	if s.targetState != nil {
-		now := time.Now()
-		if now.Before(s.interpolateUntil) {
-			isInterpolating = true
-			elapsed := float32(now.Sub(s.interpolateUntil.Add(-interpolationTimeMs * time.Millisecond)).Seconds())
-			factor := elapsed / (float32(interpolationTimeMs) / 1000.0)
-			factor = clamp(factor, 0.0, 1.0)
-			s.currentState = s.interpolateStates(factor)
-		} else {
+	// the server state is frozen, show it as is
+	if s.paused.Load() {
+		if s.targetState != nil {
 			s.currentState = *s.targetState
-			s.targetState = nil
-		}
-	}
-
-	// Move the client's snake only if we're not interpolating
-	if !isInterpolating {
-		snake, exists := s.currentState.Snakes[s.clientID]
-		if exists {
-			moveSnake(snake, int(s.currentState.World.ToInt32().Width), int(s.currentState.World.ToInt32().Height), s.currentState.FoodItems, s.currentState.Snakes)
 		}
+		return
 	}
-}
-
-func clamp(value, min, max float32) float32 {
-	if value < min {
-		return min
+	state, ok := s.snapshots.Sample(time.Now())
+	if !ok {
+		return
 	}
-	if value > max {
-		return max
+	if s.targetState != nil {
+		if own, ok := s.targetState.Snakes[s.clientID]; ok {
+			state.Snakes[s.clientID] = own
+		}
 	}
-	return value
+	s.currentState = state
 }
 
-func (s *ClientStateManager) interpolateStates(factor float32) GameState {
+// interpolateGameState moves every snake in to from where it is in from, t above 1 extrapolates.
+// Food and snakes that are new in to are shown as they are in to.
+func interpolateGameState(from, to GameState, t float64) GameState {
 	interpolated := GameState{
-		Snakes:    make(map[string]*Snake),
-		FoodItems: s.targetState.FoodItems,
-		World:     s.targetState.World,
+		Snakes:    make(map[string]*Snake, len(to.Snakes)),
+		FoodItems: slices.Clone(to.FoodItems),
+		World:     to.World,
 	}
+	worldWidth, worldHeight := int(to.World.Width)/10, int(to.World.Height)/10
 
-	worldWidth := 600
-	worldHeight := 600
-
-	for id, snake := range s.targetState.Snakes {
-		currentSnake, exists := s.currentState.Snakes[id]
+	for id, snake := range to.Snakes {
+		interpolatedSnake := *snake
+		interpolatedSnake.Segments = slices.Clone(snake.Segments)
+		interpolated.Snakes[id] = &interpolatedSnake
+		fromSnake, exists := from.Snakes[id]
 		if !exists {
-			interpolated.Snakes[id] = snake
 			continue
 		}
-
-		interpolatedSnake := &Snake{
-			ID:        id,
-			Direction: snake.Direction,
-			Segments:  make([]Position, len(snake.Segments)),
-		}
-
-		for i := range snake.Segments {
-			var currentPos Position
-			if i < len(currentSnake.Segments) {
-				currentPos = currentSnake.Segments[i]
-			} else {
-				currentPos = snake.Segments[i]
+		for i, target := range snake.Segments {
+			current := target
+			if i < len(fromSnake.Segments) {
+				current = fromSnake.Segments[i]
 			}
-
-			targetPos := snake.Segments[i]
-
-			interpolatedX := interpolateCoordinate(currentPos.X, targetPos.X, factor, worldWidth)
-			interpolatedY := interpolateCoordinate(currentPos.Y, targetPos.Y, factor, worldHeight)
-
 			interpolatedSnake.Segments[i] = Position{
-				X: interpolatedX,
-				Y: interpolatedY,
+				X: interpolateCoordinate(current.X, target.X, float32(t), worldWidth),
+				Y: interpolateCoordinate(current.Y, target.Y, float32(t), worldHeight),
 			}
 		}
-
-		interpolated.Snakes[id] = interpolatedSnake
 	}
 
 	return interpolated
@@ -232,7 +185,8 @@ func interpolateCoordinate(current, target int, factor float32, worldSize int) i
 	}
 
 	interpolated := int(lerp(float32(current), float32(current+diff), factor))
-	return (interpolated + worldSize) % worldSize
+	// extrapolating may overshoot by more than a world
+	return (interpolated%worldSize + worldSize) % worldSize
 }
 
 func abs(x int) int {
@@ -0,0 +1,43 @@
+package snake
+
+import (
+	"testing"
+
+	"github.com/KoduIsGreat/knight-game/nw"
+)
+
+func serverState(direction Direction, x int) GameState {
+	gs := newGameState()
+	gs.Snakes["me"] = &Snake{ID: "me", Segments: []Position{{X: x, Y: 10}}, Direction: direction}
+	return gs
+}
+
+func TestClientPredictsUnacknowledgedInputs(t *testing.T) {
+	s := NewClientStateManger()
+	s.SetClientID("me")
+	s.ReconcileState(nw.ServerStateMessage[GameState]{GameState: serverState(Right, 10)})
+	s.UpdateLocal(Down)
+	s.UpdateLocal(Left)
+
+	// the server has only seen the first input, the second is replayed on top of its state
+	s.ReconcileState(nw.ServerStateMessage[GameState]{
+		GameState:       serverState(Down, 12),
+		AcknowledgedSeq: map[string]uint32{"me": 1},
+	})
+	target := s.GetTarget().Snakes["me"]
+	if target.Direction != Left || target.Segments[0] != (Position{X: 11, Y: 10}) {
+		t.Errorf("got %+v, want the snake turned left and moved a step", target)
+	}
+	if stats := s.PredictionStats(); stats.Acknowledged != 1 || stats.Mispredictions != 0 || stats.Pending != 1 {
+		t.Errorf("got %+v, want one input acknowledged as predicted and one pending", stats)
+	}
+
+	// the server says the snake still heads right, the local turn left was wrong
+	s.ReconcileState(nw.ServerStateMessage[GameState]{
+		GameState:       serverState(Right, 14),
+		AcknowledgedSeq: map[string]uint32{"me": 2},
+	})
+	if stats := s.PredictionStats(); stats.Mispredictions != 1 || stats.Pending != 0 {
+		t.Errorf("got %+v, want a misprediction and nothing pending", stats)
+	}
+}
@@ -0,0 +1,110 @@
+package snake
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/KoduIsGreat/knight-game/nw"
+)
+
+// freeAddress returns a loopback UDP address nothing is listening on.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().String()
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// latestStates keeps draining a client's state channel so the server never blocks on it.
+func latestStates(c *nw.Client[GameState, Direction]) <-chan nw.ServerStateMessage[GameState] {
+	out := make(chan nw.ServerStateMessage[GameState], 1)
+	go func() {
+		for msg := range c.RecvFromServer() {
+			select {
+			case <-out:
+			default:
+			}
+			out <- msg
+		}
+	}()
+	return out
+}
+
+// startLobby runs a server with opts and returns an owner and a guest sharing a lobby.
+func startLobby(t *testing.T, opts ...nw.ServerOption[GameState, Direction]) (owner, guest *nw.Client[GameState, Direction]) {
+	t.Helper()
+	address := freeAddress(t)
+	server := nw.NewServer[GameState, Direction](NewServerStateManager(), append(opts, nw.WithAddress[GameState, Direction](address))...)
+	go server.Listen()
+	time.Sleep(100 * time.Millisecond)
+
+	clientOpts := nw.ClientOpts{ServerAddress: address}
+	owner = nw.NewClient(NewClientStateManger(), clientOpts)
+	guest = nw.NewClient(NewClientStateManger(), clientOpts)
+
+	owner.CreateLobby()
+	waitFor(t, "the lobby to be created", func() bool {
+		return owner.Lobby() != nil && owner.Lobby().ID != ""
+	})
+	guest.JoinLobby(owner.Lobby().ID)
+	waitFor(t, "the guest to join", func() bool {
+		return guest.Lobby() != nil && guest.Lobby().OwnerClientID == owner.ClientID() && len(owner.Lobby().ConnectedClients) == 2
+	})
+	return owner, guest
+}
+
+// startMatch readies both clients and has the owner start the game.
+func startMatch(t *testing.T, owner, guest *nw.Client[GameState, Direction]) {
+	t.Helper()
+	owner.Ready()
+	guest.Ready()
+	waitFor(t, "both clients to be ready", func() bool {
+		ready := owner.Lobby().ReadyClients
+		return ready[owner.ClientID()] && ready[guest.ClientID()]
+	})
+	owner.Start()
+	waitFor(t, "the game to start", func() bool {
+		return owner.IsStarted() && guest.IsStarted()
+	})
+}
+
+func TestTwoClientMatch(t *testing.T) {
+	owner, guest := startLobby(t, nw.WithLobbyOptions(nw.WithCountdown[GameState, Direction](0)))
+	ownerStates := latestStates(owner)
+	latestStates(guest)
+	startMatch(t, owner, guest)
+
+	var state nw.ServerStateMessage[GameState]
+	waitFor(t, "both snakes to be spawned", func() bool {
+		state = <-ownerStates
+		return state.GameState.Snakes[owner.ClientID()] != nil && state.GameState.Snakes[guest.ClientID()] != nil
+	})
+
+	owner.State().UpdateLocal(Down)
+	owner.SendInputToServer(Down)
+	waitFor(t, "the input to be acknowledged", func() bool {
+		state = <-ownerStates
+		return state.AcknowledgedSeq[owner.ClientID()] == 1
+	})
+	if dir := state.GameState.Snakes[owner.ClientID()].Direction; dir != Down {
+		t.Errorf("got direction %s, want DOWN", dir)
+	}
+	if dir := state.GameState.Snakes[guest.ClientID()].Direction; dir != Right {
+		t.Errorf("got guest direction %s, want RIGHT", dir)
+	}
+}
@@ -1,63 +1,203 @@
 package snake
 
 import (
+	"fmt"
+	"slices"
+	"time"
+
 	"github.com/KoduIsGreat/knight-game/nw"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
+// Rules are the end conditions of a match, the zero value never ends.
+type Rules struct {
+	// ScoreLimit ends the match once a snake, or in team matches a team, reaches it
+	ScoreLimit int
+	// TimeLimit ends the match once it has been running that long
+	TimeLimit time.Duration
+	// LastSnakeStanding stops dead snakes from respawning and ends the match when one is left,
+	// in team matches when a single team is left
+	LastSnakeStanding bool
+}
+
 type ServerStateManager struct {
 	state             GameState
-	clientInputQueues map[string][]nw.ClientInput
+	clientInputQueues map[string][]nw.ClientInput[Direction]
+	rules             Rules
+	// elapsed is the time the current match has been running
+	elapsed time.Duration
+	// lag is set by lobbies with lag compensation, collisions are then judged by what players saw
+	lag nw.LagCompensation[GameState]
+	// events happened since the lobby last took them
+	events []nw.GameEvent
+}
+
+type Option func(*ServerStateManager)
+
+func WithRules(rules Rules) Option {
+	return func(s *ServerStateManager) {
+		s.rules = rules
+	}
+}
+
+func NewServerStateManager(opts ...Option) *ServerStateManager {
+	s := &ServerStateManager{
+		state:             newWorld(),
+		clientInputQueues: make(map[string][]nw.ClientInput[Direction]),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func NewServerStateManager() *ServerStateManager {
+func newWorld() GameState {
 	world := rl.NewRectangle(0, 0, 1000, 1000)
-	foodItems := spawnFoodItems(80, world)
-	return &ServerStateManager{
-		state: GameState{
-			World:     world,
-			Snakes:    make(map[string]*Snake),
-			FoodItems: foodItems,
-		},
-		clientInputQueues: make(map[string][]nw.ClientInput),
+	return GameState{
+		World:     world,
+		Snakes:    make(map[string]*Snake),
+		FoodItems: spawnFoodItems(80, world),
 	}
 }
 
-var _ nw.StateManager[GameState] = &ServerStateManager{}
+var (
+	_ nw.StateManager[GameState, Direction] = &ServerStateManager{}
+	_ nw.LagCompensated[GameState]          = &ServerStateManager{}
+	_ nw.InterestManaged[GameState]         = &ServerStateManager{}
+	_ nw.GameEventEmitter                   = &ServerStateManager{}
+)
 
 func (s *ServerStateManager) Update(dt float64) {
-	updateGameState(s.state)
+	s.elapsed += time.Duration(dt * float64(time.Second))
+	var viewOf func(clientID string) (GameState, bool)
+	if s.lag != nil {
+		viewOf = s.lag.ViewOf
+	}
+	s.events = append(s.events, updateGameState(s.state, s.rules.LastSnakeStanding, viewOf)...)
+}
+
+func (s *ServerStateManager) TakeEvents() []nw.GameEvent {
+	events := s.events
+	s.events = nil
+	return events
+}
+
+func (s *ServerStateManager) SetLagCompensation(lc nw.LagCompensation[GameState]) {
+	s.lag = lc
+}
+
+func (s *ServerStateManager) GameOver() (nw.GameOver, bool) {
+	reason := s.endReason()
+	if reason == "" {
+		return nw.GameOver{}, false
+	}
+	results := make([]nw.PlayerResult, 0, len(s.state.Snakes))
+	for id, snake := range s.state.Snakes {
+		results = append(results, nw.PlayerResult{
+			ClientID:   id,
+			Score:      snake.Score,
+			Eliminated: snake.Dead,
+			Team:       snake.Team,
+		})
+	}
+	nw.RankResults(results)
+	return nw.GameOver{Reason: reason, Results: results, Teams: nw.RankTeams(results)}, true
+}
+
+// endReason returns why the match is over, or an empty string while it is still going.
+func (s *ServerStateManager) endReason() string {
+	if s.rules.TimeLimit > 0 && s.elapsed >= s.rules.TimeLimit {
+		return "time limit reached"
+	}
+	// snakes without a team play for themselves
+	scores := make(map[string]int)
+	alive := make(map[string]bool)
+	for _, snake := range s.state.Snakes {
+		side := snake.ID
+		if snake.Team != 0 {
+			side = fmt.Sprintf("team %d", snake.Team)
+		}
+		scores[side] += snake.Score
+		alive[side] = alive[side] || !snake.Dead
+	}
+	standing := 0
+	for side, score := range scores {
+		if s.rules.ScoreLimit > 0 && score >= s.rules.ScoreLimit {
+			return fmt.Sprintf("%s reached %d points", side, s.rules.ScoreLimit)
+		}
+		if alive[side] {
+			standing++
+		}
+	}
+	if s.rules.LastSnakeStanding && len(scores) > 1 && standing <= 1 {
+		return "last snake standing"
+	}
+	return ""
+}
+
+func (s *ServerStateManager) Reset() {
+	s.state = newWorld()
+	s.events = nil
+	s.clientInputQueues = make(map[string][]nw.ClientInput[Direction])
+	s.elapsed = 0
 }
 
 func (s *ServerStateManager) Get() GameState {
 	return s.state
 }
 
-func (s *ServerStateManager) ApplyInputToState(ci nw.ClientInput) {
-	snake, exists := s.state.Snakes[ci.ClientID]
-	if !exists {
-		return
+// GetFor returns the living snakes and food within radius cells of the head of clientID's snake,
+// its own snake is always in. Clients without a snake see the whole world.
+func (s *ServerStateManager) GetFor(clientID string, radius int) GameState {
+	own, ok := s.state.Snakes[clientID]
+	if radius <= 0 || !ok {
+		return s.state
+	}
+	head := own.Segments[0]
+	worldWidth, worldHeight := int(s.state.World.Width)/10, int(s.state.World.Height)/10
+	visible := func(p Position) bool {
+		return wrappedDistance(head.X, p.X, worldWidth) <= radius && wrappedDistance(head.Y, p.Y, worldHeight) <= radius
 	}
 
-	oppositeDirections := map[string]string{
-		"UP":    "DOWN",
-		"DOWN":  "UP",
-		"LEFT":  "RIGHT",
-		"RIGHT": "LEFT",
+	view := GameState{
+		Snakes:    make(map[string]*Snake),
+		FoodItems: make([]FoodItem, 0),
+		World:     s.state.World,
+	}
+	for id, snake := range s.state.Snakes {
+		if id == clientID || (!snake.Dead && slices.ContainsFunc(snake.Segments, visible)) {
+			view.Snakes[id] = snake
+		}
 	}
-	input := ci.Input
+	for _, food := range s.state.FoodItems {
+		if visible(food.Position) {
+			view.FoodItems = append(view.FoodItems, food)
+		}
+	}
+	return view
+}
 
-	if snake.Direction != oppositeDirections[input] {
-		snake.Direction = input
+// wrappedDistance is the distance between a and b on an axis of size cells that wraps around.
+func wrappedDistance(a, b, size int) int {
+	d := abs(a - b)
+	return min(d, size-d)
+}
+
+func (s *ServerStateManager) ApplyInputToState(ci nw.ClientInput[Direction]) {
+	snake, exists := s.state.Snakes[ci.ClientID]
+	if !exists {
+		return
 	}
+	turnSnake(snake, ci.Input)
 }
 
-func (s *ServerStateManager) InitClientEntity(clientID string) {
-	s.clientInputQueues[clientID] = make([]nw.ClientInput, 0)
+func (s *ServerStateManager) InitClientEntity(clientID string, team int) {
+	s.clientInputQueues[clientID] = make([]nw.ClientInput[Direction], 0)
 	s.state.Snakes[clientID] = &Snake{
 		ID:        clientID,
 		Segments:  []Position{{X: 0, Y: 0}},
-		Direction: "RIGHT",
+		Direction: Right,
+		Team:      team,
 	}
 }
 func (s *ServerStateManager) RemoveClientEntity(clientId string) {
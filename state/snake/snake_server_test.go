@@ -0,0 +1,141 @@
+package snake
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/KoduIsGreat/knight-game/nw"
+)
+
+// fixedView is a LagCompensation where every player saw the same state.
+type fixedView struct {
+	state GameState
+}
+
+func (v fixedView) ViewOf(clientID string) (GameState, bool) {
+	return v.state, true
+}
+
+func TestCollisionsAreJudgedByWhatThePlayerSaw(t *testing.T) {
+	bigAt := func(x int) *Snake {
+		return &Snake{ID: "big", Direction: Up, Segments: []Position{{X: x, Y: 8}, {X: x, Y: 9}, {X: x, Y: 10}, {X: x, Y: 11}}}
+	}
+	tests := []struct {
+		name     string
+		lag      nw.LagCompensation[GameState]
+		wantDead bool
+	}{
+		{name: "without lag compensation", wantDead: true},
+		{name: "the player saw the other snake", lag: fixedView{GameState{Snakes: map[string]*Snake{"big": bigAt(11)}}}, wantDead: true},
+		{name: "the other snake moved in within the player's latency", lag: fixedView{GameState{Snakes: map[string]*Snake{"big": bigAt(30)}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServerStateManager(WithRules(Rules{LastSnakeStanding: true}))
+			s.state.FoodItems = nil
+			s.state.Snakes["me"] = &Snake{ID: "me", Direction: Right, Segments: []Position{{X: 10, Y: 10}}}
+			s.state.Snakes["big"] = bigAt(11)
+			if tt.lag != nil {
+				s.SetLagCompensation(tt.lag)
+			}
+
+			s.Update(0.1)
+			if dead := s.Get().Snakes["me"].Dead; dead != tt.wantDead {
+				t.Errorf("got dead %v, want %v", dead, tt.wantDead)
+			}
+		})
+	}
+}
+
+func TestGetForSendsLessThanTheWholeWorld(t *testing.T) {
+	s := NewServerStateManager()
+	// a snake every 10 cells on a grid over the 100 by 100 cell world
+	for x := 0; x < 100; x += 10 {
+		for y := 0; y < 100; y += 10 {
+			id := fmt.Sprintf("%d-%d", x, y)
+			s.state.Snakes[id] = &Snake{ID: id, Direction: Right, Segments: []Position{{X: x, Y: y}, {X: x - 1, Y: y}}}
+		}
+	}
+	size := func(gs GameState) int {
+		msg, err := nw.NewGameStateMessage(nw.FmtJSON, nw.ServerStateMessage[GameState]{GameState: gs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wire bytes.Buffer
+		if err := msg.EncodeTo(&wire); err != nil {
+			t.Fatal(err)
+		}
+		return wire.Len()
+	}
+
+	whole := size(s.Get())
+	if got := size(s.GetFor("50-50", 0)); got != whole {
+		t.Errorf("got %d bytes without a radius, want the whole world's %d", got, whole)
+	}
+	view := s.GetFor("50-50", 15)
+	// the snakes at most 15 cells away on both axes, a 3 by 3 block around the own one
+	if len(view.Snakes) != 9 {
+		t.Errorf("got %d snakes in view, want 9", len(view.Snakes))
+	}
+	if got := size(view); got*4 > whole {
+		t.Errorf("got %d bytes in view, want less than a quarter of the whole world's %d", got, whole)
+	}
+	// the world wraps around, snakes across the edge are close
+	if _, ok := s.GetFor("0-0", 15).Snakes["90-90"]; !ok {
+		t.Error("got no snake across the world's edge in view")
+	}
+	s.state.Snakes["50-60"].Dead = true
+	if _, ok := s.GetFor("50-50", 15).Snakes["50-60"]; ok {
+		t.Error("got a dead snake in view")
+	}
+}
+
+func TestUpdateReportsGameEvents(t *testing.T) {
+	s := NewServerStateManager()
+	s.state.FoodItems = []FoodItem{{Position: Position{X: 11, Y: 10}}}
+	s.state.Snakes["me"] = &Snake{ID: "me", Direction: Right, Segments: []Position{{X: 10, Y: 10}}}
+	s.state.Snakes["small"] = &Snake{ID: "small", Direction: Right, Segments: []Position{{X: 20, Y: 20}}}
+	s.state.Snakes["big"] = &Snake{ID: "big", Direction: Up, Segments: []Position{{X: 21, Y: 19}, {X: 21, Y: 20}, {X: 21, Y: 21}, {X: 21, Y: 22}}}
+
+	s.Update(0.1)
+	events := s.TakeEvents()
+	want := []nw.GameEvent{
+		{Kind: nw.GameEventPickup, ClientID: "me", Value: 1},
+		{Kind: nw.GameEventScore, ClientID: "me", Value: 1},
+		{Kind: nw.GameEventDeath, ClientID: "small", OtherID: "big"},
+	}
+	// snakes move in no particular order
+	if len(events) != len(want) {
+		t.Fatalf("got %+v, want %+v", events, want)
+	}
+	for _, w := range want {
+		if !slices.Contains(events, w) {
+			t.Errorf("got %+v, want %+v among them", events, w)
+		}
+	}
+	if events := s.TakeEvents(); len(events) != 0 {
+		t.Errorf("got %+v taken twice", events)
+	}
+}
+
+func TestTimeLimitEndsMatch(t *testing.T) {
+	s := NewServerStateManager(WithRules(Rules{TimeLimit: 200 * time.Millisecond}))
+	s.InitClientEntity("a", 0)
+	s.InitClientEntity("b", 0)
+
+	s.Update(0.1)
+	if over, ok := s.GameOver(); ok {
+		t.Fatalf("got %+v before the time limit", over)
+	}
+	s.Update(0.1)
+	over, ok := s.GameOver()
+	if !ok || over.Reason != "time limit reached" {
+		t.Fatalf("got %+v, want the time limit reached", over)
+	}
+	if len(over.Results) != 2 {
+		t.Errorf("got %d results, want 2", len(over.Results))
+	}
+}
@@ -1,8 +1,11 @@
 package snake
 
 import (
+	"fmt"
 	"math/rand"
+	"slices"
 
+	"github.com/KoduIsGreat/knight-game/nw"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
@@ -11,10 +14,48 @@ type Position struct {
 	Y int `json:"y"`
 }
 
+// Direction is the way a snake heads, it is also the input players send.
+type Direction string
+
+const (
+	Up    Direction = "UP"
+	Down  Direction = "DOWN"
+	Left  Direction = "LEFT"
+	Right Direction = "RIGHT"
+)
+
+// Validate reports whether d is one of the four directions, the server drops any other input.
+func (d Direction) Validate() error {
+	switch d {
+	case Up, Down, Left, Right:
+		return nil
+	}
+	return fmt.Errorf("unknown direction %q", string(d))
+}
+
+func (d Direction) opposite() Direction {
+	switch d {
+	case Up:
+		return Down
+	case Down:
+		return Up
+	case Left:
+		return Right
+	case Right:
+		return Left
+	}
+	return ""
+}
+
 type Snake struct {
 	ID        string     `json:"id"`
 	Segments  []Position `json:"segments"`
-	Direction string     `json:"direction"`
+	Direction Direction  `json:"direction"`
+	Score     int        `json:"score"`
+	// Team is 0 in free for all matches
+	Team int `json:"team,omitempty"`
+	// Dead snakes are out of the match, they only die for good in last snake standing matches
+	Dead bool `json:"dead,omitempty"`
 }
 
 type FoodItem struct {
@@ -27,6 +68,21 @@ type GameState struct {
 	World     rl.Rectangle
 }
 
+// CloneGameState returns a deep copy of gs, it is the clone lag compensation needs.
+func CloneGameState(gs GameState) GameState {
+	clone := GameState{
+		Snakes:    make(map[string]*Snake, len(gs.Snakes)),
+		FoodItems: slices.Clone(gs.FoodItems),
+		World:     gs.World,
+	}
+	for id, snake := range gs.Snakes {
+		sc := *snake
+		sc.Segments = slices.Clone(snake.Segments)
+		clone.Snakes[id] = &sc
+	}
+	return clone
+}
+
 // generate food items within the world bounds
 // ensure food items do not overlap with other food items
 func spawnFoodItems(num int, world rl.Rectangle) []FoodItem {
@@ -48,26 +104,68 @@ func spawnFoodItems(num int, world rl.Rectangle) []FoodItem {
 	return foodItems
 }
 
-func updateGameState(gameState GameState) {
+// updateGameState moves every snake and returns what happened. viewOf, when not nil, returns the world as
+// the player of a snake saw it, collisions the player could not have seen coming are forgiven.
+func updateGameState(gameState GameState, eliminate bool, viewOf func(clientID string) (GameState, bool)) []nw.GameEvent {
+	var events []nw.GameEvent
 	for _, snake := range gameState.Snakes {
-		moveSnake(snake, int(gameState.World.ToInt32().Width), int(gameState.World.ToInt32().Height), gameState.FoodItems, gameState.Snakes)
+		var seen map[string]*Snake
+		if viewOf != nil {
+			if view, ok := viewOf(snake.ID); ok {
+				seen = view.Snakes
+			}
+		}
+		events = append(events, stepSnake(snake, gameState, eliminate, seen)...)
+	}
+	return events
+}
+
+// stepSnake moves snake and deals with the snakes that died doing so,
+// they respawn or, if eliminate is set, are out of the match.
+// seen are the other snakes as the player saw them, nil judges collisions at server time only.
+func stepSnake(snake *Snake, gameState GameState, eliminate bool, seen map[string]*Snake) []nw.GameEvent {
+	if snake.Dead {
+		return nil
+	}
+	worldWidth, worldHeight := int(gameState.World.ToInt32().Width), int(gameState.World.ToInt32().Height)
+	events := moveSnake(snake, worldWidth, worldHeight, gameState.FoodItems, gameState.Snakes, seen)
+	for _, ev := range events {
+		dead, ok := gameState.Snakes[ev.ClientID]
+		if ev.Kind != nw.GameEventDeath || !ok {
+			continue
+		}
+		if eliminate {
+			dead.Dead = true
+			continue
+		}
+		respawnSnake(dead, worldWidth, worldHeight)
+	}
+	return events
+}
+
+// turnSnake points snake in the direction of input, snakes cannot turn back on themselves.
+func turnSnake(snake *Snake, input Direction) {
+	if input.Validate() == nil && snake.Direction != input.opposite() {
+		snake.Direction = input
 	}
 }
 
 // move snake but respect world bounds
 // expand snake by adding a new tail if it eats food
-func moveSnake(snake *Snake, worldWidth, worldHeight int, foodItems []FoodItem, allSnakes map[string]*Snake) {
+// returns what happened, the caller decides whether the snakes that died respawn
+// a snake running into a bigger one only dies if the other snake was there in seen as well, when seen is given
+func moveSnake(snake *Snake, worldWidth, worldHeight int, foodItems []FoodItem, allSnakes map[string]*Snake, seen map[string]*Snake) []nw.GameEvent {
 	head := snake.Segments[0]
 	newHead := head
 
 	switch snake.Direction {
-	case "UP":
+	case Up:
 		newHead.Y -= 1
-	case "DOWN":
+	case Down:
 		newHead.Y += 1
-	case "LEFT":
+	case Left:
 		newHead.X -= 1
-	case "RIGHT":
+	case Right:
 		newHead.X += 1
 	}
 
@@ -84,22 +182,27 @@ func moveSnake(snake *Snake, worldWidth, worldHeight int, foodItems []FoodItem,
 	}
 	// Check for self-collision
 	if snakeCollidesWithSelf(snake, newHead) {
-		respawnSnake(snake, worldWidth, worldHeight)
-		return
+		return []nw.GameEvent{{Kind: nw.GameEventDeath, ClientID: snake.ID}}
 	}
 
 	// Check for collision with other snakes
+	var events []nw.GameEvent
 	for _, otherSnake := range allSnakes {
-		if otherSnake.ID != snake.ID {
+		// teammates pass through each other
+		if otherSnake.ID != snake.ID && !otherSnake.Dead && !sameTeam(snake, otherSnake) {
 			if snakeCollidesWithOther(newHead, otherSnake) {
 				if len(snake.Segments) > len(otherSnake.Segments) {
 					// Eat the smaller snake
 					snake.Segments = append(snake.Segments, otherSnake.Segments...)
-					respawnSnake(otherSnake, worldWidth, worldHeight)
-				} else {
-					// Die and respawn
-					respawnSnake(snake, worldWidth, worldHeight)
-					return
+					snake.Score += len(otherSnake.Segments)
+					events = append(events,
+						nw.GameEvent{Kind: nw.GameEventKill, ClientID: snake.ID, OtherID: otherSnake.ID},
+						nw.GameEvent{Kind: nw.GameEventDeath, ClientID: otherSnake.ID, OtherID: snake.ID},
+						nw.GameEvent{Kind: nw.GameEventScore, ClientID: snake.ID, Value: snake.Score},
+					)
+				} else if seen == nil || sawCollision(newHead, seen[otherSnake.ID]) {
+					// Die
+					return append(events, nw.GameEvent{Kind: nw.GameEventDeath, ClientID: snake.ID, OtherID: otherSnake.ID})
 				}
 			}
 		}
@@ -110,6 +213,11 @@ func moveSnake(snake *Snake, worldWidth, worldHeight int, foodItems []FoodItem,
 		if newHead == food.Position {
 			// add new tail
 			snake.Segments = append(snake.Segments, snake.Segments[len(snake.Segments)-1])
+			snake.Score++
+			events = append(events,
+				nw.GameEvent{Kind: nw.GameEventPickup, ClientID: snake.ID, Value: 1},
+				nw.GameEvent{Kind: nw.GameEventScore, ClientID: snake.ID, Value: snake.Score},
+			)
 			// remove food
 			foodItems = append(foodItems[:i], foodItems[i+1:]...)
 			break
@@ -118,6 +226,11 @@ func moveSnake(snake *Snake, worldWidth, worldHeight int, foodItems []FoodItem,
 
 	snake.Segments = append([]Position{newHead}, snake.Segments...)
 	snake.Segments = snake.Segments[:len(snake.Segments)-1]
+	return events
+}
+
+func sameTeam(a, b *Snake) bool {
+	return a.Team != 0 && a.Team == b.Team
 }
 
 func snakeCollidesWithSelf(snake *Snake, newHead Position) bool {
@@ -138,10 +251,16 @@ func snakeCollidesWithOther(newHead Position, otherSnake *Snake) bool {
 	return false
 }
 
+// sawCollision reports whether the player saw other where its snake's head moves to,
+// if not the other snake got there within the player's latency and running into it is forgiven.
+func sawCollision(newHead Position, other *Snake) bool {
+	return other != nil && !other.Dead && snakeCollidesWithOther(newHead, other)
+}
+
 func respawnSnake(snake *Snake, worldWidth, worldHeight int) {
 	snake.Segments = []Position{{
 		X: 1 + rand.Intn(worldWidth/10-2),
 		Y: 1 + rand.Intn(worldHeight/10-2),
 	}}
-	snake.Direction = "RIGHT"
+	snake.Direction = Right
 }